@@ -0,0 +1,701 @@
+package main
+
+import (
+	"auth_go/config"
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/keys"
+	"auth_go/routes"
+	"auth_go/utils"
+	"bufio"
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxNamespaceLength is the size of clients.namespace
+const maxNamespaceLength = 32
+
+type clientOutput struct {
+	ID           int64  `json:"id"`
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name"`
+	Confidential bool   `json:"confidential"`
+	// ClientSecret is only known right after it was generated, only its hash is stored
+	ClientSecret             string    `json:"client_secret,omitempty"`
+	AllowedScopes            string    `json:"allowed_scopes"`
+	UserPool                 string    `json:"user_pool"`
+	RequireEmailVerification bool      `json:"require_email_verification"`
+	RedirectURIs             []string  `json:"redirect_uris"`
+	BackchannelLogoutURI     string    `json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI    string    `json:"frontchannel_logout_uri"`
+	CreatedAt                time.Time `json:"created_at"`
+}
+
+type userOutput struct {
+	ID            int64      `json:"id"`
+	UUID          string     `json:"uuid"`
+	NamespaceID   int64      `json:"namespace_id"`
+	Email         string     `json:"email"`
+	Firstname     string     `json:"firstname"`
+	Lastname      string     `json:"lastname"`
+	EmailVerified bool       `json:"email_verified"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	DisabledAt    *time.Time `json:"disabled_at,omitempty"`
+}
+
+type keyOutput struct {
+	Kid       string     `json:"kid"`
+	Algorithm string     `json:"algorithm"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+}
+
+// stringList is a flag that may be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// writeJSON prints the result of a command for scripts to consume
+func writeJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// parseFlags parses the flags of a command taking one positional argument before them
+func parseFlags(fs *flag.FlagSet, name string, args []string) (string, error) {
+	fs.SetOutput(io.Discard)
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", fmt.Errorf("%s needs a %s\n%s", fs.Name(), name, usage)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return "", fmt.Errorf("%s: %w\n%s", fs.Name(), err, usage)
+	}
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("%s: unexpected argument %q\n%s", fs.Name(), fs.Arg(0), usage)
+	}
+	return args[0], nil
+}
+
+// parseOnlyFlags parses the flags of a command without positional arguments
+func parseOnlyFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w\n%s", fs.Name(), err, usage)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected argument %q\n%s", fs.Name(), fs.Arg(0), usage)
+	}
+	return nil
+}
+
+// flagsSet returns the names of the flags given on the command line
+func flagsSet(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// readPassword reads a password from the first line of standard input, keeping it out of the process list
+func readPassword(stdin io.Reader) (string, error) {
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("expected the password on standard input")
+	}
+	return password, nil
+}
+
+func runClient(ctx context.Context, database *db.Db, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing client command\n%s", usage)
+	}
+
+	switch args[0] {
+	case "create":
+		return createClient(ctx, database, args[1:])
+	case "list":
+		if err := parseOnlyFlags(flag.NewFlagSet("client list", flag.ContinueOnError), args[1:]); err != nil {
+			return err
+		}
+		clients, err := database.Queries.ListClients(ctx)
+		if err != nil {
+			return err
+		}
+		outputs := []clientOutput{}
+		for _, client := range clients {
+			output, err := describeClient(ctx, database, client)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, output)
+		}
+		return writeJSON(outputs)
+	case "update":
+		return updateClient(ctx, database, args[1:])
+	case "delete":
+		return deleteClient(ctx, database, args[1:])
+	}
+	return fmt.Errorf("unknown client command %q\n%s", args[0], usage)
+}
+
+func describeClient(ctx context.Context, database *db.Db, client dbcommon.Client) (clientOutput, error) {
+	redirectURIs, err := database.Queries.ListClientRedirectURIs(ctx, client.ID)
+	if err != nil {
+		return clientOutput{}, err
+	}
+	if redirectURIs == nil {
+		redirectURIs = []string{}
+	}
+	return clientOutput{
+		ID:                       client.ID,
+		Namespace:                client.Namespace,
+		Name:                     client.Name,
+		Confidential:             client.ClientSecret.Valid,
+		AllowedScopes:            client.AllowedScopes,
+		UserPool:                 client.UserPool,
+		RequireEmailVerification: client.RequireEmailVerification,
+		BackchannelLogoutURI:     client.BackchannelLogoutUri,
+		FrontchannelLogoutURI:    client.FrontchannelLogoutUri,
+		RedirectURIs:             redirectURIs,
+		CreatedAt:                client.CreatedAt,
+	}, nil
+}
+
+// clientSecret generates a client secret and the hash of it that is stored
+func clientSecret() (string, sql.NullString, error) {
+	secret, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", sql.NullString{}, err
+	}
+	hash, err := utils.GenerateFromPassword(secret)
+	if err != nil {
+		return "", sql.NullString{}, err
+	}
+	return secret, sql.NullString{String: hash, Valid: true}, nil
+}
+
+func validateUserPool(pool string) error {
+	if pool != routes.UserPoolGlobal && pool != routes.UserPoolNamespace {
+		return fmt.Errorf("user pool must be %s or %s, got %q", routes.UserPoolGlobal, routes.UserPoolNamespace, pool)
+	}
+	return nil
+}
+
+func validateRedirectURIs(uris []string) error {
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return fmt.Errorf("redirect URI must be an absolute URI without a fragment, got %q", uri)
+		}
+	}
+	return nil
+}
+
+// validateLogoutURI checks a back-channel or front-channel logout URI, empty unregisters it
+func validateLogoutURI(flagName, uri string) error {
+	if uri == "" {
+		return nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return fmt.Errorf("-%s must be an absolute URI without a fragment, got %q", flagName, uri)
+	}
+	return nil
+}
+
+func setRedirectURIs(ctx context.Context, database *db.Db, clientID int64, uris []string) error {
+	if err := database.Queries.DeleteClientRedirectURIs(ctx, clientID); err != nil {
+		return err
+	}
+	for _, uri := range uris {
+		err := database.Queries.CreateClientRedirectURI(ctx, dbcommon.CreateClientRedirectURIParams{
+			ClientID:    clientID,
+			RedirectUri: uri,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createClient(ctx context.Context, database *db.Db, args []string) error {
+	fs := flag.NewFlagSet("client create", flag.ContinueOnError)
+	name := fs.String("name", "", "name shown to users, the namespace by default")
+	scopes := fs.String("scopes", "openid profile email", "scopes the client may request")
+	userPool := fs.String("user-pool", routes.UserPoolGlobal, "global or namespace")
+	requireVerification := fs.Bool("require-email-verification", false, "only let users with a verified email log in")
+	confidential := fs.Bool("confidential", false, "generate a client secret")
+	var redirectURIs stringList
+	fs.Var(&redirectURIs, "redirect-uri", "allowed redirect URI, may be repeated")
+	backchannelLogoutURI := fs.String("backchannel-logout-uri", "", "URI logout tokens are posted to when a user logs out")
+	frontchannelLogoutURI := fs.String("frontchannel-logout-uri", "", "URI loaded in an iframe when a user logs out")
+	namespace, err := parseFlags(fs, "namespace", args)
+	if err != nil {
+		return err
+	}
+
+	if len(namespace) > maxNamespaceLength {
+		return fmt.Errorf("namespace must be at most %d characters", maxNamespaceLength)
+	}
+	if err := validateUserPool(*userPool); err != nil {
+		return err
+	}
+	if err := validateRedirectURIs(redirectURIs); err != nil {
+		return err
+	}
+	if err := validateLogoutURI("backchannel-logout-uri", *backchannelLogoutURI); err != nil {
+		return err
+	}
+	if err := validateLogoutURI("frontchannel-logout-uri", *frontchannelLogoutURI); err != nil {
+		return err
+	}
+	if _, err := database.Queries.GetClientByNamespace(ctx, namespace); err == nil {
+		return fmt.Errorf("client %s already exists", namespace)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if *confidential {
+		if secret, secretHash, err = clientSecret(); err != nil {
+			return err
+		}
+	}
+
+	err = database.Queries.CreateClient(ctx, dbcommon.CreateClientParams{
+		Namespace:                namespace,
+		Name:                     cmp.Or(*name, namespace),
+		ClientSecret:             secretHash,
+		AllowedScopes:            strings.Join(utils.ParseScope(*scopes), " "),
+		UserPool:                 *userPool,
+		RequireEmailVerification: *requireVerification,
+		BackchannelLogoutUri:     *backchannelLogoutURI,
+		FrontchannelLogoutUri:    *frontchannelLogoutURI,
+	})
+	if err != nil {
+		return err
+	}
+
+	client, err := database.Queries.GetClientByNamespace(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if err := setRedirectURIs(ctx, database, client.ID, redirectURIs); err != nil {
+		return err
+	}
+
+	output, err := describeClient(ctx, database, client)
+	if err != nil {
+		return err
+	}
+	output.ClientSecret = secret
+	return writeJSON(output)
+}
+
+func updateClient(ctx context.Context, database *db.Db, args []string) error {
+	fs := flag.NewFlagSet("client update", flag.ContinueOnError)
+	name := fs.String("name", "", "name shown to users")
+	scopes := fs.String("scopes", "", "scopes the client may request")
+	userPool := fs.String("user-pool", "", "global or namespace")
+	requireVerification := fs.Bool("require-email-verification", false, "only let users with a verified email log in")
+	rotateSecret := fs.Bool("rotate-secret", false, "generate a new client secret, making the client confidential")
+	public := fs.Bool("public", false, "remove the client secret, making the client public")
+	var redirectURIs stringList
+	fs.Var(&redirectURIs, "redirect-uri", "allowed redirect URI, may be repeated, replaces the registered ones")
+	backchannelLogoutURI := fs.String("backchannel-logout-uri", "", "URI logout tokens are posted to when a user logs out, empty for none")
+	frontchannelLogoutURI := fs.String("frontchannel-logout-uri", "", "URI loaded in an iframe when a user logs out, empty for none")
+	namespace, err := parseFlags(fs, "namespace", args)
+	if err != nil {
+		return err
+	}
+	set := flagsSet(fs)
+
+	if *rotateSecret && *public {
+		return errors.New("-rotate-secret and -public can't be combined")
+	}
+	if err := validateRedirectURIs(redirectURIs); err != nil {
+		return err
+	}
+	if err := validateLogoutURI("backchannel-logout-uri", *backchannelLogoutURI); err != nil {
+		return err
+	}
+	if err := validateLogoutURI("frontchannel-logout-uri", *frontchannelLogoutURI); err != nil {
+		return err
+	}
+
+	client, err := database.Queries.GetClientByNamespace(ctx, namespace)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("client %s does not exist", namespace)
+	}
+	if err != nil {
+		return err
+	}
+
+	params := dbcommon.UpdateClientParams{
+		Name:                     client.Name,
+		ClientSecret:             client.ClientSecret,
+		AllowedScopes:            client.AllowedScopes,
+		UserPool:                 client.UserPool,
+		RequireEmailVerification: client.RequireEmailVerification,
+		BackchannelLogoutUri:     client.BackchannelLogoutUri,
+		FrontchannelLogoutUri:    client.FrontchannelLogoutUri,
+		ID:                       client.ID,
+	}
+	if set["name"] {
+		params.Name = *name
+	}
+	if set["scopes"] {
+		params.AllowedScopes = strings.Join(utils.ParseScope(*scopes), " ")
+	}
+	if set["require-email-verification"] {
+		params.RequireEmailVerification = *requireVerification
+	}
+	if set["backchannel-logout-uri"] {
+		params.BackchannelLogoutUri = *backchannelLogoutURI
+	}
+	if set["frontchannel-logout-uri"] {
+		params.FrontchannelLogoutUri = *frontchannelLogoutURI
+	}
+	if set["user-pool"] && *userPool != client.UserPool {
+		if err := validateUserPool(*userPool); err != nil {
+			return err
+		}
+		// Users of a namespace pool would be left behind, unable to log in anywhere
+		if client.UserPool == routes.UserPoolNamespace {
+			users, err := database.Queries.ListUsers(ctx, client.ID)
+			if err != nil {
+				return err
+			}
+			if len(users) > 0 {
+				return fmt.Errorf("the user pool of client %s is not empty", namespace)
+			}
+		}
+		params.UserPool = *userPool
+	}
+
+	var secret string
+	switch {
+	case *rotateSecret:
+		if secret, params.ClientSecret, err = clientSecret(); err != nil {
+			return err
+		}
+	case *public:
+		params.ClientSecret = sql.NullString{}
+	}
+
+	if err := database.Queries.UpdateClient(ctx, params); err != nil {
+		return err
+	}
+	if set["redirect-uri"] {
+		if err := setRedirectURIs(ctx, database, client.ID, redirectURIs); err != nil {
+			return err
+		}
+	}
+
+	client, err = database.Queries.GetClientByID(ctx, client.ID)
+	if err != nil {
+		return err
+	}
+	output, err := describeClient(ctx, database, client)
+	if err != nil {
+		return err
+	}
+	output.ClientSecret = secret
+	return writeJSON(output)
+}
+
+func deleteClient(ctx context.Context, database *db.Db, args []string) error {
+	namespace, err := parseFlags(flag.NewFlagSet("client delete", flag.ContinueOnError), "namespace", args)
+	if err != nil {
+		return err
+	}
+
+	client, err := database.Queries.GetClientByNamespace(ctx, namespace)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("client %s does not exist", namespace)
+	}
+	if err != nil {
+		return err
+	}
+
+	if client.UserPool == routes.UserPoolNamespace {
+		users, err := database.Queries.ListUsers(ctx, client.ID)
+		if err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			return fmt.Errorf("the user pool of client %s is not empty", namespace)
+		}
+	}
+
+	// Redirect URIs and consents are deleted along with the client
+	if err := database.Queries.DeleteClientSessions(ctx, client.ID); err != nil {
+		return err
+	}
+	if err := database.Queries.DeleteClientRefreshTokens(ctx, client.ID); err != nil {
+		return err
+	}
+	if _, err := database.Queries.DeleteClient(ctx, client.ID); err != nil {
+		return err
+	}
+	return writeJSON(map[string]any{"deleted": namespace})
+}
+
+func runUser(ctx context.Context, database *db.Db, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing user command\n%s", usage)
+	}
+
+	switch args[0] {
+	case "create":
+		return createUser(ctx, database, args[1:])
+	case "list":
+		fs := flag.NewFlagSet("user list", flag.ContinueOnError)
+		namespace := fs.String("namespace", "", "client namespace whose user pool to list, the global pool by default")
+		if err := parseOnlyFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		namespaceID, err := userPool(ctx, database, *namespace)
+		if err != nil {
+			return err
+		}
+		users, err := database.Queries.ListUsers(ctx, namespaceID)
+		if err != nil {
+			return err
+		}
+		outputs := []userOutput{}
+		for _, user := range users {
+			outputs = append(outputs, describeUser(user))
+		}
+		return writeJSON(outputs)
+	case "disable", "enable", "set-password", "unlock":
+		return changeUser(ctx, database, args[0], args[1:])
+	}
+	return fmt.Errorf("unknown user command %q\n%s", args[0], usage)
+}
+
+func describeUser(user dbcommon.User) userOutput {
+	return userOutput{
+		ID:            user.ID,
+		UUID:          user.Uuid,
+		NamespaceID:   user.NamespaceID,
+		Email:         user.Email,
+		Firstname:     user.Firstname,
+		Lastname:      user.Lastname,
+		EmailVerified: user.EmailVerified,
+		LockedUntil:   nullTime(user.LockedUntil),
+		DisabledAt:    nullTime(user.DisabledAt),
+	}
+}
+
+// userPool resolves the user pool of a client namespace
+func userPool(ctx context.Context, database *db.Db, namespace string) (int64, error) {
+	namespaceID, err := routes.NamespaceUserPool(ctx, database, namespace)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("client %s does not exist", namespace)
+	}
+	return namespaceID, err
+}
+
+func createUser(ctx context.Context, database *db.Db, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	namespace := fs.String("namespace", "", "client namespace whose user pool to add the user to, the global pool by default")
+	firstname := fs.String("firstname", "", "first name")
+	lastname := fs.String("lastname", "", "last name")
+	verified := fs.Bool("verified", false, "mark the email address as verified")
+	email, err := parseFlags(fs, "email", args)
+	if err != nil {
+		return err
+	}
+
+	namespaceID, err := userPool(ctx, database, *namespace)
+	if err != nil {
+		return err
+	}
+	if _, err := database.Queries.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{NamespaceID: namespaceID, Email: email}); err == nil {
+		return fmt.Errorf("user %s already exists", email)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	password, err := readPassword(os.Stdin)
+	if err != nil {
+		return err
+	}
+	encodedHash, err := utils.GenerateFromPassword(password)
+	if err != nil {
+		return err
+	}
+
+	userUUID := uuid.New().String()
+	err = database.Queries.CreateUser(ctx, dbcommon.CreateUserParams{
+		NamespaceID: namespaceID,
+		Email:       email,
+		Password:    encodedHash,
+		Uuid:        userUUID,
+		Firstname:   *firstname,
+		Lastname:    *lastname,
+	})
+	if err != nil {
+		return err
+	}
+
+	user, err := database.Queries.GetUserByUUID(ctx, userUUID)
+	if err != nil {
+		return err
+	}
+	if *verified {
+		if err := database.Queries.SetUserEmailVerified(ctx, user.ID); err != nil {
+			return err
+		}
+		user.EmailVerified = true
+	}
+	return writeJSON(describeUser(user))
+}
+
+// changeUser runs the commands changing an existing user
+func changeUser(ctx context.Context, database *db.Db, command string, args []string) error {
+	fs := flag.NewFlagSet("user "+command, flag.ContinueOnError)
+	namespace := fs.String("namespace", "", "client namespace whose user pool the user is in, the global pool by default")
+	email, err := parseFlags(fs, "email", args)
+	if err != nil {
+		return err
+	}
+
+	namespaceID, err := userPool(ctx, database, *namespace)
+	if err != nil {
+		return err
+	}
+	user, err := database.Queries.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{NamespaceID: namespaceID, Email: email})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user %s does not exist", email)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "disable":
+		if err := database.Queries.DisableUser(ctx, user.ID); err != nil {
+			return err
+		}
+		// Logging in is refused from now on, end what the user is logged in to already
+		if err := routes.InvalidateUserSessions(ctx, database, user.ID); err != nil {
+			return err
+		}
+	case "enable":
+		if err := database.Queries.EnableUser(ctx, user.ID); err != nil {
+			return err
+		}
+	case "set-password":
+		password, err := readPassword(os.Stdin)
+		if err != nil {
+			return err
+		}
+		encodedHash, err := utils.GenerateFromPassword(password)
+		if err != nil {
+			return err
+		}
+		err = database.Queries.UpdateUserPassword(ctx, dbcommon.UpdateUserPasswordParams{
+			Password: encodedHash,
+			ID:       user.ID,
+		})
+		if err != nil {
+			return err
+		}
+		if err := routes.InvalidateUserSessions(ctx, database, user.ID); err != nil {
+			return err
+		}
+		// A new password is a fresh start for the lockout as well
+		if err := database.Queries.UnlockUser(ctx, user.ID); err != nil {
+			return err
+		}
+	case "unlock":
+		// Lifts a lockout before it expires and forgets the failed attempts
+		if err := database.Queries.UnlockUser(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+
+	user, err = database.Queries.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(describeUser(user))
+}
+
+func runKeys(ctx context.Context, cfg *config.Config, database *db.Db, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing keys command\n%s", usage)
+	}
+
+	switch args[0] {
+	case "list":
+		if err := parseOnlyFlags(flag.NewFlagSet("keys list", flag.ContinueOnError), args[1:]); err != nil {
+			return err
+		}
+	case "rotate":
+		if err := parseOnlyFlags(flag.NewFlagSet("keys rotate", flag.ContinueOnError), args[1:]); err != nil {
+			return err
+		}
+		keyManager, err := keys.NewManager(database, cfg.Signing.Algorithm, cfg.Signing.RotationInterval, cfg.Signing.RotationOverlap, cfg.Signing.AllowUnencryptedKeys)
+		if err != nil {
+			return err
+		}
+		// Running servers pick the new key up when they next reload, within a minute
+		if err := keyManager.Rotate(ctx); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown keys command %q\n%s", args[0], usage)
+	}
+
+	published, err := database.Queries.ListPublishedSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	outputs := []keyOutput{}
+	for _, key := range published {
+		outputs = append(outputs, keyOutput{
+			Kid:       key.Kid,
+			Algorithm: key.Algorithm,
+			Status:    key.Status,
+			CreatedAt: key.CreatedAt,
+			RotatedAt: nullTime(key.RotatedAt),
+		})
+	}
+	return writeJSON(outputs)
+}
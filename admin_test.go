@@ -0,0 +1,71 @@
+package main
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestUserUnlock(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	database := db.NewDb(store)
+
+	namespaceID, err := userPool(ctx, database, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreateUser(ctx, dbcommon.CreateUserParams{
+		NamespaceID: namespaceID,
+		Email:       "jane@example.com",
+		Uuid:        uuid.NewString(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{NamespaceID: namespaceID, Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for range 3 {
+		err := store.RecordFailedLogin(ctx, dbcommon.RecordFailedLoginParams{
+			LastFailedLoginAt: sql.NullTime{Time: now, Valid: true},
+			ID:                user.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = store.LockUser(ctx, dbcommon.LockUserParams{
+		LockedUntil:   sql.NullTime{Time: now.Add(time.Hour), Valid: true},
+		ID:            user.ID,
+		LockedUntil_2: sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runUser(ctx, database, []string{"unlock", "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err = store.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.LockedUntil.Valid || user.FailedLoginAttempts != 0 || user.LastFailedLoginAt.Valid {
+		t.Errorf("user still locked: locked until %v, %d failed attempts, last at %v",
+			user.LockedUntil, user.FailedLoginAttempts, user.LastFailedLoginAt)
+	}
+
+	if err := runUser(ctx, database, []string{"unlock", "nobody@example.com"}); err == nil {
+		t.Error("unlocking a user that doesn't exist succeeded")
+	}
+}
@@ -0,0 +1,82 @@
+// Package backchannel posts logout tokens to the back-channel logout URIs of clients
+// (OpenID Connect Back-Channel Logout 1.0)
+package backchannel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Notifier delivers logout tokens, retrying failed deliveries with exponential backoff
+type Notifier struct {
+	Client *http.Client
+	// Attempts is how many times a delivery is tried before giving up
+	Attempts int
+	// Backoff is the wait before the first retry, it doubles for every retry after
+	Backoff time.Duration
+}
+
+func NewNotifier(attempts int, timeout time.Duration) *Notifier {
+	return &Notifier{
+		Client: &http.Client{
+			Timeout: timeout,
+			// The token is meant for the registered URI only
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		Attempts: attempts,
+		Backoff:  time.Second,
+	}
+}
+
+// errRejected is a response retrying won't change, such as the client refusing the token
+var errRejected = errors.New("logout token rejected")
+
+// Deliver posts the logout token to uri until the client accepts it or the attempts run out
+func (n *Notifier) Deliver(ctx context.Context, uri, logoutToken string) error {
+	backoff := n.Backoff
+	var err error
+	for attempt := 1; attempt <= n.Attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		err = n.post(ctx, uri, logoutToken)
+		if err == nil || errors.Is(err, errRejected) {
+			return err
+		}
+	}
+	return fmt.Errorf("after %d attempts: %w", n.Attempts, err)
+}
+
+func (n *Notifier) post(ctx context.Context, uri, logoutToken string) error {
+	body := url.Values{"logout_token": {logoutToken}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRejected, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("logout URI returned %s", resp.Status)
+	}
+	return fmt.Errorf("%w: logout URI returned %s", errRejected, resp.Status)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"auth_go/config"
+	"auth_go/db"
+	"auth_go/migrations"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const usage = `usage: main [flags] [command]
+
+Without a command the server is started.
+
+Commands:
+  migrate up [N]         apply N or all pending migrations
+  migrate down [N]       revert the N most recent migrations, 1 by default
+  migrate status         list migrations and whether they are applied
+  migrate force VERSION  record VERSION as the current schema version without running anything
+
+  client create NAMESPACE [-name NAME] [-scopes SCOPES] [-user-pool global|namespace]
+                [-require-email-verification] [-confidential] [-redirect-uri URI]...
+                [-backchannel-logout-uri URI] [-frontchannel-logout-uri URI]
+  client list
+  client update NAMESPACE [-name NAME] [-scopes SCOPES] [-user-pool global|namespace]
+                [-require-email-verification=BOOL] [-rotate-secret | -public] [-redirect-uri URI]...
+                [-backchannel-logout-uri URI] [-frontchannel-logout-uri URI]
+  client delete NAMESPACE
+
+  user create EMAIL [-namespace NAMESPACE] [-firstname NAME] [-lastname NAME] [-verified]
+  user list [-namespace NAMESPACE]
+  user disable EMAIL [-namespace NAMESPACE]
+  user enable EMAIL [-namespace NAMESPACE]
+  user set-password EMAIL [-namespace NAMESPACE]
+  user unlock EMAIL [-namespace NAMESPACE]
+
+  keys list
+  keys rotate
+
+Client, user and keys commands print JSON. Passwords are read from the first line of standard input,
+a generated client secret is only printed once.`
+
+// runCommand runs a command given on the command line instead of the server
+func runCommand(ctx context.Context, cfg *config.Config, migrator *migrations.Migrator, database *db.Db, args []string) error {
+	if args[0] == "migrate" {
+		return runMigrate(ctx, migrator, args[1:])
+	}
+
+	// Everything else works with the data and needs the schema this release was written for
+	if err := migrator.Check(ctx); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "client":
+		return runClient(ctx, database, args[1:])
+	case "user":
+		return runUser(ctx, database, args[1:])
+	case "keys":
+		return runKeys(ctx, cfg, database, args[1:])
+	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+}
+
+func runMigrate(ctx context.Context, migrator *migrations.Migrator, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", usage)
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := countArg(args[1:], 0)
+		if err != nil {
+			return err
+		}
+		applied, err := migrator.Up(ctx, n)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+
+	case "down":
+		n, err := countArg(args[1:], 1)
+		if err != nil {
+			return err
+		}
+		reverted, err := migrator.Down(ctx, n)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			status, appliedAt := "pending", ""
+			if s.Applied {
+				status, appliedAt = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Dirty {
+				status = "dirty"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+		}
+		return w.Flush()
+
+	case "force":
+		if len(args) != 2 {
+			return fmt.Errorf("migrate force needs exactly one version\n%s", usage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Printf("schema version set to %d\n", version)
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %q\n%s", args[0], usage)
+}
+
+// countArg parses the optional migration count argument
+func countArg(args []string, defaultValue int) (int, error) {
+	if len(args) == 0 {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if len(args) > 1 || err != nil || n < 1 {
+		return 0, fmt.Errorf("migration count must be a positive number\n%s", usage)
+	}
+	return n, nil
+}
@@ -1,78 +1,305 @@
 package config
 
 import (
-	"bufio"
+	"auth_go/dbcommon"
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
-	"os"
-	"strings"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// Config is the complete service configuration.
+//
+// Every setting is read, from lowest to highest precedence, from the built-in
+// defaults, the config file (YAML or JSON, keyed by the yaml tags), the
+// environment variable in its env tag and the command line flag named after its
+// dotted yaml path, e.g. -database.host. Any environment variable can instead be
+// given as <NAME>_FILE pointing to a file holding the value, for Docker secrets.
 type Config struct {
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Session   SessionConfig   `yaml:"session"`
+	Cookie    CookieConfig    `yaml:"cookie"`
+	Tokens    TokenConfig     `yaml:"tokens"`
+	Signing   SigningConfig   `yaml:"signing"`
+	Mail      MailConfig      `yaml:"mail"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Lockout   LockoutConfig   `yaml:"lockout"`
+	MFA       MFAConfig       `yaml:"mfa"`
 }
 
-func loadEnvFile() error {
-	file, err := os.Open(".env")
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+type ServerConfig struct {
+	Addr        string   `yaml:"addr" env:"LISTEN_ADDR" usage:"address the HTTP server listens on"`
+	Issuer      string   `yaml:"issuer" env:"ISSUER" usage:"public base URL of the service, used as OpenID Connect issuer"`
+	CORSOrigins []string `yaml:"cors_origins" env:"CORS_ORIGINS" usage:"comma separated origins allowed to call the API from a browser"`
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
+type DatabaseConfig struct {
+	Driver   string `yaml:"driver" env:"DB_DRIVER" usage:"database to store data in: mysql, postgres or sqlite"`
+	Host     string `yaml:"host" env:"DB_HOST" usage:"MySQL or PostgreSQL host"`
+	Port     string `yaml:"port" env:"DB_PORT" usage:"MySQL or PostgreSQL port, 3306 or 5432 when empty"`
+	User     string `yaml:"user" env:"DB_USER" usage:"MySQL or PostgreSQL user"`
+	Password string `yaml:"password" env:"DB_PASSWORD" usage:"MySQL or PostgreSQL password"`
+	Name     string `yaml:"name" env:"DB_NAME" usage:"MySQL or PostgreSQL database name"`
+	Path     string `yaml:"path" env:"DB_PATH" usage:"SQLite database file"`
+	// DSN is handed to the driver as is, for options the other settings don't cover
+	DSN string `yaml:"dsn" env:"DB_DSN" usage:"driver specific connection string, overrides the other database settings"`
+	// AutoMigrate applies pending migrations at startup instead of refusing to start
+	AutoMigrate bool `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE" usage:"apply pending schema migrations at startup"`
+}
 
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
+type SessionConfig struct {
+	// Key signs session cookies, it must be the same on every replica
+	Key string `yaml:"key" env:"SESSION_KEY" usage:"secret of at least 32 bytes used to sign session cookies"`
+	// Lifetime is how long users stay logged in across clients without entering their password again
+	Lifetime time.Duration `yaml:"lifetime" env:"SESSION_LIFETIME" usage:"how long a login is remembered across clients"`
+	// LogoutRevokesTokens makes logging out revoke the tokens issued since the user logged in
+	LogoutRevokesTokens bool `yaml:"logout_revokes_tokens" env:"SESSION_LOGOUT_REVOKES_TOKENS" usage:"revoke the tokens issued from an SSO session when the user logs out"`
+	// BackchannelLogoutAttempts is how often a logout token is posted to a client that doesn't accept it
+	BackchannelLogoutAttempts int           `yaml:"backchannel_logout_attempts" env:"BACKCHANNEL_LOGOUT_ATTEMPTS" usage:"deliveries of a logout token tried before giving up"`
+	BackchannelLogoutTimeout  time.Duration `yaml:"backchannel_logout_timeout" env:"BACKCHANNEL_LOGOUT_TIMEOUT" usage:"how long a client may take to accept a logout token"`
+}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		// Only set if not already set (Docker env vars take precedence)
-		if os.Getenv(key) == "" {
-			os.Setenv(key, value)
-		}
+type CookieConfig struct {
+	Domain   string `yaml:"domain" env:"COOKIE_DOMAIN" usage:"domain attribute of cookies, empty for the issuing host only"`
+	Secure   bool   `yaml:"secure" env:"COOKIE_SECURE" usage:"only send cookies over HTTPS"`
+	SameSite string `yaml:"same_site" env:"COOKIE_SAME_SITE" usage:"SameSite attribute of cookies: lax, strict or none"`
+}
+
+type TokenConfig struct {
+	AccessLifetime            time.Duration `yaml:"access_lifetime" env:"ACCESS_TOKEN_LIFETIME" usage:"how long access tokens are valid"`
+	IDLifetime                time.Duration `yaml:"id_lifetime" env:"ID_TOKEN_LIFETIME" usage:"how long ID tokens are valid"`
+	RefreshLifetime           time.Duration `yaml:"refresh_lifetime" env:"REFRESH_TOKEN_LIFETIME" usage:"how long refresh tokens can be exchanged"`
+	EmailVerificationLifetime time.Duration `yaml:"email_verification_lifetime" env:"EMAIL_VERIFICATION_LIFETIME" usage:"how long email verification links are valid"`
+	PasswordResetLifetime     time.Duration `yaml:"password_reset_lifetime" env:"PASSWORD_RESET_LIFETIME" usage:"how long password reset links are valid"`
+}
+
+// SigningConfig controls the keys tokens are signed with. The keys themselves
+// are generated and stored in the database, encrypted with mfa.encryption_key.
+type SigningConfig struct {
+	Algorithm        string        `yaml:"algorithm" env:"JWT_SIGNING_ALG" usage:"algorithm of new signing keys"`
+	RotationInterval time.Duration `yaml:"rotation_interval" env:"JWT_KEY_ROTATION_INTERVAL" usage:"how often a new signing key is generated"`
+	RotationOverlap  time.Duration `yaml:"rotation_overlap" env:"JWT_KEY_ROTATION_OVERLAP" usage:"how long a retired key is still published for verification"`
+	// AllowUnencryptedKeys lets new keys be stored as plain PEM when there is no encryption key,
+	// anyone who can read the database can then sign tokens
+	AllowUnencryptedKeys bool `yaml:"allow_unencrypted_keys" env:"JWT_ALLOW_UNENCRYPTED_KEYS" usage:"store signing keys unencrypted when mfa.encryption_key is not set"`
+}
+
+type MailConfig struct {
+	Driver       string `yaml:"driver" env:"MAIL_DRIVER" usage:"how mail is delivered: smtp or log"`
+	From         string `yaml:"from" env:"MAIL_FROM" usage:"sender address of outgoing mail"`
+	LogFile      string `yaml:"log_file" env:"MAIL_LOG_FILE" usage:"file the log driver writes mail to, stdout when empty"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST" usage:"SMTP server host"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT" usage:"SMTP server port"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME" usage:"SMTP user"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" usage:"SMTP password"`
+}
+
+type RateLimitConfig struct {
+	// Driver is "memory" for a single instance or "database" to share limits between replicas
+	Driver string `yaml:"driver" env:"RATE_LIMIT_DRIVER" usage:"where rate limit counters are kept: memory or database"`
+}
+
+type LockoutConfig struct {
+	Threshold    int           `yaml:"threshold" env:"LOGIN_LOCKOUT_THRESHOLD" usage:"failed logins before an account is locked, 0 disables locking"`
+	Duration     time.Duration `yaml:"duration" env:"LOGIN_LOCKOUT_DURATION" usage:"how long a locked account stays locked"`
+	BackoffAfter int           `yaml:"backoff_after" env:"LOGIN_BACKOFF_AFTER" usage:"failed logins before further attempts are slowed down, 0 disables backoff"`
+	MaxBackoff   time.Duration `yaml:"max_backoff" env:"LOGIN_MAX_BACKOFF" usage:"longest wait between two login attempts"`
+	// WebhookURL is posted to whenever an account gets locked
+	WebhookURL string `yaml:"webhook_url" env:"LOCKOUT_WEBHOOK_URL" usage:"URL notified whenever an account gets locked"`
+}
+
+type MFAConfig struct {
+	// EncryptionKey encrypts TOTP secrets and signing keys at rest, MFA enrolment is unavailable without it
+	EncryptionKey string `yaml:"encryption_key" env:"MFA_ENCRYPTION_KEY" usage:"base64 encoded 32 byte key encrypting TOTP secrets and signing keys"`
+}
+
+// SameSiteMode returns the SameSite attribute as understood by net/http
+func (c CookieConfig) SameSiteMode() http.SameSite {
+	switch c.SameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
 	}
+	return http.SameSiteLaxMode
+}
 
-	return scanner.Err()
+// Key returns the decoded encryption key, or nil when none is configured
+func (c MFAConfig) Key() []byte {
+	key, err := base64.StdEncoding.DecodeString(c.EncryptionKey)
+	if err != nil || len(key) == 0 {
+		return nil
+	}
+	return key
 }
 
-func LoadConfig() (*Config, error) {
+// Default returns the configuration used for every setting that isn't set elsewhere
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:        ":8080",
+			Issuer:      "http://localhost:8080",
+			CORSOrigins: []string{"http://localhost:3000"},
+		},
+		Database: DatabaseConfig{
+			Driver: "mysql",
+			Host:   "localhost",
+			User:   "root",
+			Name:   "auth",
+			Path:   "auth.db",
+		},
+		Session: SessionConfig{
+			Lifetime:                  24 * time.Hour,
+			BackchannelLogoutAttempts: 3,
+			BackchannelLogoutTimeout:  5 * time.Second,
+		},
+		Cookie: CookieConfig{
+			Secure:   true,
+			SameSite: "lax",
+		},
+		Tokens: TokenConfig{
+			AccessLifetime:            24 * time.Hour,
+			IDLifetime:                time.Hour,
+			RefreshLifetime:           30 * 24 * time.Hour,
+			EmailVerificationLifetime: 24 * time.Hour,
+			PasswordResetLifetime:     time.Hour,
+		},
+		Signing: SigningConfig{
+			Algorithm:        "RS256",
+			RotationInterval: 30 * 24 * time.Hour,
+			RotationOverlap:  48 * time.Hour,
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "no-reply@localhost",
+			SMTPPort: "587",
+		},
+		RateLimit: RateLimitConfig{
+			Driver: "memory",
+		},
+		Lockout: LockoutConfig{
+			Threshold:    10,
+			Duration:     15 * time.Minute,
+			BackoffAfter: 3,
+			MaxBackoff:   time.Minute,
+		},
+	}
+}
+
+// LoadConfig builds the configuration from all sources and validates it.
+// args are the command line arguments without the program name, the
+// arguments left after the flags are returned.
+func LoadConfig(args []string) (*Config, []string, error) {
 	// Try to load .env file, but don't return error if file doesn't exist
 	_ = loadEnvFile()
 
-	config := &Config{
-		DBHost:     getEnvOrDefault("DB_HOST", "localhost"),
-		DBPort:     getEnvOrDefault("DB_PORT", "3306"),
-		DBUser:     getEnvOrDefault("DB_USER", "root"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		DBName:     getEnvOrDefault("DB_NAME", "auth"),
+	config := Default()
+	settings := config.settings()
+
+	fs := flag.NewFlagSet("auth_go", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to a YAML or JSON config file ($CONFIG_FILE)")
+
+	// Flags are collected first so the file and environment can be applied beneath them
+	type flagValue struct {
+		setting setting
+		value   string
+	}
+	var flagValues []flagValue
+	for _, s := range settings {
+		fs.Func(s.path, fmt.Sprintf("%s ($%s)", s.usage, s.env), func(value string) error {
+			flagValues = append(flagValues, flagValue{s, value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
 	}
 
-	// Validate required fields
-	if config.DBPassword == "" {
-		return nil, fmt.Errorf("DB_PASSWORD environment variable is required")
+	path := *configFile
+	if path == "" {
+		var err error
+		if path, _, err = lookupEnv("CONFIG_FILE"); err != nil {
+			return nil, nil, err
+		}
+	}
+	if path != "" {
+		if err := loadFile(config, path); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return config, nil
+	var errs []error
+	for _, s := range settings {
+		value, from, err := lookupEnv(s.env)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if from == "" {
+			continue
+		}
+		if err := s.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", from, err))
+		}
+	}
+	for _, f := range flagValues {
+		if err := f.setting.set(f.value); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %v", f.setting.path, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return config, fs.Args(), nil
 }
 
-func (c *Config) GetDSN() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
-		c.DBUser, c.DBPassword, c.DBHost, c.DBPort, c.DBName)
+// Dialect returns the SQL dialect of the configured driver
+func (c DatabaseConfig) Dialect() dbcommon.Dialect {
+	return dbcommon.Dialect(c.Driver)
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// GetDSN returns the connection string for the configured driver
+func (c *Config) GetDSN() string {
+	d := c.Database
+	if d.DSN != "" {
+		return d.DSN
+	}
+
+	switch d.Dialect() {
+	case dbcommon.Postgres:
+		u := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(d.User, d.Password),
+			Host:   net.JoinHostPort(d.Host, cmp.Or(d.Port, "5432")),
+			Path:   "/" + d.Name,
+		}
+		return u.String()
+
+	case dbcommon.SQLite:
+		return "file:" + d.Path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
 	}
-	return defaultValue
+
+	mysqlConfig := mysql.NewConfig()
+	mysqlConfig.User = d.User
+	mysqlConfig.Passwd = d.Password
+	mysqlConfig.Net = "tcp"
+	mysqlConfig.Addr = net.JoinHostPort(d.Host, cmp.Or(d.Port, "3306"))
+	mysqlConfig.DBName = d.Name
+	mysqlConfig.ParseTime = true
+	// Times are stored in UTC, CURRENT_TIMESTAMP has to agree with the times the driver sends
+	mysqlConfig.Params = map[string]string{"time_zone": "'+00:00'"}
+	return mysqlConfig.FormatDSN()
 }
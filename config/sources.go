@@ -0,0 +1,158 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a single configurable value, found by walking the Config struct
+type setting struct {
+	// path is the dotted yaml path, which is also the flag name
+	path  string
+	env   string
+	usage string
+	value reflect.Value
+}
+
+// settings lists every leaf field of the config
+func (c *Config) settings() []setting {
+	return collectSettings(reflect.ValueOf(c).Elem(), "")
+}
+
+func collectSettings(v reflect.Value, prefix string) []setting {
+	var settings []setting
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		path := prefix + field.Tag.Get("yaml")
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			settings = append(settings, collectSettings(v.Field(i), path+".")...)
+			continue
+		}
+		settings = append(settings, setting{
+			path:  path,
+			env:   field.Tag.Get("env"),
+			usage: field.Tag.Get("usage"),
+			value: v.Field(i),
+		})
+	}
+	return settings
+}
+
+// set parses a value given as text, from the environment or a flag
+func (s setting) set(value string) error {
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(value)
+	case []string:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		s.value.Set(reflect.ValueOf(items))
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean, expected true or false", value)
+		}
+		s.value.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		s.value.SetInt(int64(n))
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 15m or 720h", value)
+		}
+		s.value.SetInt(int64(d))
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+// lookupEnv returns the value of an environment variable, or of the file named
+// by <key>_FILE. from names where the value came from and is empty if neither is set.
+func lookupEnv(key string) (value, from string, err error) {
+	value, inline := os.LookupEnv(key)
+	path, fromFile := os.LookupEnv(key + "_FILE")
+	inline = inline && value != ""
+	fromFile = fromFile && path != ""
+
+	switch {
+	case inline && fromFile:
+		return "", "", fmt.Errorf("both %s and %s_FILE are set, use only one", key, key)
+	case fromFile:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("%s_FILE: %v", key, err)
+		}
+		// Secrets written by editors or echo usually end in a newline
+		return strings.TrimRight(string(content), "\r\n"), key + "_FILE", nil
+	case inline:
+		return value, key, nil
+	}
+	return "", "", nil
+}
+
+// loadFile reads a YAML or JSON config file on top of the current values.
+// JSON is valid YAML, so both go through the same decoder.
+func loadFile(c *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %v", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	// Misspelled keys would otherwise be silently ignored
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+	return nil
+}
+
+func loadEnvFile() error {
+	file, err := os.Open(".env")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		// Only set if not already set (Docker env vars take precedence)
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+
+	return scanner.Err()
+}
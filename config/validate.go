@@ -0,0 +1,166 @@
+package config
+
+import (
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSessionKeyLength is the shortest accepted session key, 256 bits
+const minSessionKeyLength = 32
+
+// problems collects every invalid setting so they can all be reported at once
+type problems struct {
+	envs map[string]string
+	errs []error
+}
+
+// add records a problem with the setting at path, naming its environment variable too
+func (p *problems) add(path, format string, args ...any) {
+	name := path
+	if env := p.envs[path]; env != "" {
+		name = fmt.Sprintf("%s (%s)", path, env)
+	}
+	p.errs = append(p.errs, fmt.Errorf("%s %s", name, fmt.Sprintf(format, args...)))
+}
+
+// Validate checks the configuration and returns an error describing every invalid setting
+func (c *Config) Validate() error {
+	p := &problems{envs: map[string]string{}}
+	for _, s := range c.settings() {
+		p.envs[s.path] = s.env
+	}
+
+	if c.Server.Addr == "" {
+		p.add("server.addr", "is required, e.g. :8080")
+	}
+	if u, err := url.Parse(c.Server.Issuer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		p.add("server.issuer", "must be an absolute http(s) URL without query or fragment, got %q", c.Server.Issuer)
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		// Credentials are allowed, which browsers refuse together with a wildcard
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+			p.add("server.cors_origins", "must only contain origins such as https://app.example.com, got %q", origin)
+		}
+	}
+
+	dialect, err := dbcommon.ParseDialect(c.Database.Driver)
+	if err != nil {
+		p.add("database.driver", "must be mysql, postgres or sqlite, got %q", c.Database.Driver)
+	}
+	if c.Database.DSN == "" {
+		switch dialect {
+		case dbcommon.MySQL, dbcommon.Postgres:
+			if c.Database.Password == "" {
+				p.add("database.password", "is required for %s", dialect)
+			}
+			if _, err := strconv.Atoi(c.Database.Port); c.Database.Port != "" && err != nil {
+				p.add("database.port", "must be a port number, got %q", c.Database.Port)
+			}
+		case dbcommon.SQLite:
+			if c.Database.Path == "" {
+				p.add("database.path", "is required for sqlite")
+			}
+		}
+	}
+
+	if c.Session.Key == "" {
+		p.add("session.key", "is required, generate one with openssl rand -base64 32")
+	} else if len(c.Session.Key) < minSessionKeyLength {
+		p.add("session.key", "must be at least %d bytes long", minSessionKeyLength)
+	}
+
+	if c.Session.BackchannelLogoutAttempts < 1 {
+		p.add("session.backchannel_logout_attempts", "must be at least 1")
+	}
+
+	switch c.Cookie.SameSite {
+	case "lax", "strict":
+	case "none":
+		if !c.Cookie.Secure {
+			p.add("cookie.same_site", "can only be none when cookie.secure is true, browsers reject it otherwise")
+		}
+	default:
+		p.add("cookie.same_site", "must be lax, strict or none, got %q", c.Cookie.SameSite)
+	}
+
+	for _, d := range []struct {
+		path  string
+		value time.Duration
+	}{
+		{"session.lifetime", c.Session.Lifetime},
+		{"session.backchannel_logout_timeout", c.Session.BackchannelLogoutTimeout},
+		{"tokens.access_lifetime", c.Tokens.AccessLifetime},
+		{"tokens.id_lifetime", c.Tokens.IDLifetime},
+		{"tokens.refresh_lifetime", c.Tokens.RefreshLifetime},
+		{"tokens.email_verification_lifetime", c.Tokens.EmailVerificationLifetime},
+		{"tokens.password_reset_lifetime", c.Tokens.PasswordResetLifetime},
+		{"signing.rotation_interval", c.Signing.RotationInterval},
+	} {
+		if d.value <= 0 {
+			p.add(d.path, "must be positive, got %v", d.value)
+		}
+	}
+
+	if !slices.Contains(utils.SupportedSigningAlgorithms, c.Signing.Algorithm) {
+		p.add("signing.algorithm", "must be one of %v, got %q", utils.SupportedSigningAlgorithms, c.Signing.Algorithm)
+	}
+	// Tokens signed just before a rotation have to stay verifiable until they expire
+	if c.Signing.RotationOverlap < c.Tokens.AccessLifetime {
+		p.add("signing.rotation_overlap", "must be at least tokens.access_lifetime (%v), got %v", c.Tokens.AccessLifetime, c.Signing.RotationOverlap)
+	}
+
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			p.add("mail.smtp_host", "is required when mail.driver is smtp")
+		}
+	default:
+		p.add("mail.driver", "must be smtp or log, got %q", c.Mail.Driver)
+	}
+
+	if c.RateLimit.Driver != "memory" && c.RateLimit.Driver != "database" {
+		p.add("rate_limit.driver", "must be memory or database, got %q", c.RateLimit.Driver)
+	}
+
+	if c.Lockout.Threshold < 0 {
+		p.add("lockout.threshold", "must not be negative")
+	}
+	if c.Lockout.BackoffAfter < 0 {
+		p.add("lockout.backoff_after", "must not be negative")
+	}
+	if c.Lockout.Threshold > 0 && c.Lockout.Duration <= 0 {
+		p.add("lockout.duration", "must be positive when lockout.threshold is set")
+	}
+	if c.Lockout.BackoffAfter > 0 && c.Lockout.MaxBackoff <= 0 {
+		p.add("lockout.max_backoff", "must be positive when lockout.backoff_after is set")
+	}
+	if c.Lockout.WebhookURL != "" {
+		if u, err := url.Parse(c.Lockout.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.add("lockout.webhook_url", "must be an absolute http(s) URL")
+		}
+	}
+
+	if c.MFA.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.MFA.EncryptionKey)
+		if err != nil || len(key) != 32 {
+			p.add("mfa.encryption_key", "must be 32 bytes encoded as base64, e.g. from openssl rand -base64 32")
+		}
+	} else if !c.Signing.AllowUnencryptedKeys {
+		// Signing keys are encrypted with it, storing them in the clear has to be asked for
+		p.add("mfa.encryption_key", "is required to encrypt signing keys, or set signing.allow_unencrypted_keys to store them unencrypted")
+	}
+
+	if len(p.errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(p.errs...))
+	}
+	return nil
+}
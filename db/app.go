@@ -1,15 +1,11 @@
 package db
 
-import (
-	"auth_go/dbcommon"
-)
-
 type Db struct {
-	Queries *dbcommon.Queries
+	Queries Store
 }
 
-func NewDb(queries *dbcommon.Queries) *Db {
+func NewDb(store Store) *Db {
 	return &Db{
-		Queries: queries,
+		Queries: store,
 	}
 }
@@ -0,0 +1,1155 @@
+package db
+
+import (
+	"auth_go/dbcommon"
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var errDuplicate = errors.New("duplicate entry")
+
+// MemoryStore keeps everything in memory, it is meant for tests and trying the service out
+// without a database. It follows the semantics of the SQL queries, including their unique
+// constraints and the row counts they report, so handlers behave as they do against MySQL.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	lastID              int64
+	clients             []dbcommon.Client
+	redirectURIs        []dbcommon.ClientRedirectUri
+	users               []dbcommon.User
+	sessions            []dbcommon.Session
+	ssoSessions         []dbcommon.SsoSession
+	ssoSessionClients   []dbcommon.SsoSessionClient
+	consents            []dbcommon.Consent
+	refreshTokens       []dbcommon.RefreshToken
+	revokedTokens       []dbcommon.RevokedToken
+	accessTokens        []dbcommon.AccessToken
+	passwordResetTokens []dbcommon.PasswordResetToken
+	signingKeys         []dbcommon.SigningKey
+	totpCredentials     []dbcommon.TotpCredential
+	recoveryCodes       []dbcommon.RecoveryCode
+	webauthnChallenges  []dbcommon.WebauthnChallenge
+	webauthnCredentials []dbcommon.WebauthnCredential
+	rateLimitCounters   []dbcommon.RateLimitCounter
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// nextID hands out ids like AUTO_INCREMENT, callers must hold mu
+func (m *MemoryStore) nextID() int64 {
+	m.lastID++
+	return m.lastID
+}
+
+// find returns the first row matching, or nil
+func find[T any](rows []T, match func(*T) bool) *T {
+	for i := range rows {
+		if match(&rows[i]) {
+			return &rows[i]
+		}
+	}
+	return nil
+}
+
+// update applies change to every row matching and returns how many there were
+func update[T any](rows []T, match func(*T) bool, change func(*T)) int64 {
+	var n int64
+	for i := range rows {
+		if match(&rows[i]) {
+			change(&rows[i])
+			n++
+		}
+	}
+	return n
+}
+
+// remove deletes every row matching and returns how many there were
+func remove[T any](rows *[]T, match func(*T) bool) int64 {
+	n := len(*rows)
+	*rows = slices.DeleteFunc(*rows, func(row T) bool { return match(&row) })
+	return int64(n - len(*rows))
+}
+
+// one returns the row found or sql.ErrNoRows like a :one query
+func one[T any](row *T) (T, error) {
+	if row == nil {
+		var zero T
+		return zero, sql.ErrNoRows
+	}
+	return *row, nil
+}
+
+// before compares a nullable column with < the way SQL does, NULL never matches
+func before(column sql.NullTime, t sql.NullTime) bool {
+	return column.Valid && t.Valid && column.Time.Before(t.Time)
+}
+
+func validTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: true}
+}
+
+func (m *MemoryStore) CreateUser(ctx context.Context, arg dbcommon.CreateUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.users, func(u *dbcommon.User) bool {
+		return u.Uuid == arg.Uuid || (u.NamespaceID == arg.NamespaceID && u.Email == arg.Email)
+	}) != nil {
+		return fmt.Errorf("user %s: %w", arg.Email, errDuplicate)
+	}
+
+	m.users = append(m.users, dbcommon.User{
+		ID:          m.nextID(),
+		Uuid:        arg.Uuid,
+		NamespaceID: arg.NamespaceID,
+		Email:       arg.Email,
+		Firstname:   arg.Firstname,
+		Lastname:    arg.Lastname,
+		Password:    arg.Password,
+	})
+	return nil
+}
+
+func (m *MemoryStore) ListUsers(ctx context.Context, namespaceID int64) ([]dbcommon.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []dbcommon.User
+	for _, user := range m.users {
+		if user.NamespaceID == namespaceID {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (m *MemoryStore) GetUserByEmail(ctx context.Context, arg dbcommon.GetUserByEmailParams) (dbcommon.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.users, func(u *dbcommon.User) bool {
+		return u.NamespaceID == arg.NamespaceID && u.Email == arg.Email
+	}))
+}
+
+func (m *MemoryStore) GetUserByID(ctx context.Context, id int64) (dbcommon.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.users, func(u *dbcommon.User) bool { return u.ID == id }))
+}
+
+func (m *MemoryStore) GetUserByUUID(ctx context.Context, uuid string) (dbcommon.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.users, func(u *dbcommon.User) bool { return u.Uuid == uuid }))
+}
+
+func (m *MemoryStore) UpdateUserPassword(ctx context.Context, arg dbcommon.UpdateUserPasswordParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.users, func(u *dbcommon.User) bool { return u.ID == arg.ID }, func(u *dbcommon.User) {
+		u.Password = arg.Password
+	})
+	return nil
+}
+
+func (m *MemoryStore) SetUserEmailVerified(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.users, func(u *dbcommon.User) bool { return u.ID == id }, func(u *dbcommon.User) {
+		u.EmailVerified = true
+	})
+	return nil
+}
+
+func (m *MemoryStore) MarkVerificationSent(ctx context.Context, arg dbcommon.MarkVerificationSentParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return update(m.users, func(u *dbcommon.User) bool {
+		return u.ID == arg.ID && (!u.VerificationSentAt.Valid || before(u.VerificationSentAt, arg.VerificationSentAt))
+	}, func(u *dbcommon.User) {
+		u.VerificationSentAt = validTime(time.Now())
+	}), nil
+}
+
+func (m *MemoryStore) RecordFailedLogin(ctx context.Context, arg dbcommon.RecordFailedLoginParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.users, func(u *dbcommon.User) bool { return u.ID == arg.ID }, func(u *dbcommon.User) {
+		u.FailedLoginAttempts++
+		u.LastFailedLoginAt = arg.LastFailedLoginAt
+	})
+	return nil
+}
+
+func (m *MemoryStore) LockUser(ctx context.Context, arg dbcommon.LockUserParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return update(m.users, func(u *dbcommon.User) bool {
+		return u.ID == arg.ID && (!u.LockedUntil.Valid || before(u.LockedUntil, arg.LockedUntil_2))
+	}, func(u *dbcommon.User) {
+		u.LockedUntil = arg.LockedUntil
+		u.FailedLoginAttempts = 0
+	}), nil
+}
+
+func (m *MemoryStore) UnlockUser(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.users, func(u *dbcommon.User) bool { return u.ID == id }, func(u *dbcommon.User) {
+		u.FailedLoginAttempts = 0
+		u.LastFailedLoginAt = sql.NullTime{}
+		u.LockedUntil = sql.NullTime{}
+	})
+	return nil
+}
+
+func (m *MemoryStore) DisableUser(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.users, func(u *dbcommon.User) bool { return u.ID == id && !u.DisabledAt.Valid }, func(u *dbcommon.User) {
+		u.DisabledAt = validTime(time.Now())
+	})
+	return nil
+}
+
+func (m *MemoryStore) EnableUser(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.users, func(u *dbcommon.User) bool { return u.ID == id }, func(u *dbcommon.User) {
+		u.DisabledAt = sql.NullTime{}
+	})
+	return nil
+}
+
+func (m *MemoryStore) CreateClient(ctx context.Context, arg dbcommon.CreateClientParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.clients, func(c *dbcommon.Client) bool { return c.Namespace == arg.Namespace }) != nil {
+		return fmt.Errorf("client %s: %w", arg.Namespace, errDuplicate)
+	}
+
+	m.clients = append(m.clients, dbcommon.Client{
+		ID:                       m.nextID(),
+		Namespace:                arg.Namespace,
+		Name:                     arg.Name,
+		ClientSecret:             arg.ClientSecret,
+		AllowedScopes:            arg.AllowedScopes,
+		UserPool:                 arg.UserPool,
+		RequireEmailVerification: arg.RequireEmailVerification,
+		CreatedAt:                time.Now(),
+		BackchannelLogoutUri:     arg.BackchannelLogoutUri,
+		FrontchannelLogoutUri:    arg.FrontchannelLogoutUri,
+	})
+	return nil
+}
+
+func (m *MemoryStore) ListClients(ctx context.Context) ([]dbcommon.Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.clients), nil
+}
+
+func (m *MemoryStore) UpdateClient(ctx context.Context, arg dbcommon.UpdateClientParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.clients, func(c *dbcommon.Client) bool { return c.ID == arg.ID }, func(c *dbcommon.Client) {
+		c.Name = arg.Name
+		c.ClientSecret = arg.ClientSecret
+		c.AllowedScopes = arg.AllowedScopes
+		c.UserPool = arg.UserPool
+		c.RequireEmailVerification = arg.RequireEmailVerification
+		c.BackchannelLogoutUri = arg.BackchannelLogoutUri
+		c.FrontchannelLogoutUri = arg.FrontchannelLogoutUri
+	})
+	return nil
+}
+
+// DeleteClient follows the foreign keys of the schema: redirect URIs, consents and SSO session
+// links go with the client, sessions and refresh tokens have to be deleted first
+func (m *MemoryStore) DeleteClient(ctx context.Context, id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.sessions, func(s *dbcommon.Session) bool { return s.ClientID == id }) != nil ||
+		find(m.refreshTokens, func(t *dbcommon.RefreshToken) bool { return t.ClientID == id }) != nil {
+		return 0, fmt.Errorf("client %d is still referenced by sessions or refresh tokens", id)
+	}
+
+	remove(&m.redirectURIs, func(u *dbcommon.ClientRedirectUri) bool { return u.ClientID == id })
+	remove(&m.consents, func(c *dbcommon.Consent) bool { return c.ClientID == id })
+	remove(&m.ssoSessionClients, func(c *dbcommon.SsoSessionClient) bool { return c.ClientID == id })
+	return remove(&m.clients, func(c *dbcommon.Client) bool { return c.ID == id }), nil
+}
+
+func (m *MemoryStore) GetClientByID(ctx context.Context, id int64) (dbcommon.Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.clients, func(c *dbcommon.Client) bool { return c.ID == id }))
+}
+
+func (m *MemoryStore) GetClientByNamespace(ctx context.Context, namespace string) (dbcommon.Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.clients, func(c *dbcommon.Client) bool { return c.Namespace == namespace }))
+}
+
+func (m *MemoryStore) ListClientRedirectURIs(ctx context.Context, clientID int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var uris []string
+	for _, uri := range m.redirectURIs {
+		if uri.ClientID == clientID {
+			uris = append(uris, uri.RedirectUri)
+		}
+	}
+	return uris, nil
+}
+
+func (m *MemoryStore) CreateClientRedirectURI(ctx context.Context, arg dbcommon.CreateClientRedirectURIParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.redirectURIs, func(u *dbcommon.ClientRedirectUri) bool {
+		return u.ClientID == arg.ClientID && u.RedirectUri == arg.RedirectUri
+	}) != nil {
+		return fmt.Errorf("redirect uri %s: %w", arg.RedirectUri, errDuplicate)
+	}
+
+	m.redirectURIs = append(m.redirectURIs, dbcommon.ClientRedirectUri{
+		ID:          m.nextID(),
+		ClientID:    arg.ClientID,
+		RedirectUri: arg.RedirectUri,
+		CreatedAt:   time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) DeleteClientRedirectURIs(ctx context.Context, clientID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove(&m.redirectURIs, func(u *dbcommon.ClientRedirectUri) bool { return u.ClientID == clientID })
+	return nil
+}
+
+func (m *MemoryStore) CreateAuthorizeSession(ctx context.Context, arg dbcommon.CreateAuthorizeSessionParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.sessions, func(s *dbcommon.Session) bool {
+		return s.AuthCode == arg.AuthCode || bytes.Equal(s.SessionID, arg.SessionID)
+	}) != nil {
+		return fmt.Errorf("session: %w", errDuplicate)
+	}
+
+	m.sessions = append(m.sessions, dbcommon.Session{
+		ID:                  m.nextID(),
+		SessionID:           arg.SessionID,
+		AuthCode:            arg.AuthCode,
+		ClientID:            arg.ClientID,
+		PkceChallenge:       arg.PkceChallenge,
+		PkceChallengeMethod: arg.PkceChallengeMethod,
+		State:               arg.State,
+		RedirectUri:         arg.RedirectUri,
+		Scope:               arg.Scope,
+		Nonce:               arg.Nonce,
+		Prompt:              arg.Prompt,
+		LoginHint:           arg.LoginHint,
+		ExpiresAt:           arg.ExpiresAt,
+		CreatedAt:           validTime(time.Now()),
+	})
+	return nil
+}
+
+func (m *MemoryStore) GetSessionByAuthCode(ctx context.Context, authCode string) (dbcommon.GetSessionByAuthCodeRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := find(m.sessions, func(s *dbcommon.Session) bool { return s.AuthCode == authCode })
+	if s == nil {
+		return dbcommon.GetSessionByAuthCodeRow{}, sql.ErrNoRows
+	}
+
+	row := dbcommon.GetSessionByAuthCodeRow{
+		ID:                  s.ID,
+		SessionID:           s.SessionID,
+		UserID:              s.UserID,
+		AuthCode:            s.AuthCode,
+		ClientID:            s.ClientID,
+		PkceChallenge:       s.PkceChallenge,
+		PkceChallengeMethod: s.PkceChallengeMethod,
+		State:               s.State,
+		RedirectUri:         s.RedirectUri,
+		Scope:               s.Scope,
+		Nonce:               s.Nonce,
+		AuthTime:            s.AuthTime,
+		MfaUserID:           s.MfaUserID,
+		Amr:                 s.Amr,
+		Prompt:              s.Prompt,
+		LoginHint:           s.LoginHint,
+		SsoSessionID:        s.SsoSessionID,
+		CreatedAt:           s.CreatedAt,
+		ExpiresAt:           s.ExpiresAt,
+	}
+	// LEFT JOIN users
+	if u := find(m.users, func(u *dbcommon.User) bool { return s.UserID.Valid && u.ID == s.UserID.Int64 }); u != nil {
+		row.UserEmail = sql.NullString{String: u.Email, Valid: true}
+	}
+	return row, nil
+}
+
+func (m *MemoryStore) GetUserByAuthCode(ctx context.Context, authCode string) (dbcommon.GetUserByAuthCodeRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := find(m.sessions, func(s *dbcommon.Session) bool { return s.AuthCode == authCode })
+	if s == nil || !s.UserID.Valid {
+		return dbcommon.GetUserByAuthCodeRow{}, sql.ErrNoRows
+	}
+	u := find(m.users, func(u *dbcommon.User) bool { return u.ID == s.UserID.Int64 })
+	if u == nil {
+		return dbcommon.GetUserByAuthCodeRow{}, sql.ErrNoRows
+	}
+	return dbcommon.GetUserByAuthCodeRow{ID: u.ID, Email: u.Email, Password: u.Password}, nil
+}
+
+func (m *MemoryStore) SetSessionMFAPending(ctx context.Context, arg dbcommon.SetSessionMFAPendingParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.sessions, func(s *dbcommon.Session) bool { return s.AuthCode == arg.AuthCode }, func(s *dbcommon.Session) {
+		s.MfaUserID = arg.MfaUserID
+	})
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserSession(ctx context.Context, arg dbcommon.UpdateUserSessionParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.sessions, func(s *dbcommon.Session) bool { return s.AuthCode == arg.AuthCode }, func(s *dbcommon.Session) {
+		s.UserID = arg.UserID
+		s.Amr = arg.Amr
+		s.MfaUserID = sql.NullInt64{}
+		s.AuthTime = arg.AuthTime
+		s.SsoSessionID = arg.SsoSessionID
+	})
+	return nil
+}
+
+func (m *MemoryStore) ClearSessionPrompt(ctx context.Context, authCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.sessions, func(s *dbcommon.Session) bool { return s.AuthCode == authCode }, func(s *dbcommon.Session) {
+		s.Prompt = ""
+	})
+	return nil
+}
+
+func (m *MemoryStore) DeleteSession(ctx context.Context, authCode string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return remove(&m.sessions, func(s *dbcommon.Session) bool { return s.AuthCode == authCode }), nil
+}
+
+func (m *MemoryStore) DeleteUserSessionsByUserID(ctx context.Context, userID sql.NullInt64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove(&m.sessions, func(s *dbcommon.Session) bool {
+		return userID.Valid && s.UserID.Valid && s.UserID.Int64 == userID.Int64
+	})
+	return nil
+}
+
+func (m *MemoryStore) DeleteClientSessions(ctx context.Context, clientID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove(&m.sessions, func(s *dbcommon.Session) bool { return s.ClientID == clientID })
+	return nil
+}
+
+func (m *MemoryStore) CreateSSOSession(ctx context.Context, arg dbcommon.CreateSSOSessionParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.ssoSessions, func(s *dbcommon.SsoSession) bool { return s.TokenHash == arg.TokenHash }) != nil {
+		return fmt.Errorf("sso session: %w", errDuplicate)
+	}
+
+	m.ssoSessions = append(m.ssoSessions, dbcommon.SsoSession{
+		ID:        m.nextID(),
+		UserID:    arg.UserID,
+		TokenHash: arg.TokenHash,
+		Amr:       arg.Amr,
+		AuthTime:  arg.AuthTime,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: time.Now(),
+		Sid:       arg.Sid,
+	})
+	return nil
+}
+
+func (m *MemoryStore) GetSSOSessionByHash(ctx context.Context, tokenHash string) (dbcommon.SsoSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.ssoSessions, func(s *dbcommon.SsoSession) bool { return s.TokenHash == tokenHash }))
+}
+
+func (m *MemoryStore) GetSSOSessionByID(ctx context.Context, id int64) (dbcommon.SsoSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.ssoSessions, func(s *dbcommon.SsoSession) bool { return s.ID == id }))
+}
+
+func (m *MemoryStore) AddSSOSessionClient(ctx context.Context, arg dbcommon.AddSSOSessionClientParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.ssoSessions, func(s *dbcommon.SsoSession) bool { return s.ID == arg.SsoSessionID }) == nil ||
+		find(m.clients, func(c *dbcommon.Client) bool { return c.ID == arg.ClientID }) == nil {
+		return fmt.Errorf("sso session %d or client %d does not exist", arg.SsoSessionID, arg.ClientID)
+	}
+
+	// INSERT IGNORE, a client is listed once however many times it gets tokens
+	if find(m.ssoSessionClients, func(c *dbcommon.SsoSessionClient) bool {
+		return c.SsoSessionID == arg.SsoSessionID && c.ClientID == arg.ClientID
+	}) != nil {
+		return nil
+	}
+	m.ssoSessionClients = append(m.ssoSessionClients, dbcommon.SsoSessionClient{
+		SsoSessionID: arg.SsoSessionID,
+		ClientID:     arg.ClientID,
+		CreatedAt:    time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) ListSSOSessionClients(ctx context.Context, ssoSessionID int64) ([]dbcommon.Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var clients []dbcommon.Client
+	for _, client := range m.clients {
+		if find(m.ssoSessionClients, func(c *dbcommon.SsoSessionClient) bool {
+			return c.SsoSessionID == ssoSessionID && c.ClientID == client.ID
+		}) != nil {
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
+
+func (m *MemoryStore) DeleteSSOSession(ctx context.Context, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeSSOSessions(func(s *dbcommon.SsoSession) bool { return s.TokenHash == tokenHash })
+	return nil
+}
+
+func (m *MemoryStore) DeleteSSOSessionsByUserID(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeSSOSessions(func(s *dbcommon.SsoSession) bool { return s.UserID == userID })
+	return nil
+}
+
+func (m *MemoryStore) DeleteExpiredSSOSessions(ctx context.Context, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeSSOSessions(func(s *dbcommon.SsoSession) bool { return s.ExpiresAt.Before(expiresAt) })
+	return nil
+}
+
+// removeSSOSessions deletes the matching SSO sessions along with their clients, like the
+// ON DELETE CASCADE of sso_session_clients
+func (m *MemoryStore) removeSSOSessions(match func(*dbcommon.SsoSession) bool) {
+	for _, session := range m.ssoSessions {
+		if match(&session) {
+			remove(&m.ssoSessionClients, func(c *dbcommon.SsoSessionClient) bool { return c.SsoSessionID == session.ID })
+		}
+	}
+	remove(&m.ssoSessions, match)
+}
+
+func (m *MemoryStore) GetConsent(ctx context.Context, arg dbcommon.GetConsentParams) (dbcommon.Consent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.consents, func(c *dbcommon.Consent) bool {
+		return c.UserID == arg.UserID && c.ClientID == arg.ClientID
+	}))
+}
+
+func (m *MemoryStore) UpsertConsent(ctx context.Context, arg dbcommon.UpsertConsentParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if update(m.consents, func(c *dbcommon.Consent) bool {
+		return c.UserID == arg.UserID && c.ClientID == arg.ClientID
+	}, func(c *dbcommon.Consent) {
+		c.Scope = arg.Scope
+		c.UpdatedAt = now
+	}) > 0 {
+		return nil
+	}
+
+	m.consents = append(m.consents, dbcommon.Consent{
+		ID:        m.nextID(),
+		UserID:    arg.UserID,
+		ClientID:  arg.ClientID,
+		Scope:     arg.Scope,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	return nil
+}
+
+func (m *MemoryStore) CreateRefreshToken(ctx context.Context, arg dbcommon.CreateRefreshTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.refreshTokens, func(t *dbcommon.RefreshToken) bool { return t.TokenHash == arg.TokenHash }) != nil {
+		return fmt.Errorf("refresh token: %w", errDuplicate)
+	}
+
+	m.refreshTokens = append(m.refreshTokens, dbcommon.RefreshToken{
+		ID:           m.nextID(),
+		TokenHash:    arg.TokenHash,
+		FamilyID:     arg.FamilyID,
+		UserID:       arg.UserID,
+		ClientID:     arg.ClientID,
+		Scope:        arg.Scope,
+		AuthTime:     arg.AuthTime,
+		Amr:          arg.Amr,
+		SsoSessionID: arg.SsoSessionID,
+		ExpiresAt:    arg.ExpiresAt,
+		CreatedAt:    validTime(time.Now()),
+	})
+	return nil
+}
+
+func (m *MemoryStore) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (dbcommon.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.refreshTokens, func(t *dbcommon.RefreshToken) bool { return t.TokenHash == tokenHash }))
+}
+
+func (m *MemoryStore) MarkRefreshTokenUsed(ctx context.Context, id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return update(m.refreshTokens, func(t *dbcommon.RefreshToken) bool {
+		return t.ID == id && !t.UsedAt.Valid
+	}, func(t *dbcommon.RefreshToken) {
+		t.UsedAt = validTime(time.Now())
+	}), nil
+}
+
+func (m *MemoryStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.refreshTokens, func(t *dbcommon.RefreshToken) bool {
+		return t.FamilyID == familyID && !t.RevokedAt.Valid
+	}, func(t *dbcommon.RefreshToken) {
+		t.RevokedAt = validTime(time.Now())
+	})
+	return nil
+}
+
+func (m *MemoryStore) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.refreshTokens, func(t *dbcommon.RefreshToken) bool {
+		return t.UserID == userID && !t.RevokedAt.Valid
+	}, func(t *dbcommon.RefreshToken) {
+		t.RevokedAt = validTime(time.Now())
+	})
+	return nil
+}
+
+func (m *MemoryStore) RevokeSSOSessionRefreshTokens(ctx context.Context, ssoSessionID sql.NullInt64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.refreshTokens, func(t *dbcommon.RefreshToken) bool {
+		return ssoSessionID.Valid && t.SsoSessionID == ssoSessionID && !t.RevokedAt.Valid
+	}, func(t *dbcommon.RefreshToken) {
+		t.RevokedAt = validTime(time.Now())
+	})
+	return nil
+}
+
+func (m *MemoryStore) DeleteClientRefreshTokens(ctx context.Context, clientID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove(&m.refreshTokens, func(t *dbcommon.RefreshToken) bool { return t.ClientID == clientID })
+	return nil
+}
+
+func (m *MemoryStore) RevokeToken(ctx context.Context, arg dbcommon.RevokeTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// INSERT IGNORE
+	if find(m.revokedTokens, func(t *dbcommon.RevokedToken) bool { return t.Jti == arg.Jti }) != nil {
+		return nil
+	}
+
+	m.revokedTokens = append(m.revokedTokens, dbcommon.RevokedToken{
+		ID:        m.nextID(),
+		Jti:       arg.Jti,
+		ExpiresAt: arg.ExpiresAt,
+		RevokedAt: time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) IsTokenRevoked(ctx context.Context, jti string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.revokedTokens, func(t *dbcommon.RevokedToken) bool { return t.Jti == jti }) != nil {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m *MemoryStore) DeleteExpiredRevokedTokens(ctx context.Context, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove(&m.revokedTokens, func(t *dbcommon.RevokedToken) bool { return t.ExpiresAt.Before(expiresAt) })
+	return nil
+}
+
+func (m *MemoryStore) CreateAccessToken(ctx context.Context, arg dbcommon.CreateAccessTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.accessTokens, func(t *dbcommon.AccessToken) bool { return t.Jti == arg.Jti }) != nil {
+		return fmt.Errorf("access token: %w", errDuplicate)
+	}
+
+	m.accessTokens = append(m.accessTokens, dbcommon.AccessToken{
+		ID:           m.nextID(),
+		Jti:          arg.Jti,
+		UserID:       arg.UserID,
+		SsoSessionID: arg.SsoSessionID,
+		ExpiresAt:    arg.ExpiresAt,
+		CreatedAt:    time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) ListSSOSessionAccessTokens(ctx context.Context, arg dbcommon.ListSSOSessionAccessTokensParams) ([]dbcommon.AccessToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokens []dbcommon.AccessToken
+	for _, token := range m.accessTokens {
+		if arg.SsoSessionID.Valid && token.SsoSessionID == arg.SsoSessionID && token.ExpiresAt.After(arg.ExpiresAt) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *MemoryStore) DeleteExpiredAccessTokens(ctx context.Context, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove(&m.accessTokens, func(t *dbcommon.AccessToken) bool { return t.ExpiresAt.Before(expiresAt) })
+	return nil
+}
+
+func (m *MemoryStore) CreatePasswordResetToken(ctx context.Context, arg dbcommon.CreatePasswordResetTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.passwordResetTokens, func(t *dbcommon.PasswordResetToken) bool { return t.TokenHash == arg.TokenHash }) != nil {
+		return fmt.Errorf("password reset token: %w", errDuplicate)
+	}
+
+	m.passwordResetTokens = append(m.passwordResetTokens, dbcommon.PasswordResetToken{
+		ID:        m.nextID(),
+		UserID:    arg.UserID,
+		TokenHash: arg.TokenHash,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) GetPasswordResetTokenByHash(ctx context.Context, tokenHash string) (dbcommon.PasswordResetToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.passwordResetTokens, func(t *dbcommon.PasswordResetToken) bool { return t.TokenHash == tokenHash }))
+}
+
+func (m *MemoryStore) MarkPasswordResetTokenUsed(ctx context.Context, id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return update(m.passwordResetTokens, func(t *dbcommon.PasswordResetToken) bool {
+		return t.ID == id && !t.UsedAt.Valid
+	}, func(t *dbcommon.PasswordResetToken) {
+		t.UsedAt = validTime(time.Now())
+	}), nil
+}
+
+func (m *MemoryStore) ReleasePasswordResetToken(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.passwordResetTokens, func(t *dbcommon.PasswordResetToken) bool { return t.ID == id }, func(t *dbcommon.PasswordResetToken) {
+		t.UsedAt = sql.NullTime{}
+	})
+	return nil
+}
+
+func (m *MemoryStore) DeletePasswordResetTokensByUserID(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove(&m.passwordResetTokens, func(t *dbcommon.PasswordResetToken) bool { return t.UserID == userID })
+	return nil
+}
+
+func (m *MemoryStore) CreateSigningKey(ctx context.Context, arg dbcommon.CreateSigningKeyParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.signingKeys, func(k *dbcommon.SigningKey) bool { return k.Kid == arg.Kid }) != nil {
+		return fmt.Errorf("signing key %s: %w", arg.Kid, errDuplicate)
+	}
+
+	m.signingKeys = append(m.signingKeys, dbcommon.SigningKey{
+		ID:         m.nextID(),
+		Kid:        arg.Kid,
+		Algorithm:  arg.Algorithm,
+		PrivateKey: arg.PrivateKey,
+		Status:     "active",
+		CreatedAt:  time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) ListPublishedSigningKeys(ctx context.Context) ([]dbcommon.SigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []dbcommon.SigningKey
+	for _, key := range m.signingKeys {
+		if key.Status == "active" || key.Status == "retiring" {
+			keys = append(keys, key)
+		}
+	}
+	// ORDER BY created_at DESC, id DESC
+	slices.SortFunc(keys, func(a, b dbcommon.SigningKey) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return keys, nil
+}
+
+func (m *MemoryStore) MarkSigningKeyRetiring(ctx context.Context, kid string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return update(m.signingKeys, func(k *dbcommon.SigningKey) bool {
+		return k.Kid == kid && k.Status == "active"
+	}, func(k *dbcommon.SigningKey) {
+		k.Status = "retiring"
+		k.RotatedAt = validTime(time.Now())
+	}), nil
+}
+
+func (m *MemoryStore) RetireSigningKeys(ctx context.Context, rotatedAt sql.NullTime) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.signingKeys, func(k *dbcommon.SigningKey) bool {
+		return k.Status == "retiring" && before(k.RotatedAt, rotatedAt)
+	}, func(k *dbcommon.SigningKey) {
+		k.Status = "retired"
+	})
+	return nil
+}
+
+func (m *MemoryStore) GetTOTPCredentialByUserID(ctx context.Context, userID int64) (dbcommon.TotpCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.totpCredentials, func(c *dbcommon.TotpCredential) bool { return c.UserID == userID }))
+}
+
+func (m *MemoryStore) UpsertTOTPCredential(ctx context.Context, arg dbcommon.UpsertTOTPCredentialParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if update(m.totpCredentials, func(c *dbcommon.TotpCredential) bool { return c.UserID == arg.UserID }, func(c *dbcommon.TotpCredential) {
+		c.Secret = arg.Secret
+		c.ConfirmedAt = sql.NullTime{}
+		c.LastUsedStep = 0
+	}) > 0 {
+		return nil
+	}
+
+	m.totpCredentials = append(m.totpCredentials, dbcommon.TotpCredential{
+		ID:        m.nextID(),
+		UserID:    arg.UserID,
+		Secret:    arg.Secret,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) ConfirmTOTPCredential(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.totpCredentials, func(c *dbcommon.TotpCredential) bool { return c.UserID == userID }, func(c *dbcommon.TotpCredential) {
+		c.ConfirmedAt = validTime(time.Now())
+	})
+	return nil
+}
+
+func (m *MemoryStore) UseTOTPStep(ctx context.Context, arg dbcommon.UseTOTPStepParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return update(m.totpCredentials, func(c *dbcommon.TotpCredential) bool {
+		return c.UserID == arg.UserID && c.LastUsedStep < arg.LastUsedStep_2
+	}, func(c *dbcommon.TotpCredential) {
+		c.LastUsedStep = arg.LastUsedStep
+	}), nil
+}
+
+func (m *MemoryStore) CreateRecoveryCode(ctx context.Context, arg dbcommon.CreateRecoveryCodeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.recoveryCodes = append(m.recoveryCodes, dbcommon.RecoveryCode{
+		ID:        m.nextID(),
+		UserID:    arg.UserID,
+		CodeHash:  arg.CodeHash,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) ListUnusedRecoveryCodes(ctx context.Context, userID int64) ([]dbcommon.RecoveryCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var codes []dbcommon.RecoveryCode
+	for _, code := range m.recoveryCodes {
+		if code.UserID == userID && !code.UsedAt.Valid {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+func (m *MemoryStore) MarkRecoveryCodeUsed(ctx context.Context, id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return update(m.recoveryCodes, func(c *dbcommon.RecoveryCode) bool {
+		return c.ID == id && !c.UsedAt.Valid
+	}, func(c *dbcommon.RecoveryCode) {
+		c.UsedAt = validTime(time.Now())
+	}), nil
+}
+
+func (m *MemoryStore) DeleteRecoveryCodesByUserID(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove(&m.recoveryCodes, func(c *dbcommon.RecoveryCode) bool { return c.UserID == userID })
+	return nil
+}
+
+func (m *MemoryStore) CreateWebAuthnChallenge(ctx context.Context, arg dbcommon.CreateWebAuthnChallengeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.webauthnChallenges, func(c *dbcommon.WebauthnChallenge) bool { return c.Challenge == arg.Challenge }) != nil {
+		return fmt.Errorf("webauthn challenge: %w", errDuplicate)
+	}
+
+	m.webauthnChallenges = append(m.webauthnChallenges, dbcommon.WebauthnChallenge{
+		ID:        m.nextID(),
+		Challenge: arg.Challenge,
+		Ceremony:  arg.Ceremony,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) GetWebAuthnChallenge(ctx context.Context, challenge string) (dbcommon.WebauthnChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.webauthnChallenges, func(c *dbcommon.WebauthnChallenge) bool { return c.Challenge == challenge }))
+}
+
+func (m *MemoryStore) DeleteWebAuthnChallenge(ctx context.Context, id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return remove(&m.webauthnChallenges, func(c *dbcommon.WebauthnChallenge) bool { return c.ID == id }), nil
+}
+
+func (m *MemoryStore) DeleteExpiredWebAuthnChallenges(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	remove(&m.webauthnChallenges, func(c *dbcommon.WebauthnChallenge) bool { return c.ExpiresAt.Before(now) })
+	return nil
+}
+
+func (m *MemoryStore) CreateWebAuthnCredential(ctx context.Context, arg dbcommon.CreateWebAuthnCredentialParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if find(m.webauthnCredentials, func(c *dbcommon.WebauthnCredential) bool {
+		return bytes.Equal(c.CredentialID, arg.CredentialID)
+	}) != nil {
+		return fmt.Errorf("webauthn credential: %w", errDuplicate)
+	}
+
+	m.webauthnCredentials = append(m.webauthnCredentials, dbcommon.WebauthnCredential{
+		ID:                m.nextID(),
+		UserID:            arg.UserID,
+		CredentialID:      arg.CredentialID,
+		PublicKey:         arg.PublicKey,
+		SignCount:         arg.SignCount,
+		Aaguid:            arg.Aaguid,
+		AttestationFormat: arg.AttestationFormat,
+		Transports:        arg.Transports,
+		Name:              arg.Name,
+		CreatedAt:         time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (dbcommon.WebauthnCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return one(find(m.webauthnCredentials, func(c *dbcommon.WebauthnCredential) bool {
+		return bytes.Equal(c.CredentialID, credentialID)
+	}))
+}
+
+func (m *MemoryStore) ListWebAuthnCredentialsByUserID(ctx context.Context, userID int64) ([]dbcommon.WebauthnCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Rows are kept in insertion order, which is ORDER BY created_at
+	var credentials []dbcommon.WebauthnCredential
+	for _, credential := range m.webauthnCredentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (m *MemoryStore) UpdateWebAuthnSignCount(ctx context.Context, arg dbcommon.UpdateWebAuthnSignCountParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(m.webauthnCredentials, func(c *dbcommon.WebauthnCredential) bool { return c.ID == arg.ID }, func(c *dbcommon.WebauthnCredential) {
+		c.SignCount = arg.SignCount
+		c.LastUsedAt = validTime(time.Now())
+	})
+	return nil
+}
+
+func (m *MemoryStore) IncrementRateLimitCounter(ctx context.Context, arg dbcommon.IncrementRateLimitCounterParams) (sql.Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if counter := find(m.rateLimitCounters, func(c *dbcommon.RateLimitCounter) bool { return c.Bucket == arg.Bucket }); counter != nil {
+		counter.Count++
+		return counterResult{rows: 2, count: counter.Count}, nil
+	}
+
+	m.rateLimitCounters = append(m.rateLimitCounters, dbcommon.RateLimitCounter{
+		ID:        m.nextID(),
+		Bucket:    arg.Bucket,
+		Count:     1,
+		ExpiresAt: arg.ExpiresAt,
+	})
+	return counterResult{rows: 1, count: 1}, nil
+}
+
+func (m *MemoryStore) DeleteExpiredRateLimitCounters(ctx context.Context, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remove(&m.rateLimitCounters, func(c *dbcommon.RateLimitCounter) bool { return c.ExpiresAt.Before(expiresAt) })
+	return nil
+}
+
+// counterResult reports an upserted counter like MySQL's ON DUPLICATE KEY UPDATE with LAST_INSERT_ID(expr)
+type counterResult struct {
+	rows  int64
+	count int64
+}
+
+func (r counterResult) LastInsertId() (int64, error) {
+	return r.count, nil
+}
+
+func (r counterResult) RowsAffected() (int64, error) {
+	return r.rows, nil
+}
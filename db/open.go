@@ -0,0 +1,38 @@
+package db
+
+import (
+	"auth_go/dbcommon"
+	"context"
+	"database/sql"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// driverNames maps each dialect to its database/sql driver
+var driverNames = map[dbcommon.Dialect]string{
+	dbcommon.MySQL:    "mysql",
+	dbcommon.Postgres: "pgx",
+	dbcommon.SQLite:   "sqlite",
+}
+
+// Open connects to the database and checks that it is reachable
+func Open(ctx context.Context, dialect dbcommon.Dialect, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverNames[dialect], dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, sharing one connection avoids busy errors
+	if dialect == dbcommon.SQLite {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"auth_go/dbcommon"
+	"context"
+	"log"
+	"time"
+)
+
+// IncrementRateLimit counts a request in the bucket and returns the count so far, satisfying middleware.CounterStore
+func (d *Db) IncrementRateLimit(ctx context.Context, bucket string, expiresAt time.Time) (int64, error) {
+	result, err := d.Queries.IncrementRateLimitCounter(ctx, dbcommon.IncrementRateLimitCounterParams{
+		Bucket:    bucket,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// MySQL reports one affected row for an insert and two for an update
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 1 {
+		return 1, nil
+	}
+	return result.LastInsertId()
+}
+
+// PurgeExpiredRateLimits periodically deletes counters of windows that have passed
+func (d *Db) PurgeExpiredRateLimits(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Queries.DeleteExpiredRateLimitCounters(ctx, time.Now()); err != nil {
+				log.Printf("Error deleting expired rate limit counters: %v", err)
+			}
+		}
+	}
+}
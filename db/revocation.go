@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// IsTokenRevoked reports whether the token with the given jti was revoked, satisfying utils.RevocationStore
+func (d *Db) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	count, err := d.Queries.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// PurgeExpiredRevocations periodically deletes revocations and records of access tokens that have expired anyway
+func (d *Db) PurgeExpiredRevocations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Queries.DeleteExpiredRevokedTokens(ctx, time.Now()); err != nil {
+				log.Printf("Error deleting expired revoked tokens: %v", err)
+			}
+			if err := d.Queries.DeleteExpiredAccessTokens(ctx, time.Now()); err != nil {
+				log.Printf("Error deleting expired access tokens: %v", err)
+			}
+		}
+	}
+}
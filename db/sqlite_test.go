@@ -0,0 +1,171 @@
+package db
+
+import (
+	"auth_go/dbcommon"
+	"auth_go/migrations"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newSQLiteDb returns a Db on a fresh, migrated SQLite database
+func newSQLiteDb(t *testing.T) *Db {
+	t.Helper()
+
+	ctx := context.Background()
+	dsn := "file:" + filepath.Join(t.TempDir(), "auth.db") + "?_pragma=foreign_keys(1)"
+	sqlDB, err := Open(ctx, dbcommon.SQLite, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrations.New(sqlDB, dbcommon.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	return NewDb(dbcommon.NewDialect(sqlDB, dbcommon.SQLite))
+}
+
+// TestSQLiteStore runs the queries that are rewritten for the dialect against a real database
+func TestSQLiteStore(t *testing.T) {
+	ctx := context.Background()
+	q := newSQLiteDb(t).Queries
+
+	err := q.CreateClient(ctx, dbcommon.CreateClientParams{Namespace: "app", Name: "App", AllowedScopes: "openid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := q.GetClientByNamespace(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = q.CreateUser(ctx, dbcommon.CreateUserParams{NamespaceID: client.ID, Email: "user@example.com", Password: "hash", Uuid: "uuid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := q.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{NamespaceID: client.ID, Email: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	err = q.CreateSSOSession(ctx, dbcommon.CreateSSOSessionParams{UserID: user.ID, TokenHash: "hash", Sid: "sid", Amr: "pwd", AuthTime: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := q.GetSSOSessionByHash(ctx, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("AddSSOSessionClient", func(t *testing.T) {
+		for range 2 {
+			if err := q.AddSSOSessionClient(ctx, dbcommon.AddSSOSessionClientParams{SsoSessionID: session.ID, ClientID: client.ID}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		clients, err := q.ListSSOSessionClients(ctx, session.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(clients) != 1 {
+			t.Errorf("got %d clients, want 1", len(clients))
+		}
+	})
+
+	t.Run("RevokeToken", func(t *testing.T) {
+		for range 2 {
+			if err := q.RevokeToken(ctx, dbcommon.RevokeTokenParams{Jti: "jti", ExpiresAt: now.Add(time.Hour)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		count, err := q.IsTokenRevoked(ctx, "jti")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("jti revoked %d times, want 1", count)
+		}
+	})
+
+	t.Run("UpsertConsent", func(t *testing.T) {
+		for _, scope := range []string{"openid", "openid email"} {
+			if err := q.UpsertConsent(ctx, dbcommon.UpsertConsentParams{UserID: user.ID, ClientID: client.ID, Scope: scope}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		consent, err := q.GetConsent(ctx, dbcommon.GetConsentParams{UserID: user.ID, ClientID: client.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if consent.Scope != "openid email" {
+			t.Errorf("got scope %q, want the updated one", consent.Scope)
+		}
+	})
+
+	t.Run("UpsertTOTPCredential", func(t *testing.T) {
+		if err := q.UpsertTOTPCredential(ctx, dbcommon.UpsertTOTPCredentialParams{UserID: user.ID, Secret: "first"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.ConfirmTOTPCredential(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.UseTOTPStep(ctx, dbcommon.UseTOTPStepParams{LastUsedStep: 42, UserID: user.ID, LastUsedStep_2: 42}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Enrolling again replaces the secret and starts over unconfirmed
+		if err := q.UpsertTOTPCredential(ctx, dbcommon.UpsertTOTPCredentialParams{UserID: user.ID, Secret: "second"}); err != nil {
+			t.Fatal(err)
+		}
+		credential, err := q.GetTOTPCredentialByUserID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if credential.Secret != "second" || credential.ConfirmedAt.Valid || credential.LastUsedStep != 0 {
+			t.Errorf("got secret %q, confirmed %v, last used step %d after enrolling again", credential.Secret, credential.ConfirmedAt.Valid, credential.LastUsedStep)
+		}
+	})
+
+	t.Run("IncrementRateLimitCounter", func(t *testing.T) {
+		// RowsAffected follows MySQL, 1 for the insert and 2 for an update
+		for i, wantRows := range []int64{1, 2, 2} {
+			result, err := q.IncrementRateLimitCounter(ctx, dbcommon.IncrementRateLimitCounterParams{Bucket: "bucket", ExpiresAt: now.Add(time.Minute)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			count, _ := result.LastInsertId()
+			rows, _ := result.RowsAffected()
+			if count != int64(i+1) || rows != wantRows {
+				t.Errorf("increment %d: got count %d and %d rows, want %d and %d", i+1, count, rows, i+1, wantRows)
+			}
+		}
+	})
+
+	t.Run("ListSSOSessionAccessTokens", func(t *testing.T) {
+		// Times are stored as text, the comparison only works if they are written in the same form
+		for jti, expiresAt := range map[string]time.Time{"live": now.Add(time.Hour), "expired": now.Add(-time.Hour)} {
+			err := q.CreateAccessToken(ctx, dbcommon.CreateAccessTokenParams{
+				Jti:          jti,
+				UserID:       user.ID,
+				SsoSessionID: sql.NullInt64{Int64: session.ID, Valid: true},
+				ExpiresAt:    expiresAt,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		tokens, err := q.ListSSOSessionAccessTokens(ctx, dbcommon.ListSSOSessionAccessTokensParams{SsoSessionID: sql.NullInt64{Int64: session.ID, Valid: true}, ExpiresAt: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != 1 || tokens[0].Jti != "live" {
+			t.Errorf("got %v, want only the live token", tokens)
+		}
+	})
+}
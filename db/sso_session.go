@@ -0,0 +1,24 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PurgeExpiredSSOSessions periodically deletes SSO sessions that can no longer be resumed
+func (d *Db) PurgeExpiredSSOSessions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Queries.DeleteExpiredSSOSessions(ctx, time.Now()); err != nil {
+				log.Printf("Error deleting expired SSO sessions: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"auth_go/dbcommon"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UserRepository stores user accounts and their login state
+type UserRepository interface {
+	CreateUser(ctx context.Context, arg dbcommon.CreateUserParams) error
+	GetUserByEmail(ctx context.Context, arg dbcommon.GetUserByEmailParams) (dbcommon.User, error)
+	GetUserByID(ctx context.Context, id int64) (dbcommon.User, error)
+	GetUserByUUID(ctx context.Context, uuid string) (dbcommon.User, error)
+	UpdateUserPassword(ctx context.Context, arg dbcommon.UpdateUserPasswordParams) error
+	SetUserEmailVerified(ctx context.Context, id int64) error
+	MarkVerificationSent(ctx context.Context, arg dbcommon.MarkVerificationSentParams) (int64, error)
+	RecordFailedLogin(ctx context.Context, arg dbcommon.RecordFailedLoginParams) error
+	LockUser(ctx context.Context, arg dbcommon.LockUserParams) (int64, error)
+	UnlockUser(ctx context.Context, id int64) error
+	ListUsers(ctx context.Context, namespaceID int64) ([]dbcommon.User, error)
+	DisableUser(ctx context.Context, id int64) error
+	EnableUser(ctx context.Context, id int64) error
+}
+
+// ClientRepository stores the registered OAuth clients
+type ClientRepository interface {
+	GetClientByID(ctx context.Context, id int64) (dbcommon.Client, error)
+	GetClientByNamespace(ctx context.Context, namespace string) (dbcommon.Client, error)
+	ListClientRedirectURIs(ctx context.Context, clientID int64) ([]string, error)
+	CreateClientRedirectURI(ctx context.Context, arg dbcommon.CreateClientRedirectURIParams) error
+	DeleteClientRedirectURIs(ctx context.Context, clientID int64) error
+	ListClients(ctx context.Context) ([]dbcommon.Client, error)
+	CreateClient(ctx context.Context, arg dbcommon.CreateClientParams) error
+	UpdateClient(ctx context.Context, arg dbcommon.UpdateClientParams) error
+	DeleteClient(ctx context.Context, id int64) (int64, error)
+}
+
+// SessionRepository stores authorization requests while the user logs in and consents
+type SessionRepository interface {
+	CreateAuthorizeSession(ctx context.Context, arg dbcommon.CreateAuthorizeSessionParams) error
+	GetSessionByAuthCode(ctx context.Context, authCode string) (dbcommon.GetSessionByAuthCodeRow, error)
+	GetUserByAuthCode(ctx context.Context, authCode string) (dbcommon.GetUserByAuthCodeRow, error)
+	SetSessionMFAPending(ctx context.Context, arg dbcommon.SetSessionMFAPendingParams) error
+	UpdateUserSession(ctx context.Context, arg dbcommon.UpdateUserSessionParams) error
+	ClearSessionPrompt(ctx context.Context, authCode string) error
+	DeleteSession(ctx context.Context, authCode string) (int64, error)
+	DeleteUserSessionsByUserID(ctx context.Context, userID sql.NullInt64) error
+	DeleteClientSessions(ctx context.Context, clientID int64) error
+}
+
+// SSOSessionRepository stores the sessions that keep users logged in across clients
+type SSOSessionRepository interface {
+	CreateSSOSession(ctx context.Context, arg dbcommon.CreateSSOSessionParams) error
+	GetSSOSessionByHash(ctx context.Context, tokenHash string) (dbcommon.SsoSession, error)
+	GetSSOSessionByID(ctx context.Context, id int64) (dbcommon.SsoSession, error)
+	AddSSOSessionClient(ctx context.Context, arg dbcommon.AddSSOSessionClientParams) error
+	ListSSOSessionClients(ctx context.Context, ssoSessionID int64) ([]dbcommon.Client, error)
+	DeleteSSOSession(ctx context.Context, tokenHash string) error
+	DeleteSSOSessionsByUserID(ctx context.Context, userID int64) error
+	DeleteExpiredSSOSessions(ctx context.Context, expiresAt time.Time) error
+}
+
+// ConsentRepository stores the scopes users granted to clients
+type ConsentRepository interface {
+	GetConsent(ctx context.Context, arg dbcommon.GetConsentParams) (dbcommon.Consent, error)
+	UpsertConsent(ctx context.Context, arg dbcommon.UpsertConsentParams) error
+}
+
+// TokenRepository stores refresh tokens, issued and revoked access tokens and password reset tokens
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, arg dbcommon.CreateRefreshTokenParams) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (dbcommon.RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id int64) (int64, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int64) error
+	RevokeSSOSessionRefreshTokens(ctx context.Context, ssoSessionID sql.NullInt64) error
+	DeleteClientRefreshTokens(ctx context.Context, clientID int64) error
+	RevokeToken(ctx context.Context, arg dbcommon.RevokeTokenParams) error
+	IsTokenRevoked(ctx context.Context, jti string) (int64, error)
+	DeleteExpiredRevokedTokens(ctx context.Context, expiresAt time.Time) error
+	CreateAccessToken(ctx context.Context, arg dbcommon.CreateAccessTokenParams) error
+	ListSSOSessionAccessTokens(ctx context.Context, arg dbcommon.ListSSOSessionAccessTokensParams) ([]dbcommon.AccessToken, error)
+	DeleteExpiredAccessTokens(ctx context.Context, expiresAt time.Time) error
+	CreatePasswordResetToken(ctx context.Context, arg dbcommon.CreatePasswordResetTokenParams) error
+	GetPasswordResetTokenByHash(ctx context.Context, tokenHash string) (dbcommon.PasswordResetToken, error)
+	MarkPasswordResetTokenUsed(ctx context.Context, id int64) (int64, error)
+	ReleasePasswordResetToken(ctx context.Context, id int64) error
+	DeletePasswordResetTokensByUserID(ctx context.Context, userID int64) error
+}
+
+// SigningKeyRepository stores the keys tokens are signed with
+type SigningKeyRepository interface {
+	CreateSigningKey(ctx context.Context, arg dbcommon.CreateSigningKeyParams) error
+	ListPublishedSigningKeys(ctx context.Context) ([]dbcommon.SigningKey, error)
+	MarkSigningKeyRetiring(ctx context.Context, kid string) (int64, error)
+	RetireSigningKeys(ctx context.Context, rotatedAt sql.NullTime) error
+}
+
+// MFARepository stores second factors: authenticator apps, recovery codes and security keys
+type MFARepository interface {
+	GetTOTPCredentialByUserID(ctx context.Context, userID int64) (dbcommon.TotpCredential, error)
+	UpsertTOTPCredential(ctx context.Context, arg dbcommon.UpsertTOTPCredentialParams) error
+	ConfirmTOTPCredential(ctx context.Context, userID int64) error
+	UseTOTPStep(ctx context.Context, arg dbcommon.UseTOTPStepParams) (int64, error)
+	CreateRecoveryCode(ctx context.Context, arg dbcommon.CreateRecoveryCodeParams) error
+	ListUnusedRecoveryCodes(ctx context.Context, userID int64) ([]dbcommon.RecoveryCode, error)
+	MarkRecoveryCodeUsed(ctx context.Context, id int64) (int64, error)
+	DeleteRecoveryCodesByUserID(ctx context.Context, userID int64) error
+	CreateWebAuthnChallenge(ctx context.Context, arg dbcommon.CreateWebAuthnChallengeParams) error
+	GetWebAuthnChallenge(ctx context.Context, challenge string) (dbcommon.WebauthnChallenge, error)
+	DeleteWebAuthnChallenge(ctx context.Context, id int64) (int64, error)
+	DeleteExpiredWebAuthnChallenges(ctx context.Context) error
+	CreateWebAuthnCredential(ctx context.Context, arg dbcommon.CreateWebAuthnCredentialParams) error
+	GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (dbcommon.WebauthnCredential, error)
+	ListWebAuthnCredentialsByUserID(ctx context.Context, userID int64) ([]dbcommon.WebauthnCredential, error)
+	UpdateWebAuthnSignCount(ctx context.Context, arg dbcommon.UpdateWebAuthnSignCountParams) error
+}
+
+// RateLimitRepository stores request counters shared between replicas
+type RateLimitRepository interface {
+	IncrementRateLimitCounter(ctx context.Context, arg dbcommon.IncrementRateLimitCounterParams) (sql.Result, error)
+	DeleteExpiredRateLimitCounters(ctx context.Context, expiresAt time.Time) error
+}
+
+// Store is everything the service keeps, implemented by the sqlc queries for each SQL dialect
+type Store interface {
+	UserRepository
+	ClientRepository
+	SessionRepository
+	SSOSessionRepository
+	ConsentRepository
+	TokenRepository
+	SigningKeyRepository
+	MFARepository
+	RateLimitRepository
+}
+
+var _ Store = (*dbcommon.Queries)(nil)
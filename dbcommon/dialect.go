@@ -0,0 +1,175 @@
+package dbcommon
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect is the SQL database the queries run against. The queries are written
+// for MySQL, the other dialects run them through a translating DBTX.
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// sqliteTimeFormat matches what SQLite's CURRENT_TIMESTAMP produces, so stored
+// times compare correctly as text
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// upserts replaces the statements using MySQL only syntax with their standard
+// ON CONFLICT form, which PostgreSQL and SQLite share
+var upserts = map[string]string{
+	addSSOSessionClient: `INSERT INTO sso_session_clients (sso_session_id, client_id) VALUES (?, ?)
+ON CONFLICT (sso_session_id, client_id) DO NOTHING`,
+	revokeToken: `INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?)
+ON CONFLICT (jti) DO NOTHING`,
+	upsertConsent: `INSERT INTO consents (user_id, client_id, scope) VALUES (?, ?, ?)
+ON CONFLICT (user_id, client_id) DO UPDATE SET scope = excluded.scope, updated_at = CURRENT_TIMESTAMP`,
+	upsertTOTPCredential: `INSERT INTO totp_credentials (user_id, secret) VALUES (?, ?)
+ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, confirmed_at = NULL, last_used_step = 0`,
+	incrementRateLimitCounter: `INSERT INTO rate_limit_counters (bucket, expires_at) VALUES (?, ?)
+ON CONFLICT (bucket) DO UPDATE SET count = rate_limit_counters.count + 1
+RETURNING count`,
+}
+
+// ParseDialect checks the name of a dialect
+func ParseDialect(name string) (Dialect, error) {
+	switch d := Dialect(name); d {
+	case MySQL, Postgres, SQLite:
+		return d, nil
+	}
+	return "", fmt.Errorf("unknown database dialect %q, expected mysql, postgres or sqlite", name)
+}
+
+// NewDialect returns queries running against db in the given dialect
+func NewDialect(db DBTX, dialect Dialect) *Queries {
+	if dialect == MySQL {
+		return New(db)
+	}
+	return New(&dialectDB{db: db, dialect: dialect})
+}
+
+// dialectDB translates the MySQL queries and their arguments before running them
+type dialectDB struct {
+	db      DBTX
+	dialect Dialect
+}
+
+func (d *dialectDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	// MySQL hands back the new count through LAST_INSERT_ID, here it comes from RETURNING
+	if query == incrementRateLimitCounter {
+		var count int64
+		q, args := d.translate(query, args)
+		if err := d.db.QueryRowContext(ctx, q, args...).Scan(&count); err != nil {
+			return nil, err
+		}
+		return counterResult(count), nil
+	}
+
+	q, args := d.translate(query, args)
+	return d.db.ExecContext(ctx, q, args...)
+}
+
+func (d *dialectDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	q, _ := d.translate(query, nil)
+	return d.db.PrepareContext(ctx, q)
+}
+
+func (d *dialectDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	q, args := d.translate(query, args)
+	return d.db.QueryContext(ctx, q, args...)
+}
+
+func (d *dialectDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	q, args := d.translate(query, args)
+	return d.db.QueryRowContext(ctx, q, args...)
+}
+
+func (d *dialectDB) translate(query string, args []interface{}) (string, []interface{}) {
+	if upsert, ok := upserts[query]; ok {
+		query = upsert
+	}
+
+	switch d.dialect {
+	case Postgres:
+		query = Rebind(query)
+	case SQLite:
+		args = sqliteArgs(args)
+	}
+	return query, args
+}
+
+// Rebind replaces the ? placeholders of a query with PostgreSQL's numbered $1, $2, ...
+func Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			// Comments are copied up to the end of the line untouched
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+			continue
+		case ch == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// sqliteArgs stores times as UTC text in the format of CURRENT_TIMESTAMP
+func sqliteArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			converted[i] = v.UTC().Format(sqliteTimeFormat)
+		case sql.NullTime:
+			if v.Valid {
+				converted[i] = v.Time.UTC().Format(sqliteTimeFormat)
+			} else {
+				converted[i] = nil
+			}
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// counterResult reports an upserted counter the way MySQL does with LAST_INSERT_ID(expr):
+// one affected row for an insert, two for an update and the count as insert id
+type counterResult int64
+
+func (r counterResult) LastInsertId() (int64, error) {
+	return int64(r), nil
+}
+
+func (r counterResult) RowsAffected() (int64, error) {
+	if r == 1 {
+		return 1, nil
+	}
+	return 2, nil
+}
@@ -0,0 +1,149 @@
+package dbcommon
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mysqlOnly is the syntax PostgreSQL and SQLite don't understand, queries using it need a rewrite in upserts
+var mysqlOnly = []string{"INSERT IGNORE", "ON DUPLICATE KEY", "LAST_INSERT_ID", "VALUES("}
+
+// generatedQueries reads query.sql and returns the queries as sqlc generates their constants, by name
+func generatedQueries(t *testing.T) map[string]string {
+	t.Helper()
+
+	source, err := os.ReadFile("../query.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := map[string]string{}
+	for _, block := range strings.Split(string(source), "-- name: ")[1:] {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		// sqlc keeps the name line and drops the other comments
+		var body []string
+		for _, line := range lines[1:] {
+			if !strings.HasPrefix(line, "--") {
+				body = append(body, line)
+			}
+		}
+		name, _, _ := strings.Cut(lines[0], " ")
+		queries[name] = "-- name: " + lines[0] + "\n" + strings.TrimSuffix(strings.Join(body, "\n"), ";") + "\n"
+	}
+	return queries
+}
+
+func TestUpsertsMatchQueries(t *testing.T) {
+	queries := generatedQueries(t)
+	if len(queries) == 0 {
+		t.Fatal("no queries found in query.sql")
+	}
+
+	byText := map[string]string{}
+	for name, query := range queries {
+		byText[query] = name
+
+		for _, syntax := range mysqlOnly {
+			if _, ok := upserts[query]; strings.Contains(query, syntax) && !ok {
+				t.Errorf("%s uses %s but has no rewrite in upserts", name, syntax)
+			}
+		}
+	}
+
+	for query, upsert := range upserts {
+		if _, ok := byText[query]; !ok {
+			t.Errorf("upserts has a rewrite for a query that is not in query.sql any more:\n%s", query)
+		}
+		for _, syntax := range mysqlOnly {
+			if strings.Contains(upsert, syntax) {
+				t.Errorf("the rewrite of %q still uses %s", query, syntax)
+			}
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"SELECT '?', \"?\" FROM t WHERE a = ?", "SELECT '?', \"?\" FROM t WHERE a = $1"},
+		{"-- is it ?\nSELECT ?", "-- is it ?\nSELECT $1"},
+		{"SELECT ? -- the last ?", "SELECT $1 -- the last ?"},
+		{"SELECT 'it''s ?', ?", "SELECT 'it''s ?', $1"},
+		{"SELECT a-?", "SELECT a-$1"},
+	}
+
+	for _, tt := range tests {
+		if got := Rebind(tt.query); got != tt.want {
+			t.Errorf("Rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCounterResult(t *testing.T) {
+	for count, wantRows := range map[counterResult]int64{1: 1, 2: 2, 7: 2} {
+		id, _ := count.LastInsertId()
+		rows, _ := count.RowsAffected()
+		if id != int64(count) || rows != wantRows {
+			t.Errorf("counter %d: got insert id %d and %d rows, want %d and %d", count, id, rows, count, wantRows)
+		}
+	}
+}
+
+// recordingDB remembers the last statement it was asked to run
+type recordingDB struct {
+	query string
+	args  []interface{}
+}
+
+func (r *recordingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.query, r.args = query, args
+	return nil, nil
+}
+
+func (r *recordingDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	r.query = query
+	return nil, nil
+}
+
+func (r *recordingDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	r.query, r.args = query, args
+	return nil, nil
+}
+
+func (r *recordingDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	r.query, r.args = query, args
+	return nil
+}
+
+func TestDialectTranslation(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		dialect   Dialect
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{MySQL, revokeToken, []interface{}{"jti", expiresAt}},
+		{Postgres, "INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2)\nON CONFLICT (jti) DO NOTHING", []interface{}{"jti", expiresAt}},
+		{SQLite, "INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?)\nON CONFLICT (jti) DO NOTHING", []interface{}{"jti", "2030-01-02 02:04:05"}},
+	}
+
+	for _, tt := range tests {
+		recorder := &recordingDB{}
+		if err := NewDialect(recorder, tt.dialect).RevokeToken(context.Background(), RevokeTokenParams{Jti: "jti", ExpiresAt: expiresAt}); err != nil {
+			t.Fatal(err)
+		}
+		if recorder.query != tt.wantQuery || !reflect.DeepEqual(recorder.args, tt.wantArgs) {
+			t.Errorf("%s: ran %q with %v, want %q with %v", tt.dialect, recorder.query, recorder.args, tt.wantQuery, tt.wantArgs)
+		}
+	}
+}
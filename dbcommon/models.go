@@ -9,13 +9,91 @@ import (
 	"time"
 )
 
+type AccessToken struct {
+	ID           int64
+	Jti          string
+	UserID       int64
+	SsoSessionID sql.NullInt64
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
 type Client struct {
+	ID                       int64
+	Namespace                string
+	Name                     string
+	ClientSecret             sql.NullString
+	AllowedScopes            string
+	UserPool                 string
+	RequireEmailVerification bool
+	CreatedAt                time.Time
+	BackchannelLogoutUri     string
+	FrontchannelLogoutUri    string
+}
+
+type ClientRedirectUri struct {
+	ID          int64
+	ClientID    int64
+	RedirectUri string
+	CreatedAt   time.Time
+}
+
+type Consent struct {
+	ID        int64
+	UserID    int64
+	ClientID  int64
+	Scope     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type PasswordResetToken struct {
 	ID        int64
-	Namespace string
-	Name      string
+	UserID    int64
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
 	CreatedAt time.Time
 }
 
+type RateLimitCounter struct {
+	ID        int64
+	Bucket    string
+	Count     int64
+	ExpiresAt time.Time
+}
+
+type RecoveryCode struct {
+	ID        int64
+	UserID    int64
+	CodeHash  string
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type RefreshToken struct {
+	ID           int64
+	TokenHash    string
+	FamilyID     string
+	UserID       int64
+	ClientID     int64
+	Scope        string
+	AuthTime     sql.NullTime
+	Amr          string
+	ExpiresAt    time.Time
+	UsedAt       sql.NullTime
+	RevokedAt    sql.NullTime
+	CreatedAt    sql.NullTime
+	SsoSessionID sql.NullInt64
+}
+
+type RevokedToken struct {
+	ID        int64
+	Jti       string
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
 type Session struct {
 	ID                  int64
 	SessionID           []byte
@@ -26,15 +104,89 @@ type Session struct {
 	PkceChallengeMethod string
 	State               string
 	RedirectUri         string
+	Scope               string
+	Nonce               string
+	AuthTime            sql.NullTime
+	MfaUserID           sql.NullInt64
+	Amr                 string
 	ExpiresAt           time.Time
 	CreatedAt           sql.NullTime
+	Prompt              string
+	LoginHint           string
+	SsoSessionID        sql.NullInt64
+}
+
+type SigningKey struct {
+	ID         int64
+	Kid        string
+	Algorithm  string
+	PrivateKey string
+	Status     string
+	CreatedAt  time.Time
+	RotatedAt  sql.NullTime
+}
+
+type SsoSession struct {
+	ID        int64
+	UserID    int64
+	TokenHash string
+	Amr       string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	Sid       string
+}
+
+type SsoSessionClient struct {
+	SsoSessionID int64
+	ClientID     int64
+	CreatedAt    time.Time
+}
+
+type TotpCredential struct {
+	ID           int64
+	UserID       int64
+	Secret       string
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
+	CreatedAt    time.Time
 }
 
 type User struct {
+	ID                  int64
+	Uuid                string
+	NamespaceID         int64
+	Email               string
+	Firstname           string
+	Lastname            string
+	Password            string
+	EmailVerified       bool
+	VerificationSentAt  sql.NullTime
+	FailedLoginAttempts int32
+	LastFailedLoginAt   sql.NullTime
+	LockedUntil         sql.NullTime
+	DisabledAt          sql.NullTime
+}
+
+type WebauthnChallenge struct {
 	ID        int64
-	Uuid      string
-	Email     string
-	Firstname string
-	Lastname  string
-	Password  string
+	Challenge string
+	Ceremony  string
+	UserID    sql.NullInt64
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type WebauthnCredential struct {
+	ID                int64
+	UserID            int64
+	CredentialID      []byte
+	PublicKey         []byte
+	SignCount         int64
+	Aaguid            []byte
+	AttestationFormat string
+	Transports        string
+	Name              string
+	LastUsedAt        sql.NullTime
+	CreatedAt         time.Time
 }
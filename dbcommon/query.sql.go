@@ -11,9 +11,62 @@ import (
 	"time"
 )
 
+const addSSOSessionClient = `-- name: AddSSOSessionClient :exec
+INSERT IGNORE INTO sso_session_clients (sso_session_id, client_id) VALUES (?, ?)
+`
+
+type AddSSOSessionClientParams struct {
+	SsoSessionID int64
+	ClientID     int64
+}
+
+func (q *Queries) AddSSOSessionClient(ctx context.Context, arg AddSSOSessionClientParams) error {
+	_, err := q.db.ExecContext(ctx, addSSOSessionClient, arg.SsoSessionID, arg.ClientID)
+	return err
+}
+
+const clearSessionPrompt = `-- name: ClearSessionPrompt :exec
+UPDATE sessions SET prompt = '' WHERE auth_code = ?
+`
+
+func (q *Queries) ClearSessionPrompt(ctx context.Context, authCode string) error {
+	_, err := q.db.ExecContext(ctx, clearSessionPrompt, authCode)
+	return err
+}
+
+const confirmTOTPCredential = `-- name: ConfirmTOTPCredential :exec
+UPDATE totp_credentials SET confirmed_at = CURRENT_TIMESTAMP WHERE user_id = ?
+`
+
+func (q *Queries) ConfirmTOTPCredential(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, confirmTOTPCredential, userID)
+	return err
+}
+
+const createAccessToken = `-- name: CreateAccessToken :exec
+INSERT INTO access_tokens (jti, user_id, sso_session_id, expires_at) VALUES (?, ?, ?, ?)
+`
+
+type CreateAccessTokenParams struct {
+	Jti          string
+	UserID       int64
+	SsoSessionID sql.NullInt64
+	ExpiresAt    time.Time
+}
+
+func (q *Queries) CreateAccessToken(ctx context.Context, arg CreateAccessTokenParams) error {
+	_, err := q.db.ExecContext(ctx, createAccessToken,
+		arg.Jti,
+		arg.UserID,
+		arg.SsoSessionID,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
 const createAuthorizeSession = `-- name: CreateAuthorizeSession :exec
-INSERT INTO sessions (auth_code, client_id, pkce_challenge, pkce_challenge_method, state, redirect_uri, expires_at, session_id)
-VALUES (?, ?, ?, ?, ?, ?, NOW() + INTERVAL 10 MINUTE, UUID_TO_BIN(UUID()))
+INSERT INTO sessions (auth_code, client_id, pkce_challenge, pkce_challenge_method, state, redirect_uri, scope, nonce, prompt, login_hint, expires_at, session_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 
 type CreateAuthorizeSessionParams struct {
@@ -23,6 +76,12 @@ type CreateAuthorizeSessionParams struct {
 	PkceChallengeMethod string
 	State               string
 	RedirectUri         string
+	Scope               string
+	Nonce               string
+	Prompt              string
+	LoginHint           string
+	ExpiresAt           time.Time
+	SessionID           []byte
 }
 
 func (q *Queries) CreateAuthorizeSession(ctx context.Context, arg CreateAuthorizeSessionParams) error {
@@ -33,24 +92,178 @@ func (q *Queries) CreateAuthorizeSession(ctx context.Context, arg CreateAuthoriz
 		arg.PkceChallengeMethod,
 		arg.State,
 		arg.RedirectUri,
+		arg.Scope,
+		arg.Nonce,
+		arg.Prompt,
+		arg.LoginHint,
+		arg.ExpiresAt,
+		arg.SessionID,
+	)
+	return err
+}
+
+const createClient = `-- name: CreateClient :exec
+INSERT INTO clients (namespace, name, client_secret, allowed_scopes, user_pool, require_email_verification, backchannel_logout_uri, frontchannel_logout_uri)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type CreateClientParams struct {
+	Namespace                string
+	Name                     string
+	ClientSecret             sql.NullString
+	AllowedScopes            string
+	UserPool                 string
+	RequireEmailVerification bool
+	BackchannelLogoutUri     string
+	FrontchannelLogoutUri    string
+}
+
+func (q *Queries) CreateClient(ctx context.Context, arg CreateClientParams) error {
+	_, err := q.db.ExecContext(ctx, createClient,
+		arg.Namespace,
+		arg.Name,
+		arg.ClientSecret,
+		arg.AllowedScopes,
+		arg.UserPool,
+		arg.RequireEmailVerification,
+		arg.BackchannelLogoutUri,
+		arg.FrontchannelLogoutUri,
+	)
+	return err
+}
+
+const createClientRedirectURI = `-- name: CreateClientRedirectURI :exec
+INSERT INTO client_redirect_uris (client_id, redirect_uri) VALUES (?, ?)
+`
+
+type CreateClientRedirectURIParams struct {
+	ClientID    int64
+	RedirectUri string
+}
+
+func (q *Queries) CreateClientRedirectURI(ctx context.Context, arg CreateClientRedirectURIParams) error {
+	_, err := q.db.ExecContext(ctx, createClientRedirectURI, arg.ClientID, arg.RedirectUri)
+	return err
+}
+
+const createPasswordResetToken = `-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)
+`
+
+type CreatePasswordResetTokenParams struct {
+	UserID    int64
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) error {
+	_, err := q.db.ExecContext(ctx, createPasswordResetToken, arg.UserID, arg.TokenHash, arg.ExpiresAt)
+	return err
+}
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)
+`
+
+type CreateRecoveryCodeParams struct {
+	UserID   int64
+	CodeHash string
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createRecoveryCode, arg.UserID, arg.CodeHash)
+	return err
+}
+
+const createRefreshToken = `-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (token_hash, family_id, user_id, client_id, scope, auth_time, amr, sso_session_id, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type CreateRefreshTokenParams struct {
+	TokenHash    string
+	FamilyID     string
+	UserID       int64
+	ClientID     int64
+	Scope        string
+	AuthTime     sql.NullTime
+	Amr          string
+	SsoSessionID sql.NullInt64
+	ExpiresAt    time.Time
+}
+
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error {
+	_, err := q.db.ExecContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.FamilyID,
+		arg.UserID,
+		arg.ClientID,
+		arg.Scope,
+		arg.AuthTime,
+		arg.Amr,
+		arg.SsoSessionID,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createSSOSession = `-- name: CreateSSOSession :exec
+INSERT INTO sso_sessions (user_id, token_hash, sid, amr, auth_time, expires_at) VALUES (?, ?, ?, ?, ?, ?)
+`
+
+type CreateSSOSessionParams struct {
+	UserID    int64
+	TokenHash string
+	Sid       string
+	Amr       string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateSSOSession(ctx context.Context, arg CreateSSOSessionParams) error {
+	_, err := q.db.ExecContext(ctx, createSSOSession,
+		arg.UserID,
+		arg.TokenHash,
+		arg.Sid,
+		arg.Amr,
+		arg.AuthTime,
+		arg.ExpiresAt,
 	)
 	return err
 }
 
+const createSigningKey = `-- name: CreateSigningKey :exec
+INSERT INTO signing_keys (kid, algorithm, private_key, status)
+VALUES (?, ?, ?, 'active')
+`
+
+type CreateSigningKeyParams struct {
+	Kid        string
+	Algorithm  string
+	PrivateKey string
+}
+
+func (q *Queries) CreateSigningKey(ctx context.Context, arg CreateSigningKeyParams) error {
+	_, err := q.db.ExecContext(ctx, createSigningKey, arg.Kid, arg.Algorithm, arg.PrivateKey)
+	return err
+}
+
 const createUser = `-- name: CreateUser :exec
-INSERT INTO users (email, password, uuid, firstname, lastname) VALUES (?, ?, ?, ?, ?)
+INSERT INTO users (namespace_id, email, password, uuid, firstname, lastname) VALUES (?, ?, ?, ?, ?, ?)
 `
 
 type CreateUserParams struct {
-	Email     string
-	Password  string
-	Uuid      string
-	Firstname string
-	Lastname  string
+	NamespaceID int64
+	Email       string
+	Password    string
+	Uuid        string
+	Firstname   string
+	Lastname    string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) error {
 	_, err := q.db.ExecContext(ctx, createUser,
+		arg.NamespaceID,
 		arg.Email,
 		arg.Password,
 		arg.Uuid,
@@ -60,35 +273,230 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) error {
 	return err
 }
 
-const createUserSession = `-- name: CreateUserSession :execresult
-INSERT INTO sessions (session_id, user_id, expires_at)
-VALUES (UUID_TO_BIN(UUID()), ?, NOW() + INTERVAL 24 HOUR)
+const createWebAuthnChallenge = `-- name: CreateWebAuthnChallenge :exec
+INSERT INTO webauthn_challenges (challenge, ceremony, user_id, expires_at) VALUES (?, ?, ?, ?)
+`
+
+type CreateWebAuthnChallengeParams struct {
+	Challenge string
+	Ceremony  string
+	UserID    sql.NullInt64
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateWebAuthnChallenge(ctx context.Context, arg CreateWebAuthnChallengeParams) error {
+	_, err := q.db.ExecContext(ctx, createWebAuthnChallenge,
+		arg.Challenge,
+		arg.Ceremony,
+		arg.UserID,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createWebAuthnCredential = `-- name: CreateWebAuthnCredential :exec
+INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, aaguid, attestation_format, transports, name)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type CreateWebAuthnCredentialParams struct {
+	UserID            int64
+	CredentialID      []byte
+	PublicKey         []byte
+	SignCount         int64
+	Aaguid            []byte
+	AttestationFormat string
+	Transports        string
+	Name              string
+}
+
+func (q *Queries) CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) error {
+	_, err := q.db.ExecContext(ctx, createWebAuthnCredential,
+		arg.UserID,
+		arg.CredentialID,
+		arg.PublicKey,
+		arg.SignCount,
+		arg.Aaguid,
+		arg.AttestationFormat,
+		arg.Transports,
+		arg.Name,
+	)
+	return err
+}
+
+const deleteClient = `-- name: DeleteClient :execrows
+DELETE FROM clients WHERE id = ?
+`
+
+func (q *Queries) DeleteClient(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteClient, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteClientRedirectURIs = `-- name: DeleteClientRedirectURIs :exec
+DELETE FROM client_redirect_uris WHERE client_id = ?
+`
+
+func (q *Queries) DeleteClientRedirectURIs(ctx context.Context, clientID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteClientRedirectURIs, clientID)
+	return err
+}
+
+const deleteClientRefreshTokens = `-- name: DeleteClientRefreshTokens :exec
+DELETE FROM refresh_tokens WHERE client_id = ?
+`
+
+func (q *Queries) DeleteClientRefreshTokens(ctx context.Context, clientID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteClientRefreshTokens, clientID)
+	return err
+}
+
+const deleteClientSessions = `-- name: DeleteClientSessions :exec
+DELETE FROM sessions WHERE client_id = ?
+`
+
+func (q *Queries) DeleteClientSessions(ctx context.Context, clientID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteClientSessions, clientID)
+	return err
+}
+
+const deleteExpiredAccessTokens = `-- name: DeleteExpiredAccessTokens :exec
+DELETE FROM access_tokens WHERE expires_at < ?
+`
+
+func (q *Queries) DeleteExpiredAccessTokens(ctx context.Context, expiresAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredAccessTokens, expiresAt)
+	return err
+}
+
+const deleteExpiredRateLimitCounters = `-- name: DeleteExpiredRateLimitCounters :exec
+DELETE FROM rate_limit_counters WHERE expires_at < ?
 `
 
-func (q *Queries) CreateUserSession(ctx context.Context, userID sql.NullInt64) (sql.Result, error) {
-	return q.db.ExecContext(ctx, createUserSession, userID)
+func (q *Queries) DeleteExpiredRateLimitCounters(ctx context.Context, expiresAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredRateLimitCounters, expiresAt)
+	return err
+}
+
+const deleteExpiredRevokedTokens = `-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens WHERE expires_at < ?
+`
+
+func (q *Queries) DeleteExpiredRevokedTokens(ctx context.Context, expiresAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredRevokedTokens, expiresAt)
+	return err
+}
+
+const deleteExpiredSSOSessions = `-- name: DeleteExpiredSSOSessions :exec
+DELETE FROM sso_sessions WHERE expires_at < ?
+`
+
+func (q *Queries) DeleteExpiredSSOSessions(ctx context.Context, expiresAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredSSOSessions, expiresAt)
+	return err
 }
 
-const deleteSession = `-- name: DeleteSession :exec
+const deleteExpiredWebAuthnChallenges = `-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredWebAuthnChallenges(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredWebAuthnChallenges)
+	return err
+}
+
+const deletePasswordResetTokensByUserID = `-- name: DeletePasswordResetTokensByUserID :exec
+DELETE FROM password_reset_tokens WHERE user_id = ?
+`
+
+func (q *Queries) DeletePasswordResetTokensByUserID(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deletePasswordResetTokensByUserID, userID)
+	return err
+}
+
+const deleteRecoveryCodesByUserID = `-- name: DeleteRecoveryCodesByUserID :exec
+DELETE FROM recovery_codes WHERE user_id = ?
+`
+
+func (q *Queries) DeleteRecoveryCodesByUserID(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteRecoveryCodesByUserID, userID)
+	return err
+}
+
+const deleteSSOSession = `-- name: DeleteSSOSession :exec
+DELETE FROM sso_sessions WHERE token_hash = ?
+`
+
+func (q *Queries) DeleteSSOSession(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, deleteSSOSession, tokenHash)
+	return err
+}
+
+const deleteSSOSessionsByUserID = `-- name: DeleteSSOSessionsByUserID :exec
+DELETE FROM sso_sessions WHERE user_id = ?
+`
+
+func (q *Queries) DeleteSSOSessionsByUserID(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteSSOSessionsByUserID, userID)
+	return err
+}
+
+const deleteSession = `-- name: DeleteSession :execrows
 DELETE FROM sessions WHERE auth_code = ?
 `
 
-func (q *Queries) DeleteSession(ctx context.Context, authCode string) error {
-	_, err := q.db.ExecContext(ctx, deleteSession, authCode)
+func (q *Queries) DeleteSession(ctx context.Context, authCode string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteSession, authCode)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUserSessionsByUserID = `-- name: DeleteUserSessionsByUserID :exec
+DELETE FROM sessions WHERE user_id = ?
+`
+
+func (q *Queries) DeleteUserSessionsByUserID(ctx context.Context, userID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, deleteUserSessionsByUserID, userID)
+	return err
+}
+
+const deleteWebAuthnChallenge = `-- name: DeleteWebAuthnChallenge :execrows
+DELETE FROM webauthn_challenges WHERE id = ?
+`
+
+func (q *Queries) DeleteWebAuthnChallenge(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebAuthnChallenge, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const disableUser = `-- name: DisableUser :exec
+UPDATE users SET disabled_at = CURRENT_TIMESTAMP WHERE id = ? AND disabled_at IS NULL
+`
+
+func (q *Queries) DisableUser(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, disableUser, id)
 	return err
 }
 
-const deleteUserSession = `-- name: DeleteUserSession :exec
-DELETE FROM sessions WHERE session_id = UUID_TO_BIN(?)
+const enableUser = `-- name: EnableUser :exec
+UPDATE users SET disabled_at = NULL WHERE id = ?
 `
 
-func (q *Queries) DeleteUserSession(ctx context.Context, uuidTOBIN string) error {
-	_, err := q.db.ExecContext(ctx, deleteUserSession, uuidTOBIN)
+func (q *Queries) EnableUser(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, enableUser, id)
 	return err
 }
 
 const getClientByID = `-- name: GetClientByID :one
-SELECT id, namespace, name, created_at FROM clients WHERE id = ?
+SELECT id, namespace, name, client_secret, allowed_scopes, user_pool, require_email_verification, created_at, backchannel_logout_uri, frontchannel_logout_uri FROM clients WHERE id = ?
 `
 
 func (q *Queries) GetClientByID(ctx context.Context, id int64) (Client, error) {
@@ -98,13 +506,19 @@ func (q *Queries) GetClientByID(ctx context.Context, id int64) (Client, error) {
 		&i.ID,
 		&i.Namespace,
 		&i.Name,
+		&i.ClientSecret,
+		&i.AllowedScopes,
+		&i.UserPool,
+		&i.RequireEmailVerification,
 		&i.CreatedAt,
+		&i.BackchannelLogoutUri,
+		&i.FrontchannelLogoutUri,
 	)
 	return i, err
 }
 
 const getClientByNamespace = `-- name: GetClientByNamespace :one
-SELECT id, namespace, name, created_at FROM clients WHERE namespace = ?
+SELECT id, namespace, name, client_secret, allowed_scopes, user_pool, require_email_verification, created_at, backchannel_logout_uri, frontchannel_logout_uri FROM clients WHERE namespace = ?
 `
 
 func (q *Queries) GetClientByNamespace(ctx context.Context, namespace string) (Client, error) {
@@ -114,13 +528,125 @@ func (q *Queries) GetClientByNamespace(ctx context.Context, namespace string) (C
 		&i.ID,
 		&i.Namespace,
 		&i.Name,
+		&i.ClientSecret,
+		&i.AllowedScopes,
+		&i.UserPool,
+		&i.RequireEmailVerification,
+		&i.CreatedAt,
+		&i.BackchannelLogoutUri,
+		&i.FrontchannelLogoutUri,
+	)
+	return i, err
+}
+
+const getConsent = `-- name: GetConsent :one
+SELECT id, user_id, client_id, scope, created_at, updated_at FROM consents WHERE user_id = ? AND client_id = ?
+`
+
+type GetConsentParams struct {
+	UserID   int64
+	ClientID int64
+}
+
+func (q *Queries) GetConsent(ctx context.Context, arg GetConsentParams) (Consent, error) {
+	row := q.db.QueryRowContext(ctx, getConsent, arg.UserID, arg.ClientID)
+	var i Consent
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ClientID,
+		&i.Scope,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getPasswordResetTokenByHash = `-- name: GetPasswordResetTokenByHash :one
+SELECT id, user_id, token_hash, expires_at, used_at, created_at FROM password_reset_tokens WHERE token_hash = ?
+`
+
+func (q *Queries) GetPasswordResetTokenByHash(ctx context.Context, tokenHash string) (PasswordResetToken, error) {
+	row := q.db.QueryRowContext(ctx, getPasswordResetTokenByHash, tokenHash)
+	var i PasswordResetToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getRefreshTokenByHash = `-- name: GetRefreshTokenByHash :one
+SELECT id, token_hash, family_id, user_id, client_id, scope, auth_time, amr, expires_at, used_at, revoked_at, created_at, sso_session_id FROM refresh_tokens WHERE token_hash = ?
+`
+
+func (q *Queries) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenByHash, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.FamilyID,
+		&i.UserID,
+		&i.ClientID,
+		&i.Scope,
+		&i.AuthTime,
+		&i.Amr,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+		&i.SsoSessionID,
+	)
+	return i, err
+}
+
+const getSSOSessionByHash = `-- name: GetSSOSessionByHash :one
+SELECT id, user_id, token_hash, amr, auth_time, expires_at, created_at, sid FROM sso_sessions WHERE token_hash = ?
+`
+
+func (q *Queries) GetSSOSessionByHash(ctx context.Context, tokenHash string) (SsoSession, error) {
+	row := q.db.QueryRowContext(ctx, getSSOSessionByHash, tokenHash)
+	var i SsoSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.Amr,
+		&i.AuthTime,
+		&i.ExpiresAt,
 		&i.CreatedAt,
+		&i.Sid,
+	)
+	return i, err
+}
+
+const getSSOSessionByID = `-- name: GetSSOSessionByID :one
+SELECT id, user_id, token_hash, amr, auth_time, expires_at, created_at, sid FROM sso_sessions WHERE id = ?
+`
+
+func (q *Queries) GetSSOSessionByID(ctx context.Context, id int64) (SsoSession, error) {
+	row := q.db.QueryRowContext(ctx, getSSOSessionByID, id)
+	var i SsoSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.Amr,
+		&i.AuthTime,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.Sid,
 	)
 	return i, err
 }
 
 const getSessionByAuthCode = `-- name: GetSessionByAuthCode :one
-SELECT s.id, s.session_id, s.user_id, s.auth_code, s.client_id, s.pkce_challenge, s.pkce_challenge_method, s.state, s.redirect_uri, s.created_at, s.expires_at, u.email as user_email
+SELECT s.id, s.session_id, s.user_id, s.auth_code, s.client_id, s.pkce_challenge, s.pkce_challenge_method, s.state, s.redirect_uri, s.scope, s.nonce, s.auth_time, s.mfa_user_id, s.amr, s.prompt, s.login_hint, s.sso_session_id, s.created_at, s.expires_at, u.email as user_email
 FROM sessions s
 LEFT JOIN users u ON s.user_id = u.id
 WHERE s.auth_code = ?
@@ -136,6 +662,14 @@ type GetSessionByAuthCodeRow struct {
 	PkceChallengeMethod string
 	State               string
 	RedirectUri         string
+	Scope               string
+	Nonce               string
+	AuthTime            sql.NullTime
+	MfaUserID           sql.NullInt64
+	Amr                 string
+	Prompt              string
+	LoginHint           string
+	SsoSessionID        sql.NullInt64
 	CreatedAt           sql.NullTime
 	ExpiresAt           time.Time
 	UserEmail           sql.NullString
@@ -154,6 +688,14 @@ func (q *Queries) GetSessionByAuthCode(ctx context.Context, authCode string) (Ge
 		&i.PkceChallengeMethod,
 		&i.State,
 		&i.RedirectUri,
+		&i.Scope,
+		&i.Nonce,
+		&i.AuthTime,
+		&i.MfaUserID,
+		&i.Amr,
+		&i.Prompt,
+		&i.LoginHint,
+		&i.SsoSessionID,
 		&i.CreatedAt,
 		&i.ExpiresAt,
 		&i.UserEmail,
@@ -161,6 +703,24 @@ func (q *Queries) GetSessionByAuthCode(ctx context.Context, authCode string) (Ge
 	return i, err
 }
 
+const getTOTPCredentialByUserID = `-- name: GetTOTPCredentialByUserID :one
+SELECT id, user_id, secret, confirmed_at, last_used_step, created_at FROM totp_credentials WHERE user_id = ?
+`
+
+func (q *Queries) GetTOTPCredentialByUserID(ctx context.Context, userID int64) (TotpCredential, error) {
+	row := q.db.QueryRowContext(ctx, getTOTPCredentialByUserID, userID)
+	var i TotpCredential
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const getUserByAuthCode = `-- name: GetUserByAuthCode :one
 SELECT u.id, u.email, u.password 
 FROM users u
@@ -182,25 +742,37 @@ func (q *Queries) GetUserByAuthCode(ctx context.Context, authCode string) (GetUs
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, uuid, email, firstname, lastname, password FROM users WHERE email = ?
+SELECT id, uuid, namespace_id, email, firstname, lastname, password, email_verified, verification_sent_at, failed_login_attempts, last_failed_login_at, locked_until, disabled_at FROM users WHERE namespace_id = ? AND email = ?
 `
 
-func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+type GetUserByEmailParams struct {
+	NamespaceID int64
+	Email       string
+}
+
+func (q *Queries) GetUserByEmail(ctx context.Context, arg GetUserByEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, arg.NamespaceID, arg.Email)
 	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.Uuid,
+		&i.NamespaceID,
 		&i.Email,
 		&i.Firstname,
 		&i.Lastname,
 		&i.Password,
+		&i.EmailVerified,
+		&i.VerificationSentAt,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, uuid, email, firstname, lastname, password FROM users WHERE id = ?
+SELECT id, uuid, namespace_id, email, firstname, lastname, password, email_verified, verification_sent_at, failed_login_attempts, last_failed_login_at, locked_until, disabled_at FROM users WHERE id = ?
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id int64) (User, error) {
@@ -209,16 +781,23 @@ func (q *Queries) GetUserByID(ctx context.Context, id int64) (User, error) {
 	err := row.Scan(
 		&i.ID,
 		&i.Uuid,
+		&i.NamespaceID,
 		&i.Email,
 		&i.Firstname,
 		&i.Lastname,
 		&i.Password,
+		&i.EmailVerified,
+		&i.VerificationSentAt,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
 const getUserByUUID = `-- name: GetUserByUUID :one
-SELECT id, uuid, email, firstname, lastname, password FROM users WHERE uuid = ?
+SELECT id, uuid, namespace_id, email, firstname, lastname, password, email_verified, verification_sent_at, failed_login_attempts, last_failed_login_at, locked_until, disabled_at FROM users WHERE uuid = ?
 `
 
 func (q *Queries) GetUserByUUID(ctx context.Context, uuid string) (User, error) {
@@ -227,81 +806,727 @@ func (q *Queries) GetUserByUUID(ctx context.Context, uuid string) (User, error)
 	err := row.Scan(
 		&i.ID,
 		&i.Uuid,
+		&i.NamespaceID,
 		&i.Email,
 		&i.Firstname,
 		&i.Lastname,
 		&i.Password,
+		&i.EmailVerified,
+		&i.VerificationSentAt,
+		&i.FailedLoginAttempts,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
-const getUserSession = `-- name: GetUserSession :one
-SELECT s.id, s.user_id, s.expires_at, u.email as user_email
-FROM sessions s
-JOIN users u ON s.user_id = u.id
-WHERE s.session_id = UUID_TO_BIN(?)
+const getWebAuthnChallenge = `-- name: GetWebAuthnChallenge :one
+SELECT id, challenge, ceremony, user_id, expires_at, created_at FROM webauthn_challenges WHERE challenge = ?
 `
 
-type GetUserSessionRow struct {
-	ID        int64
-	UserID    sql.NullInt64
-	ExpiresAt time.Time
-	UserEmail string
-}
-
-func (q *Queries) GetUserSession(ctx context.Context, uuidTOBIN string) (GetUserSessionRow, error) {
-	row := q.db.QueryRowContext(ctx, getUserSession, uuidTOBIN)
-	var i GetUserSessionRow
+func (q *Queries) GetWebAuthnChallenge(ctx context.Context, challenge string) (WebauthnChallenge, error) {
+	row := q.db.QueryRowContext(ctx, getWebAuthnChallenge, challenge)
+	var i WebauthnChallenge
 	err := row.Scan(
 		&i.ID,
+		&i.Challenge,
+		&i.Ceremony,
 		&i.UserID,
 		&i.ExpiresAt,
-		&i.UserEmail,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
-const getUserSessionByUserID = `-- name: GetUserSessionByUserID :one
-SELECT s.id, BIN_TO_UUID(s.session_id) as session_id, s.user_id, s.expires_at, u.email as user_email
-FROM sessions s
-JOIN users u ON s.user_id = u.id
-WHERE s.user_id = ?
-ORDER BY s.created_at DESC LIMIT 1
+const getWebAuthnCredentialByCredentialID = `-- name: GetWebAuthnCredentialByCredentialID :one
+SELECT id, user_id, credential_id, public_key, sign_count, aaguid, attestation_format, transports, name, last_used_at, created_at FROM webauthn_credentials WHERE credential_id = ?
 `
 
-type GetUserSessionByUserIDRow struct {
-	ID        int64
-	SessionID string
-	UserID    sql.NullInt64
-	ExpiresAt time.Time
-	UserEmail string
-}
-
-func (q *Queries) GetUserSessionByUserID(ctx context.Context, userID sql.NullInt64) (GetUserSessionByUserIDRow, error) {
-	row := q.db.QueryRowContext(ctx, getUserSessionByUserID, userID)
-	var i GetUserSessionByUserIDRow
+func (q *Queries) GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (WebauthnCredential, error) {
+	row := q.db.QueryRowContext(ctx, getWebAuthnCredentialByCredentialID, credentialID)
+	var i WebauthnCredential
 	err := row.Scan(
 		&i.ID,
-		&i.SessionID,
 		&i.UserID,
-		&i.ExpiresAt,
-		&i.UserEmail,
+		&i.CredentialID,
+		&i.PublicKey,
+		&i.SignCount,
+		&i.Aaguid,
+		&i.AttestationFormat,
+		&i.Transports,
+		&i.Name,
+		&i.LastUsedAt,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
+const incrementRateLimitCounter = `-- name: IncrementRateLimitCounter :execresult
+INSERT INTO rate_limit_counters (bucket, expires_at) VALUES (?, ?)
+ON DUPLICATE KEY UPDATE count = LAST_INSERT_ID(count + 1)
+`
+
+type IncrementRateLimitCounterParams struct {
+	Bucket    string
+	ExpiresAt time.Time
+}
+
+// LAST_INSERT_ID(expr) hands the incremented count back without a second query
+func (q *Queries) IncrementRateLimitCounter(ctx context.Context, arg IncrementRateLimitCounterParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, incrementRateLimitCounter, arg.Bucket, arg.ExpiresAt)
+}
+
+const isTokenRevoked = `-- name: IsTokenRevoked :one
+SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?
+`
+
+func (q *Queries) IsTokenRevoked(ctx context.Context, jti string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, isTokenRevoked, jti)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const listClientRedirectURIs = `-- name: ListClientRedirectURIs :many
+SELECT redirect_uri FROM client_redirect_uris WHERE client_id = ?
+`
+
+func (q *Queries) ListClientRedirectURIs(ctx context.Context, clientID int64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listClientRedirectURIs, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var redirect_uri string
+		if err := rows.Scan(&redirect_uri); err != nil {
+			return nil, err
+		}
+		items = append(items, redirect_uri)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listClients = `-- name: ListClients :many
+SELECT id, namespace, name, client_secret, allowed_scopes, user_pool, require_email_verification, created_at, backchannel_logout_uri, frontchannel_logout_uri FROM clients ORDER BY id
+`
+
+func (q *Queries) ListClients(ctx context.Context) ([]Client, error) {
+	rows, err := q.db.QueryContext(ctx, listClients)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Client
+	for rows.Next() {
+		var i Client
+		if err := rows.Scan(
+			&i.ID,
+			&i.Namespace,
+			&i.Name,
+			&i.ClientSecret,
+			&i.AllowedScopes,
+			&i.UserPool,
+			&i.RequireEmailVerification,
+			&i.CreatedAt,
+			&i.BackchannelLogoutUri,
+			&i.FrontchannelLogoutUri,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPublishedSigningKeys = `-- name: ListPublishedSigningKeys :many
+SELECT id, kid, algorithm, private_key, status, created_at, rotated_at FROM signing_keys
+WHERE status IN ('active', 'retiring')
+ORDER BY created_at DESC, id DESC
+`
+
+func (q *Queries) ListPublishedSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	rows, err := q.db.QueryContext(ctx, listPublishedSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SigningKey
+	for rows.Next() {
+		var i SigningKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kid,
+			&i.Algorithm,
+			&i.PrivateKey,
+			&i.Status,
+			&i.CreatedAt,
+			&i.RotatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSSOSessionAccessTokens = `-- name: ListSSOSessionAccessTokens :many
+SELECT id, jti, user_id, sso_session_id, expires_at, created_at FROM access_tokens WHERE sso_session_id = ? AND expires_at > ?
+`
+
+type ListSSOSessionAccessTokensParams struct {
+	SsoSessionID sql.NullInt64
+	ExpiresAt    time.Time
+}
+
+func (q *Queries) ListSSOSessionAccessTokens(ctx context.Context, arg ListSSOSessionAccessTokensParams) ([]AccessToken, error) {
+	rows, err := q.db.QueryContext(ctx, listSSOSessionAccessTokens, arg.SsoSessionID, arg.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AccessToken
+	for rows.Next() {
+		var i AccessToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.Jti,
+			&i.UserID,
+			&i.SsoSessionID,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSSOSessionClients = `-- name: ListSSOSessionClients :many
+SELECT c.id, c.namespace, c.name, c.client_secret, c.allowed_scopes, c.user_pool, c.require_email_verification, c.created_at, c.backchannel_logout_uri, c.frontchannel_logout_uri FROM clients c
+JOIN sso_session_clients sc ON sc.client_id = c.id
+WHERE sc.sso_session_id = ?
+ORDER BY c.id
+`
+
+func (q *Queries) ListSSOSessionClients(ctx context.Context, ssoSessionID int64) ([]Client, error) {
+	rows, err := q.db.QueryContext(ctx, listSSOSessionClients, ssoSessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Client
+	for rows.Next() {
+		var i Client
+		if err := rows.Scan(
+			&i.ID,
+			&i.Namespace,
+			&i.Name,
+			&i.ClientSecret,
+			&i.AllowedScopes,
+			&i.UserPool,
+			&i.RequireEmailVerification,
+			&i.CreatedAt,
+			&i.BackchannelLogoutUri,
+			&i.FrontchannelLogoutUri,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnusedRecoveryCodes = `-- name: ListUnusedRecoveryCodes :many
+SELECT id, user_id, code_hash, used_at, created_at FROM recovery_codes WHERE user_id = ? AND used_at IS NULL
+`
+
+func (q *Queries) ListUnusedRecoveryCodes(ctx context.Context, userID int64) ([]RecoveryCode, error) {
+	rows, err := q.db.QueryContext(ctx, listUnusedRecoveryCodes, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RecoveryCode
+	for rows.Next() {
+		var i RecoveryCode
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CodeHash,
+			&i.UsedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, uuid, namespace_id, email, firstname, lastname, password, email_verified, verification_sent_at, failed_login_attempts, last_failed_login_at, locked_until, disabled_at FROM users WHERE namespace_id = ? ORDER BY id
+`
+
+func (q *Queries) ListUsers(ctx context.Context, namespaceID int64) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers, namespaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Uuid,
+			&i.NamespaceID,
+			&i.Email,
+			&i.Firstname,
+			&i.Lastname,
+			&i.Password,
+			&i.EmailVerified,
+			&i.VerificationSentAt,
+			&i.FailedLoginAttempts,
+			&i.LastFailedLoginAt,
+			&i.LockedUntil,
+			&i.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebAuthnCredentialsByUserID = `-- name: ListWebAuthnCredentialsByUserID :many
+SELECT id, user_id, credential_id, public_key, sign_count, aaguid, attestation_format, transports, name, last_used_at, created_at FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at
+`
+
+func (q *Queries) ListWebAuthnCredentialsByUserID(ctx context.Context, userID int64) ([]WebauthnCredential, error) {
+	rows, err := q.db.QueryContext(ctx, listWebAuthnCredentialsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CredentialID,
+			&i.PublicKey,
+			&i.SignCount,
+			&i.Aaguid,
+			&i.AttestationFormat,
+			&i.Transports,
+			&i.Name,
+			&i.LastUsedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUser = `-- name: LockUser :execrows
+UPDATE users
+SET locked_until = ?, failed_login_attempts = 0
+WHERE id = ? AND (locked_until IS NULL OR locked_until < ?)
+`
+
+type LockUserParams struct {
+	LockedUntil   sql.NullTime
+	ID            int64
+	LockedUntil_2 sql.NullTime
+}
+
+func (q *Queries) LockUser(ctx context.Context, arg LockUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, lockUser, arg.LockedUntil, arg.ID, arg.LockedUntil_2)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markPasswordResetTokenUsed = `-- name: MarkPasswordResetTokenUsed :execrows
+UPDATE password_reset_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND used_at IS NULL
+`
+
+func (q *Queries) MarkPasswordResetTokenUsed(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPasswordResetTokenUsed, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markRecoveryCodeUsed = `-- name: MarkRecoveryCodeUsed :execrows
+UPDATE recovery_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND used_at IS NULL
+`
+
+func (q *Queries) MarkRecoveryCodeUsed(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markRecoveryCodeUsed, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markRefreshTokenUsed = `-- name: MarkRefreshTokenUsed :execrows
+UPDATE refresh_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND used_at IS NULL
+`
+
+func (q *Queries) MarkRefreshTokenUsed(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markRefreshTokenUsed, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markSigningKeyRetiring = `-- name: MarkSigningKeyRetiring :execrows
+UPDATE signing_keys
+SET status = 'retiring', rotated_at = CURRENT_TIMESTAMP
+WHERE kid = ? AND status = 'active'
+`
+
+func (q *Queries) MarkSigningKeyRetiring(ctx context.Context, kid string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markSigningKeyRetiring, kid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markVerificationSent = `-- name: MarkVerificationSent :execrows
+UPDATE users
+SET verification_sent_at = CURRENT_TIMESTAMP
+WHERE id = ? AND (verification_sent_at IS NULL OR verification_sent_at < ?)
+`
+
+type MarkVerificationSentParams struct {
+	ID                 int64
+	VerificationSentAt sql.NullTime
+}
+
+func (q *Queries) MarkVerificationSent(ctx context.Context, arg MarkVerificationSentParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markVerificationSent, arg.ID, arg.VerificationSentAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const recordFailedLogin = `-- name: RecordFailedLogin :exec
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1, last_failed_login_at = ?
+WHERE id = ?
+`
+
+type RecordFailedLoginParams struct {
+	LastFailedLoginAt sql.NullTime
+	ID                int64
+}
+
+func (q *Queries) RecordFailedLogin(ctx context.Context, arg RecordFailedLoginParams) error {
+	_, err := q.db.ExecContext(ctx, recordFailedLogin, arg.LastFailedLoginAt, arg.ID)
+	return err
+}
+
+const releasePasswordResetToken = `-- name: ReleasePasswordResetToken :exec
+UPDATE password_reset_tokens SET used_at = NULL WHERE id = ?
+`
+
+func (q *Queries) ReleasePasswordResetToken(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, releasePasswordResetToken, id)
+	return err
+}
+
+const retireSigningKeys = `-- name: RetireSigningKeys :exec
+UPDATE signing_keys
+SET status = 'retired'
+WHERE status = 'retiring' AND rotated_at < ?
+`
+
+func (q *Queries) RetireSigningKeys(ctx context.Context, rotatedAt sql.NullTime) error {
+	_, err := q.db.ExecContext(ctx, retireSigningKeys, rotatedAt)
+	return err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE family_id = ? AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeSSOSessionRefreshTokens = `-- name: RevokeSSOSessionRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE sso_session_id = ? AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeSSOSessionRefreshTokens(ctx context.Context, ssoSessionID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, revokeSSOSessionRefreshTokens, ssoSessionID)
+	return err
+}
+
+const revokeToken = `-- name: RevokeToken :exec
+INSERT IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)
+`
+
+type RevokeTokenParams struct {
+	Jti       string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) RevokeToken(ctx context.Context, arg RevokeTokenParams) error {
+	_, err := q.db.ExecContext(ctx, revokeToken, arg.Jti, arg.ExpiresAt)
+	return err
+}
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRefreshTokens, userID)
+	return err
+}
+
+const setSessionMFAPending = `-- name: SetSessionMFAPending :exec
+UPDATE sessions SET mfa_user_id = ? WHERE auth_code = ?
+`
+
+type SetSessionMFAPendingParams struct {
+	MfaUserID sql.NullInt64
+	AuthCode  string
+}
+
+func (q *Queries) SetSessionMFAPending(ctx context.Context, arg SetSessionMFAPendingParams) error {
+	_, err := q.db.ExecContext(ctx, setSessionMFAPending, arg.MfaUserID, arg.AuthCode)
+	return err
+}
+
+const setUserEmailVerified = `-- name: SetUserEmailVerified :exec
+UPDATE users SET email_verified = TRUE WHERE id = ?
+`
+
+func (q *Queries) SetUserEmailVerified(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, setUserEmailVerified, id)
+	return err
+}
+
+const unlockUser = `-- name: UnlockUser :exec
+UPDATE users
+SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL
+WHERE id = ?
+`
+
+func (q *Queries) UnlockUser(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, unlockUser, id)
+	return err
+}
+
+const updateClient = `-- name: UpdateClient :exec
+UPDATE clients
+SET name = ?, client_secret = ?, allowed_scopes = ?, user_pool = ?, require_email_verification = ?,
+  backchannel_logout_uri = ?, frontchannel_logout_uri = ?
+WHERE id = ?
+`
+
+type UpdateClientParams struct {
+	Name                     string
+	ClientSecret             sql.NullString
+	AllowedScopes            string
+	UserPool                 string
+	RequireEmailVerification bool
+	BackchannelLogoutUri     string
+	FrontchannelLogoutUri    string
+	ID                       int64
+}
+
+func (q *Queries) UpdateClient(ctx context.Context, arg UpdateClientParams) error {
+	_, err := q.db.ExecContext(ctx, updateClient,
+		arg.Name,
+		arg.ClientSecret,
+		arg.AllowedScopes,
+		arg.UserPool,
+		arg.RequireEmailVerification,
+		arg.BackchannelLogoutUri,
+		arg.FrontchannelLogoutUri,
+		arg.ID,
+	)
+	return err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET password = ? WHERE id = ?
+`
+
+type UpdateUserPasswordParams struct {
+	Password string
+	ID       int64
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.Password, arg.ID)
+	return err
+}
+
 const updateUserSession = `-- name: UpdateUserSession :exec
 UPDATE sessions 
-SET user_id = ?
+SET user_id = ?, amr = ?, mfa_user_id = NULL, auth_time = ?, sso_session_id = ?
 WHERE auth_code = ?
 `
 
 type UpdateUserSessionParams struct {
-	UserID   sql.NullInt64
-	AuthCode string
+	UserID       sql.NullInt64
+	Amr          string
+	AuthTime     sql.NullTime
+	SsoSessionID sql.NullInt64
+	AuthCode     string
 }
 
 func (q *Queries) UpdateUserSession(ctx context.Context, arg UpdateUserSessionParams) error {
-	_, err := q.db.ExecContext(ctx, updateUserSession, arg.UserID, arg.AuthCode)
+	_, err := q.db.ExecContext(ctx, updateUserSession,
+		arg.UserID,
+		arg.Amr,
+		arg.AuthTime,
+		arg.SsoSessionID,
+		arg.AuthCode,
+	)
+	return err
+}
+
+const updateWebAuthnSignCount = `-- name: UpdateWebAuthnSignCount :exec
+UPDATE webauthn_credentials SET sign_count = ?, last_used_at = CURRENT_TIMESTAMP WHERE id = ?
+`
+
+type UpdateWebAuthnSignCountParams struct {
+	SignCount int64
+	ID        int64
+}
+
+func (q *Queries) UpdateWebAuthnSignCount(ctx context.Context, arg UpdateWebAuthnSignCountParams) error {
+	_, err := q.db.ExecContext(ctx, updateWebAuthnSignCount, arg.SignCount, arg.ID)
+	return err
+}
+
+const upsertConsent = `-- name: UpsertConsent :exec
+INSERT INTO consents (user_id, client_id, scope) VALUES (?, ?, ?)
+ON DUPLICATE KEY UPDATE scope = VALUES(scope)
+`
+
+type UpsertConsentParams struct {
+	UserID   int64
+	ClientID int64
+	Scope    string
+}
+
+func (q *Queries) UpsertConsent(ctx context.Context, arg UpsertConsentParams) error {
+	_, err := q.db.ExecContext(ctx, upsertConsent, arg.UserID, arg.ClientID, arg.Scope)
 	return err
 }
+
+const upsertTOTPCredential = `-- name: UpsertTOTPCredential :exec
+INSERT INTO totp_credentials (user_id, secret) VALUES (?, ?)
+ON DUPLICATE KEY UPDATE secret = VALUES(secret), confirmed_at = NULL, last_used_step = 0
+`
+
+type UpsertTOTPCredentialParams struct {
+	UserID int64
+	Secret string
+}
+
+func (q *Queries) UpsertTOTPCredential(ctx context.Context, arg UpsertTOTPCredentialParams) error {
+	_, err := q.db.ExecContext(ctx, upsertTOTPCredential, arg.UserID, arg.Secret)
+	return err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE totp_credentials
+SET last_used_step = ?
+WHERE user_id = ? AND last_used_step < ?
+`
+
+type UseTOTPStepParams struct {
+	LastUsedStep   int64
+	UserID         int64
+	LastUsedStep_2 int64
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.LastUsedStep, arg.UserID, arg.LastUsedStep_2)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,259 @@
+package keys
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"crypto"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadInterval is how often keys are re-read so rotations done by other instances are picked up
+const reloadInterval = time.Minute
+
+// minUnknownKidReload limits how often an unknown kid may force a reload
+const minUnknownKidReload = 10 * time.Second
+
+// pemPrefix starts private keys stored before they were encrypted, or without an encryption key
+const pemPrefix = "-----BEGIN"
+
+// Manager keeps the signing keys in utils in sync with the signing_keys table
+// and rotates the active key once it is older than the rotation interval.
+//
+// A key moves from active to retiring when it is replaced and stays published
+// for the overlap window so tokens it signed keep validating, after which it
+// is retired and no longer accepted.
+type Manager struct {
+	db               *db.Db
+	algorithm        string
+	rotationInterval time.Duration
+	overlap          time.Duration
+	// allowUnencrypted stores new keys as plain PEM when no secret key is set, instead of failing
+	allowUnencrypted bool
+
+	mu         sync.Mutex
+	lastReload time.Time
+}
+
+func NewManager(db *db.Db, algorithm string, rotationInterval, overlap time.Duration, allowUnencrypted bool) (*Manager, error) {
+	if !slices.Contains(utils.SupportedSigningAlgorithms, algorithm) {
+		return nil, fmt.Errorf("unsupported signing algorithm %q, expected one of %v", algorithm, utils.SupportedSigningAlgorithms)
+	}
+	if rotationInterval <= 0 {
+		return nil, fmt.Errorf("key rotation interval must be positive")
+	}
+	if overlap < utils.AccessTokenLifetime {
+		return nil, fmt.Errorf("key rotation overlap %v must be at least the access token lifetime %v", overlap, utils.AccessTokenLifetime)
+	}
+
+	return &Manager{
+		db:               db,
+		algorithm:        algorithm,
+		rotationInterval: rotationInterval,
+		overlap:          overlap,
+		allowUnencrypted: allowUnencrypted,
+	}, nil
+}
+
+// Start makes sure an active key exists and keeps rotating and reloading keys until ctx is done
+func (m *Manager) Start(ctx context.Context) error {
+	if err := m.maintain(ctx); err != nil {
+		return err
+	}
+
+	utils.SetUnknownKeyHandler(m.reloadForUnknownKid)
+
+	go func() {
+		ticker := time.NewTicker(reloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.maintain(ctx); err != nil {
+					log.Printf("Error maintaining signing keys: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Rotate replaces the active signing key with a newly generated one
+func (m *Manager) Rotate(ctx context.Context) error {
+	keys, err := m.db.Queries.ListPublishedSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The new key exists before the old one is retired, so other instances reloading in between
+	// still find an active key and a failure to create one leaves the old key in use
+	if err := m.createKey(ctx); err != nil {
+		return err
+	}
+
+	// Instances rotating at the same time each add a key, maintain keeps only the newest active
+	for _, key := range activeKeys(keys) {
+		if _, err := m.db.Queries.MarkSigningKeyRetiring(ctx, key.Kid); err != nil {
+			return err
+		}
+	}
+	return m.Load(ctx)
+}
+
+// Load reads the published keys from the database into utils
+func (m *Manager) Load(ctx context.Context) error {
+	keys, err := m.db.Queries.ListPublishedSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	var active *utils.SigningKey
+	var verify []utils.SigningKey
+	for _, key := range keys {
+		// Keys are ordered newest first, so the first active key is the one we sign with
+		signing := key.Status == "active" && active == nil
+
+		signer, err := decodeStoredKey(key.PrivateKey)
+		if err != nil {
+			// A key written by an instance with another MFA_ENCRYPTION_KEY can be skipped unless it is the one
+			// to sign with, the service would run without being able to issue tokens otherwise
+			if signing || errors.Is(err, utils.ErrNoSecretKey) {
+				return fmt.Errorf("signing key %s is unusable: %w", key.Kid, err)
+			}
+			log.Printf("Skipping unusable signing key %s: %v", key.Kid, err)
+			continue
+		}
+
+		signingKey := utils.SigningKey{Kid: key.Kid, Algorithm: key.Algorithm, Signer: signer}
+		if signing {
+			active = &signingKey
+			continue
+		}
+		verify = append(verify, signingKey)
+	}
+
+	utils.SetSigningKeys(active, verify)
+
+	m.mu.Lock()
+	m.lastReload = time.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
+// maintain retires keys past the overlap window, rotates the active key when it is due and reloads
+func (m *Manager) maintain(ctx context.Context) error {
+	err := m.db.Queries.RetireSigningKeys(ctx, sql.NullTime{Time: time.Now().Add(-m.overlap), Valid: true})
+	if err != nil {
+		return err
+	}
+
+	keys, err := m.db.Queries.ListPublishedSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	active := activeKeys(keys)
+	switch {
+	case len(active) == 0:
+		log.Printf("No active signing key found, generating a new %s key", m.algorithm)
+		if err := m.createKey(ctx); err != nil {
+			return err
+		}
+	case time.Since(active[0].CreatedAt) > m.rotationInterval:
+		log.Printf("Signing key %s is older than %v, rotating", active[0].Kid, m.rotationInterval)
+		return m.Rotate(ctx)
+	}
+
+	// Instances starting at the same time may each have created a key, keep only the newest active
+	for _, key := range active[min(1, len(active)):] {
+		if _, err := m.db.Queries.MarkSigningKeyRetiring(ctx, key.Kid); err != nil {
+			return err
+		}
+	}
+
+	return m.Load(ctx)
+}
+
+func (m *Manager) createKey(ctx context.Context) error {
+	signer, err := utils.GenerateSigningKey(m.algorithm)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := utils.EncodeSigningKey(signer)
+	if err != nil {
+		return err
+	}
+
+	kid, err := utils.GenerateKeyID()
+	if err != nil {
+		return err
+	}
+
+	// Encrypted with the key protecting TOTP secrets, a copy of the database alone can't sign tokens
+	stored, err := utils.EncryptSecret(encoded)
+	switch {
+	case errors.Is(err, utils.ErrNoSecretKey) && m.allowUnencrypted:
+		log.Printf("MFA_ENCRYPTION_KEY is not set, storing signing key %s unencrypted as configured", kid)
+		stored = encoded
+	case errors.Is(err, utils.ErrNoSecretKey):
+		return fmt.Errorf("refusing to store signing key %s unencrypted: %w", kid, err)
+	case err != nil:
+		return err
+	}
+
+	return m.db.Queries.CreateSigningKey(ctx, dbcommon.CreateSigningKeyParams{
+		Kid:        kid,
+		Algorithm:  m.algorithm,
+		PrivateKey: stored,
+	})
+}
+
+// decodeStoredKey decrypts and decodes a private key as stored by createKey. Keys stored as plain PEM,
+// before encryption or without an encryption key, are decoded as they are and phased out by rotation.
+func decodeStoredKey(stored string) (crypto.Signer, error) {
+	encoded := stored
+	if !strings.HasPrefix(stored, pemPrefix) {
+		var err error
+		if encoded, err = utils.DecryptSecret(stored); err != nil {
+			return nil, err
+		}
+	}
+	return utils.DecodeSigningKey(encoded)
+}
+
+func (m *Manager) reloadForUnknownKid() {
+	m.mu.Lock()
+	recent := time.Since(m.lastReload) < minUnknownKidReload
+	m.mu.Unlock()
+	if recent {
+		return
+	}
+
+	if err := m.Load(context.Background()); err != nil {
+		log.Printf("Error reloading signing keys: %v", err)
+	}
+}
+
+func activeKeys(keys []dbcommon.SigningKey) []dbcommon.SigningKey {
+	var active []dbcommon.SigningKey
+	for _, key := range keys {
+		if key.Status == "active" {
+			active = append(active, key)
+		}
+	}
+	return active
+}
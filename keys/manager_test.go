@@ -0,0 +1,220 @@
+package keys
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signedKid signs an access token with the active key, checks it validates and returns its kid
+func signedKid(t *testing.T) string {
+	t.Helper()
+
+	token, err := utils.GenerateJWT(utils.AccessTokenParams{UserUUID: "user", ClientID: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := utils.ValidateJWT(token); err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// TestSigningKeysRequireEncryption runs before any test sets the secret key, which can't be unset
+func TestSigningKeysRequireEncryption(t *testing.T) {
+	ctx := context.Background()
+	if _, err := utils.EncryptSecret("probe"); !errors.Is(err, utils.ErrNoSecretKey) {
+		t.Skip("a secret key is already set")
+	}
+
+	for _, allowUnencrypted := range []bool{false, true} {
+		store := db.NewMemoryStore()
+		manager, err := NewManager(db.NewDb(store), "ES256", time.Hour, utils.AccessTokenLifetime, allowUnencrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = manager.Rotate(ctx)
+		published, _ := store.ListPublishedSigningKeys(ctx)
+
+		if !allowUnencrypted {
+			if !errors.Is(err, utils.ErrNoSecretKey) || len(published) != 0 {
+				t.Errorf("without a secret key rotating got %v and stored %d keys, want it refused", err, len(published))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(published) != 1 || !strings.HasPrefix(published[0].PrivateKey, pemPrefix) {
+			t.Errorf("allowed to store keys unencrypted, got %+v", published)
+		}
+	}
+}
+
+func TestSigningKeysEncryptedAtRest(t *testing.T) {
+	ctx := context.Background()
+	if err := utils.SetSecretKey(bytes.Repeat([]byte{7}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	store := db.NewMemoryStore()
+	manager, err := NewManager(db.NewDb(store), "ES256", time.Hour, utils.AccessTokenLifetime, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A key stored as plain PEM before keys were encrypted keeps working until it is rotated out
+	signer, err := utils.GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := utils.EncodeSigningKey(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreateSigningKey(ctx, dbcommon.CreateSigningKeyParams{Kid: "legacy", Algorithm: "ES256", PrivateKey: encoded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if kid := signedKid(t); kid != "legacy" {
+		t.Fatalf("signed with key %q, want the plain PEM key", kid)
+	}
+
+	if err := manager.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	published, err := store.ListPublishedSigningKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var active dbcommon.SigningKey
+	for _, key := range published {
+		if key.Status == "active" {
+			active = key
+		}
+	}
+	if active.Kid == "" || active.Kid == "legacy" {
+		t.Fatalf("rotation did not create a new active key: %+v", published)
+	}
+	if strings.Contains(active.PrivateKey, "PRIVATE KEY") {
+		t.Error("the new signing key was stored unencrypted")
+	}
+	if kid := signedKid(t); kid != active.Kid {
+		t.Errorf("signed with key %q, want the encrypted key %q", kid, active.Kid)
+	}
+}
+
+// failingCreate reports how many keys were active when a key was created, then fails to store it
+type failingCreate struct {
+	db.Store
+	activeAtCreate *int
+}
+
+func (s failingCreate) CreateSigningKey(ctx context.Context, arg dbcommon.CreateSigningKeyParams) error {
+	published, err := s.Store.ListPublishedSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	*s.activeAtCreate = len(activeKeys(published))
+	return errors.New("database is gone")
+}
+
+func TestRotateKeepsActiveKey(t *testing.T) {
+	ctx := context.Background()
+	if err := utils.SetSecretKey(bytes.Repeat([]byte{7}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	store := db.NewMemoryStore()
+	database := db.NewDb(store)
+	manager, err := NewManager(database, "ES256", time.Hour, utils.AccessTokenLifetime, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	kid := signedKid(t)
+
+	var activeAtCreate int
+	database.Queries = failingCreate{Store: store, activeAtCreate: &activeAtCreate}
+	if err := manager.Rotate(ctx); err == nil {
+		t.Fatal("rotation succeeded without storing the new key")
+	}
+	database.Queries = store
+
+	if activeAtCreate != 1 {
+		t.Errorf("%d keys were active while the new key was created, want the old one", activeAtCreate)
+	}
+	published, err := store.ListPublishedSigningKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active := activeKeys(published); len(active) != 1 || active[0].Kid != kid {
+		t.Errorf("after a failed rotation the active keys are %+v, want %s", active, kid)
+	}
+	if err := manager.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := signedKid(t); got != kid {
+		t.Errorf("signed with key %q after a failed rotation, want %q", got, kid)
+	}
+}
+
+func TestLoadRefusesUnusableActiveKey(t *testing.T) {
+	ctx := context.Background()
+	if err := utils.SetSecretKey(bytes.Repeat([]byte{7}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	store := db.NewMemoryStore()
+	manager, err := NewManager(db.NewDb(store), "ES256", time.Hour, utils.AccessTokenLifetime, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	kid := signedKid(t)
+
+	// Encrypted with another key, as a replica with a different MFA_ENCRYPTION_KEY would store it
+	undecryptable := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 64))
+
+	// An older key nobody signs with any more is skipped
+	err = store.CreateSigningKey(ctx, dbcommon.CreateSigningKeyParams{Kid: "old", Algorithm: "ES256", PrivateKey: undecryptable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.MarkSigningKeyRetiring(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Load(ctx); err != nil {
+		t.Fatalf("an unusable retiring key failed the load: %v", err)
+	}
+
+	// The newest active key can't be, and the keys loaded before stay in use
+	err = store.CreateSigningKey(ctx, dbcommon.CreateSigningKeyParams{Kid: "new", Algorithm: "ES256", PrivateKey: undecryptable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Load(ctx); err == nil {
+		t.Error("loaded keys without being able to use the active one")
+	}
+	if got := signedKid(t); got != kid {
+		t.Errorf("signed with key %q after the failed load, want %q", got, kid)
+	}
+}
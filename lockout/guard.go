@@ -0,0 +1,12 @@
+// Package lockout slows down and locks accounts after repeated failed logins
+package lockout
+
+// Guard combines the lockout policy with the notifiers told about lockouts
+type Guard struct {
+	Policy   Policy
+	Notifier Notifier
+}
+
+func NewGuard(policy Policy, notifier Notifier) *Guard {
+	return &Guard{Policy: policy, Notifier: notifier}
+}
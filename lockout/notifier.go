@@ -0,0 +1,90 @@
+package lockout
+
+import (
+	"auth_go/mail"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Event describes an account that was just locked
+type Event struct {
+	UserUUID    string    `json:"user_uuid"`
+	Email       string    `json:"email"`
+	NamespaceID int64     `json:"namespace_id"`
+	LockedUntil time.Time `json:"locked_until"`
+	// IP is the address the last failed attempt came from
+	IP string `json:"ip"`
+}
+
+// Notifier is told whenever a lockout triggers
+type Notifier interface {
+	AccountLocked(ctx context.Context, event Event) error
+}
+
+// Notifiers notifies every notifier in turn
+type Notifiers []Notifier
+
+func (n Notifiers) AccountLocked(ctx context.Context, event Event) error {
+	var errs []error
+	for _, notifier := range n {
+		if err := notifier.AccountLocked(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MailNotifier tells the account owner their account was locked
+type MailNotifier struct {
+	Mailer mail.Mailer
+}
+
+func (n MailNotifier) AccountLocked(ctx context.Context, event Event) error {
+	return n.Mailer.Send(ctx, mail.Message{
+		To:      event.Email,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf("Hi,\n\nYour account was locked after too many failed login attempts, the last one from %s. "+
+			"It unlocks automatically at %s.\n\n"+
+			"If this wasn't you, reset your password to unlock your account right away.\n",
+			event.IP, event.LockedUntil.UTC().Format(time.RFC1123)),
+	})
+}
+
+// WebhookNotifier posts lockout events as JSON, e.g. to a security monitoring system
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) WebhookNotifier {
+	return WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n WebhookNotifier) AccountLocked(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("lockout webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package lockout
+
+import (
+	"time"
+)
+
+// Policy decides how failed logins slow down and eventually lock an account
+type Policy struct {
+	// Threshold is the number of consecutive failures that locks the account, zero disables locking
+	Threshold int
+	// Duration is how long a locked account stays locked
+	Duration time.Duration
+	// BackoffAfter is the number of failures allowed before attempts are delayed
+	BackoffAfter int
+	// MaxBackoff caps the delay between attempts
+	MaxBackoff time.Duration
+}
+
+// Backoff returns the delay required after the given number of consecutive failures.
+// It starts at one second and doubles with every further failure.
+func (p Policy) Backoff(failures int) time.Duration {
+	over := failures - p.BackoffAfter
+	if over <= 0 {
+		return 0
+	}
+
+	delay := time.Second
+	for i := 1; i < over && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxBackoff)
+}
+
+// Wait returns how long the account must wait before another attempt is accepted, zero if it may try now
+func (p Policy) Wait(failures int, lastFailure, lockedUntil time.Time, now time.Time) time.Duration {
+	if now.Before(lockedUntil) {
+		return lockedUntil.Sub(now)
+	}
+	if lastFailure.IsZero() {
+		return 0
+	}
+	if next := lastFailure.Add(p.Backoff(failures)); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// ShouldLock reports whether the account must be locked after the given number of consecutive failures
+func (p Policy) ShouldLock(failures int) bool {
+	return p.Threshold > 0 && failures >= p.Threshold
+}
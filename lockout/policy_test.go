@@ -0,0 +1,80 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyBackoff(t *testing.T) {
+	policy := Policy{BackoffAfter: 3, MaxBackoff: 10 * time.Second}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 6, want: 4 * time.Second},
+		{failures: 7, want: 8 * time.Second},
+		{failures: 8, want: 10 * time.Second},
+		{failures: 100, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.failures); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyWait(t *testing.T) {
+	policy := Policy{Threshold: 5, Duration: time.Minute, BackoffAfter: 2, MaxBackoff: 30 * time.Second}
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		failures    int
+		lastFailure time.Time
+		lockedUntil time.Time
+		want        time.Duration
+	}{
+		{name: "no failures", want: 0},
+		{name: "below backoff", failures: 2, lastFailure: now, want: 0},
+		{name: "first backoff", failures: 3, lastFailure: now, want: time.Second},
+		{name: "backoff partly waited", failures: 4, lastFailure: now.Add(-500 * time.Millisecond), want: 1500 * time.Millisecond},
+		{name: "backoff over", failures: 4, lastFailure: now.Add(-2 * time.Second), want: 0},
+		{name: "backoff capped", failures: 40, lastFailure: now, want: 30 * time.Second},
+		{name: "locked", lockedUntil: now.Add(time.Minute), want: time.Minute},
+		{name: "lock outlasts backoff", failures: 3, lastFailure: now, lockedUntil: now.Add(10 * time.Second), want: 10 * time.Second},
+		{name: "lock expired", lastFailure: now.Add(-2 * time.Minute), lockedUntil: now.Add(-time.Second), want: 0},
+		{name: "lock expires now", lockedUntil: now, want: 0},
+	}
+	for _, tt := range tests {
+		if got := policy.Wait(tt.failures, tt.lastFailure, tt.lockedUntil, now); got != tt.want {
+			t.Errorf("%s: Wait = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyShouldLock(t *testing.T) {
+	tests := []struct {
+		threshold int
+		failures  int
+		want      bool
+	}{
+		{threshold: 5, failures: 0, want: false},
+		{threshold: 5, failures: 4, want: false},
+		{threshold: 5, failures: 5, want: true},
+		{threshold: 5, failures: 6, want: true},
+		{threshold: 1, failures: 1, want: true},
+		{threshold: 0, failures: 0, want: false},
+		{threshold: 0, failures: 100, want: false},
+	}
+	for _, tt := range tests {
+		policy := Policy{Threshold: tt.threshold}
+		if got := policy.ShouldLock(tt.failures); got != tt.want {
+			t.Errorf("threshold %d: ShouldLock(%d) = %v, want %v", tt.threshold, tt.failures, got, tt.want)
+		}
+	}
+}
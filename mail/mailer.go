@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"auth_go/config"
+	"context"
+	"fmt"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailer returns the mailer selected by MAIL_DRIVER
+func NewMailer(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mail.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From), nil
+	case "log":
+		return NewLogMailer(cfg.Mail.LogFile), nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_DRIVER %q, expected smtp or log", cfg.Mail.Driver)
+}
@@ -1,47 +1,165 @@
 package main
 
 import (
+	"auth_go/backchannel"
 	"auth_go/config"
 	"auth_go/db"
 	"auth_go/dbcommon"
+	"auth_go/keys"
+	"auth_go/lockout"
+	"auth_go/mail"
 	"auth_go/middleware"
+	"auth_go/migrations"
 	"auth_go/routes"
+	"auth_go/utils"
 	"context"
-	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	_ "github.com/go-sql-driver/mysql"
 )
 
-func initDB() (*dbcommon.Queries, error) {
-	cfg, err := config.LoadConfig()
+func main() {
+	cfg, args, err := config.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(os.Stderr, "\n%s\n", usage)
+		os.Exit(0)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %v", err)
+		log.Fatalf("failed to load config: %v", err)
 	}
 
-	db, err := sql.Open("mysql", cfg.GetDSN())
+	utils.SetIssuer(cfg.Server.Issuer)
+	utils.SetTokenLifetimes(utils.TokenLifetimes{
+		Access:            cfg.Tokens.AccessLifetime,
+		ID:                cfg.Tokens.IDLifetime,
+		Refresh:           cfg.Tokens.RefreshLifetime,
+		EmailVerification: cfg.Tokens.EmailVerificationLifetime,
+		PasswordReset:     cfg.Tokens.PasswordResetLifetime,
+	})
+	utils.SetCookieOptions(utils.CookieOptions{
+		Domain:   cfg.Cookie.Domain,
+		Secure:   cfg.Cookie.Secure,
+		SameSite: cfg.Cookie.SameSiteMode(),
+	})
+	utils.SetSessionKey([]byte(cfg.Session.Key))
+	utils.SetSessionLifetime(cfg.Session.Lifetime)
+
+	dialect := cfg.Database.Dialect()
+	sqlDB, err := db.Open(context.Background(), dialect, cfg.GetDSN())
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
 
-	if err := db.PingContext(context.Background()); err != nil {
-		return nil, err
+	migrator, err := migrations.New(sqlDB, dialect)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	return dbcommon.New(db), nil
-}
+	db := db.NewDb(dbcommon.NewDialect(sqlDB, dialect))
 
-func main() {
-	queries, err := initDB()
+	// Commands need the key too, keys rotate stores a signing key
+	key := cfg.MFA.Key()
+	if key != nil {
+		if err := utils.SetSecretKey(key); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(args) > 0 {
+		if err := runCommand(context.Background(), cfg, migrator, db, args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Refuse to serve against a schema this release wasn't written for
+	if cfg.Database.AutoMigrate {
+		applied, err := migrator.Up(context.Background(), 0)
+		if err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %d_%s", m.Version, m.Name)
+		}
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	if key == nil {
+		log.Println("MFA_ENCRYPTION_KEY is not set, authenticator enrollment is disabled and signing keys are stored unencrypted")
+	}
+
+	// Load signing keys and keep rotating them in the background
+	keyManager, err := keys.NewManager(db, cfg.Signing.Algorithm, cfg.Signing.RotationInterval, cfg.Signing.RotationOverlap, cfg.Signing.AllowUnencryptedKeys)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := keyManager.Start(context.Background()); err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
 
-	db := db.NewDb(queries)
+	mailer, err := mail.NewMailer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Consult the database for revoked tokens when validating them
+	utils.SetRevocationStore(db)
+	go db.PurgeExpiredRevocations(context.Background(), time.Hour)
+	go db.PurgeExpiredSSOSessions(context.Background(), time.Hour)
+
+	// Slow down and lock accounts under password guessing
+	lockoutNotifiers := lockout.Notifiers{lockout.MailNotifier{Mailer: mailer}}
+	if cfg.Lockout.WebhookURL != "" {
+		lockoutNotifiers = append(lockoutNotifiers, lockout.NewWebhookNotifier(cfg.Lockout.WebhookURL))
+	}
+	loginGuard := lockout.NewGuard(lockout.Policy{
+		Threshold:    cfg.Lockout.Threshold,
+		Duration:     cfg.Lockout.Duration,
+		BackoffAfter: cfg.Lockout.BackoffAfter,
+		MaxBackoff:   cfg.Lockout.MaxBackoff,
+	}, lockoutNotifiers)
+
+	// Tell clients when a user logs out (OpenID Connect Back-Channel Logout)
+	logoutNotifier := backchannel.NewNotifier(cfg.Session.BackchannelLogoutAttempts, cfg.Session.BackchannelLogoutTimeout)
+
+	// Share rate limits between replicas through the database when asked to
+	var limiter middleware.Limiter
+	if cfg.RateLimit.Driver == "database" {
+		limiter = middleware.NewDatabaseLimiter(db)
+		go db.PurgeExpiredRateLimits(context.Background(), time.Minute)
+	} else {
+		memoryLimiter := middleware.NewMemoryLimiter()
+		go memoryLimiter.Sweep(context.Background(), time.Minute)
+		limiter = memoryLimiter
+	}
+
+	// Stricter limits for endpoints that check credentials or create accounts
+	loginLimit := middleware.RateLimit(limiter,
+		middleware.Policy{Name: "login-ip", Limit: 20, Window: time.Minute, Key: middleware.ByIP},
+		middleware.Policy{Name: "login-account", Limit: 10, Window: time.Minute, Key: middleware.ByAccount("username")},
+	)
+	mfaLimit := middleware.RateLimit(limiter,
+		middleware.Policy{Name: "mfa-ip", Limit: 10, Window: time.Minute, Key: middleware.ByIP},
+	)
+	registerLimit := middleware.RateLimit(limiter,
+		middleware.Policy{Name: "register-ip", Limit: 10, Window: time.Hour, Key: middleware.ByIP},
+	)
+	mailLimit := middleware.RateLimit(limiter,
+		middleware.Policy{Name: "mail-ip", Limit: 10, Window: time.Hour, Key: middleware.ByIP},
+		middleware.Policy{Name: "mail-account", Limit: 3, Window: time.Hour, Key: middleware.ByAccount("email")},
+	)
+	tokenLimit := middleware.RateLimit(limiter,
+		middleware.Policy{Name: "token-ip", Limit: 60, Window: time.Minute, Key: middleware.ByIP},
+		middleware.Policy{Name: "token-client", Limit: 600, Window: time.Minute, Key: middleware.ByClient},
+	)
 
 	r := gin.New()
 
@@ -63,15 +181,16 @@ func main() {
 
 	// Add CORS middleware
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
+		AllowOrigins:     cfg.Server.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Namespace"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
-	r.Use(middleware.RateLimitMiddleware)
+	// Limit every client IP overall
+	r.Use(middleware.RateLimit(limiter, middleware.Policy{Name: "ip", Limit: 300, Window: time.Minute, Key: middleware.ByIP}))
 
 	// Load HTML templates
 	r.LoadHTMLGlob("templates/*")
@@ -79,17 +198,42 @@ func main() {
 	// OAuth2 PKCE endpoints
 	r.GET("/authorize", routes.Authorize(db))
 	r.GET("/login", routes.LoginPage(db))
-	r.POST("/login", routes.Login(db))
-	r.POST("/token", routes.Token(db))
-	r.POST("/register", routes.Register(db))
+	r.POST("/login", loginLimit, routes.Login(db, loginGuard))
+	r.GET("/login/mfa", routes.MFAPage(db))
+	r.POST("/login/mfa", mfaLimit, routes.VerifyMFA(db, loginGuard))
+	r.POST("/login/webauthn/begin", routes.BeginWebAuthnLogin(db))
+	r.POST("/login/webauthn/finish", mfaLimit, routes.FinishWebAuthnLogin(db, loginGuard))
+	r.GET("/consent", routes.ConsentPage(db))
+	r.POST("/consent", routes.Consent(db))
+	r.GET("/logout", routes.EndSession(db, cfg.Session.LogoutRevokesTokens, logoutNotifier))
+	r.POST("/logout", routes.EndSession(db, cfg.Session.LogoutRevokesTokens, logoutNotifier))
+	r.POST("/token", tokenLimit, routes.Token(db))
+	r.POST("/revoke", routes.Revoke(db))
+	r.POST("/introspect", routes.Introspect(db))
+	r.POST("/register", registerLimit, routes.Register(db, mailer))
 	r.GET("/register", routes.RegisterPage(db))
+	r.GET("/password/forgot", routes.ForgotPasswordPage(db))
+	r.POST("/password/forgot", mailLimit, routes.ForgotPassword(db, mailer))
+	r.GET("/password/reset", routes.ResetPasswordPage(db))
+	r.POST("/password/reset", routes.ResetPassword(db))
+	r.GET("/verify-email", routes.VerifyEmail(db))
+	r.POST("/verify-email/resend", mailLimit, routes.ResendVerificationEmail(db, mailer))
+	r.POST("/mfa/totp", routes.EnrollTOTP(db))
+	r.POST("/mfa/totp/confirm", routes.ConfirmTOTP(db))
+	r.POST("/webauthn/register/begin", routes.BeginWebAuthnRegistration(db))
+	r.POST("/webauthn/register/finish", routes.FinishWebAuthnRegistration(db))
 	r.GET("/validate", routes.Validate(db))
 
+	// OpenID Connect endpoints
+	r.GET("/.well-known/openid-configuration", routes.OpenIDConfiguration())
+	r.GET("/.well-known/jwks.json", routes.JWKS())
+	r.GET("/userinfo", routes.UserInfo(db))
+
 	// User endpoints
 	r.GET("/user/uuid/:uuid", routes.GetUserByUUID(db))
 	r.GET("/user/email/:email", routes.GetUserByEmail(db))
 	// Serve static files
 	r.Static("/static", "./static")
 
-	r.Run()
+	r.Run(cfg.Server.Addr)
 }
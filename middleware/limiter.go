@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Result is the state of a rate limit after counting a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is how long until the current window ends and the count starts over
+	ResetAfter time.Duration
+}
+
+// Limiter counts requests per key in fixed windows
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error)
+}
+
+// windowEnd returns the end of the fixed window now falls in, aligned so every replica agrees
+func windowEnd(now time.Time, window time.Duration) time.Time {
+	return now.Truncate(window).Add(window)
+}
+
+func newResult(count int64, limit int, reset time.Time, now time.Time) Result {
+	return Result{
+		Allowed:    count <= int64(limit),
+		Limit:      limit,
+		Remaining:  int(max(int64(limit)-count, 0)),
+		ResetAfter: reset.Sub(now),
+	}
+}
+
+type memoryWindow struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryLimiter keeps counts in process, for single instance deployments
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*memoryWindow
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{windows: make(map[string]*memoryWindow)}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	now := time.Now()
+	reset := windowEnd(now, window)
+	bucket := fmt.Sprintf("%s:%d", key, reset.Unix())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.windows[bucket]
+	if !ok {
+		w = &memoryWindow{expiresAt: reset}
+		l.windows[bucket] = w
+	}
+	w.count++
+
+	return newResult(w.count, limit, reset, now), nil
+}
+
+// Sweep periodically drops windows that have ended
+func (l *MemoryLimiter) Sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for bucket, w := range l.windows {
+				if now.After(w.expiresAt) {
+					delete(l.windows, bucket)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// CounterStore persists request counts shared by all replicas
+type CounterStore interface {
+	IncrementRateLimit(ctx context.Context, bucket string, expiresAt time.Time) (int64, error)
+}
+
+// DatabaseLimiter keeps counts in the database so limits hold across replicas
+type DatabaseLimiter struct {
+	store CounterStore
+}
+
+func NewDatabaseLimiter(store CounterStore) *DatabaseLimiter {
+	return &DatabaseLimiter{store: store}
+}
+
+func (l *DatabaseLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	now := time.Now()
+	reset := windowEnd(now, window)
+
+	// Keys can hold user input such as email addresses, hashing keeps buckets short and uniform
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s:%d", key, reset.Unix()))
+	count, err := l.store.IncrementRateLimit(ctx, hex.EncodeToString(sum[:]), reset)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(count, limit, reset, now), nil
+}
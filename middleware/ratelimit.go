@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc picks what a policy counts requests by, an empty key leaves the request uncounted
+type KeyFunc func(c *gin.Context) string
+
+// Policy limits requests sharing a key to Limit per Window
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    KeyFunc
+}
+
+// ByIP counts requests per client IP address
+func ByIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// ByAccount counts requests per account, identified by the given form field
+func ByAccount(field string) KeyFunc {
+	return func(c *gin.Context) string {
+		return strings.ToLower(strings.TrimSpace(c.PostForm(field)))
+	}
+}
+
+// ByClient counts requests per client namespace, from HTTP basic credentials or the client_id parameter
+func ByClient(c *gin.Context) string {
+	if id, _, ok := c.Request.BasicAuth(); ok {
+		if unescaped, err := url.QueryUnescape(id); err == nil {
+			return unescaped
+		}
+		return id
+	}
+	if id := c.PostForm("client_id"); id != "" {
+		return id
+	}
+	return c.Query("client_id")
+}
+
+// RateLimit enforces every policy on the request. The response carries the RateLimit headers
+// of the policy closest to its limit, and Retry-After once a limit is exceeded.
+func RateLimit(limiter Limiter, policies ...Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var tightest *Result
+		for _, policy := range policies {
+			key := policy.Key(c)
+			if key == "" {
+				continue
+			}
+
+			result, err := limiter.Allow(context.Background(), policy.Name+":"+key, policy.Limit, policy.Window)
+			if err != nil {
+				// Keep serving if the limiter's storage is down, the lockout still protects accounts
+				log.Printf("Error checking rate limit %s: %v", policy.Name, err)
+				continue
+			}
+
+			if tightest == nil || !result.Allowed || result.Remaining < tightest.Remaining {
+				tightest = &result
+			}
+			if !result.Allowed {
+				break
+			}
+		}
+
+		if tightest == nil {
+			c.Next()
+			return
+		}
+
+		reset := fmt.Sprint(int(math.Ceil(tightest.ResetAfter.Seconds())))
+		c.Header("RateLimit-Limit", fmt.Sprint(tightest.Limit))
+		c.Header("RateLimit-Remaining", fmt.Sprint(tightest.Remaining))
+		c.Header("RateLimit-Reset", reset)
+
+		if !tightest.Allowed {
+			c.Header("Retry-After", reset)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many requests",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
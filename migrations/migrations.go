@@ -0,0 +1,513 @@
+// Package migrations holds the versioned database schema and applies it.
+//
+// Every change to the schema is a pair of files NNNN_name.up.sql and
+// NNNN_name.down.sql in the directory of each SQL dialect, which are embedded
+// in the binary. Applied versions are recorded in the schema_migrations table.
+package migrations
+
+import (
+	"auth_go/dbcommon"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// lockName is the MySQL advisory lock held while migrating, so replicas starting together take turns
+const lockName = "auth_go.schema_migrations"
+
+// lockKey is the PostgreSQL advisory lock, which is identified by a number
+const lockKey = 0x617574685f676f
+
+// lockTimeout is how long to wait for another instance to finish migrating
+const lockTimeout = 10 * time.Minute
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version BIGINT NOT NULL PRIMARY KEY,
+  name VARCHAR(191) NOT NULL,
+  -- set while a MySQL migration runs, MySQL can't roll back schema changes that fail part way
+  dirty BOOLEAN NOT NULL DEFAULT TRUE,
+  applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+var ErrLocked = errors.New("timed out waiting for another instance to finish migrating")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a known migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied   bool
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    dbcommon.Dialect
+	migrations []Migration
+}
+
+// New returns a migrator for the embedded migrations of the dialect
+func New(db *sql.DB, dialect dbcommon.Dialect) (*Migrator, error) {
+	dir, err := fs.Sub(files, string(dialect))
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := load(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// load reads the migration files, sorted by version
+func load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, file := range names {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		prefix, name, hasName := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || !hasName || err != nil || version <= 0 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration file %s must be named NNNN_name.up.sql or NNNN_name.down.sql", file)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has files with different names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return int(a.Version - b.Version)
+	})
+	return migrations, nil
+}
+
+// Latest returns the version the schema is at once every migration is applied
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies up to n pending migrations in order, all of them if n is 0
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClean(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if n > 0 && len(done) == n {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if err := m.apply(ctx, conn, migration, true); err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the n most recently applied migrations, newest first
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClean(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if err := m.apply(ctx, conn, migration, false); err != nil {
+			return done, fmt.Errorf("reverting migration %d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Force records every migration up to and including version as cleanly applied and
+// the later ones as not applied, without running any of them. It is for repairing a
+// failed migration by hand and for adopting a database created before migrations existed.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(migration Migration) bool { return migration.Version == version }) {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.unlock(conn)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		if _, err := tx.ExecContext(ctx, m.rebind("INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, FALSE)"), migration.Version, migration.Name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Status lists every known migration and whether it is applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	applied, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i].Migration = migration
+		if row, ok := applied[migration.Version]; ok {
+			statuses[i].Applied = true
+			statuses[i].Dirty = row.dirty
+			statuses[i].AppliedAt = row.appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Check returns an error unless the database is at exactly the version this binary expects
+func (m *Migrator) Check(ctx context.Context) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	applied, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if err := checkClean(applied); err != nil {
+		return err
+	}
+
+	for version := range applied {
+		if !slices.ContainsFunc(m.migrations, func(migration Migration) bool { return migration.Version == version }) {
+			return fmt.Errorf("database has migration %d applied which this binary doesn't know, it is newer than this release", version)
+		}
+	}
+
+	var pending []string
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, fmt.Sprintf("%d_%s", migration.Version, migration.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is out of date, %d migrations are pending (%s), run migrate up",
+			len(pending), strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// apply runs a migration up or down and records the outcome in schema_migrations
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	script := migration.Down
+	if up {
+		script = migration.Up
+	}
+
+	// PostgreSQL and SQLite change the schema transactionally, so a migration applies completely or not at all
+	if m.dialect != dbcommon.MySQL {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := execScript(ctx, tx, script); err != nil {
+			return err
+		}
+		if up {
+			_, err = tx.ExecContext(ctx, m.rebind("INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, FALSE)"), migration.Version, migration.Name)
+		} else {
+			_, err = tx.ExecContext(ctx, m.rebind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	// MySQL commits every schema change on its own, the version stays dirty until the whole script ran
+	if up {
+		if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name); err != nil {
+			return err
+		}
+	} else {
+		if _, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = TRUE WHERE version = ?", migration.Version); err != nil {
+			return err
+		}
+	}
+	if err := execScript(ctx, conn, script); err != nil {
+		return fmt.Errorf("%v, the schema may be partly changed", err)
+	}
+	if up {
+		_, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = FALSE WHERE version = ?", migration.Version)
+		return err
+	}
+	_, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+	return err
+}
+
+// lock takes the advisory lock on a dedicated connection, which the migration must run on
+func (m *Migrator) lock(ctx context.Context) (*sql.Conn, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch m.dialect {
+	case dbcommon.MySQL:
+		// GET_LOCK returns 1 once acquired, 0 on timeout and NULL on error
+		var acquired sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout.Seconds())).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if acquired.Int64 != 1 {
+			conn.Close()
+			return nil, ErrLocked
+		}
+
+	case dbcommon.Postgres:
+		lockCtx, cancel := context.WithTimeout(ctx, lockTimeout)
+		defer cancel()
+		if _, err := conn.ExecContext(lockCtx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+			conn.Close()
+			if lockCtx.Err() != nil {
+				return nil, ErrLocked
+			}
+			return nil, err
+		}
+
+	// SQLite has no advisory locks, its transactions already admit a single writer
+	case dbcommon.SQLite:
+	}
+
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		m.unlock(conn)
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (m *Migrator) unlock(conn *sql.Conn) {
+	switch m.dialect {
+	case dbcommon.MySQL:
+		conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+	case dbcommon.Postgres:
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+	}
+	conn.Close()
+}
+
+// rebind adapts the placeholders of a query to the dialect
+func (m *Migrator) rebind(query string) string {
+	if m.dialect == dbcommon.Postgres {
+		return dbcommon.Rebind(query)
+	}
+	return query
+}
+
+type appliedVersion struct {
+	name      string
+	dirty     bool
+	appliedAt time.Time
+}
+
+// appliedVersions reads the schema_migrations table, which may not exist yet
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]appliedVersion, error) {
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'"
+	switch m.dialect {
+	case dbcommon.Postgres:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'"
+	case dbcommon.SQLite:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	}
+
+	var exists int
+	err := conn.QueryRowContext(ctx, query).Scan(&exists)
+	if err != nil || exists == 0 {
+		return map[int64]appliedVersion{}, err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]appliedVersion{}
+	for rows.Next() {
+		var version int64
+		var row appliedVersion
+		if err := rows.Scan(&version, &row.name, &row.dirty, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+// checkClean refuses to go on after a migration failed part way
+func checkClean(applied map[int64]appliedVersion) error {
+	for version, row := range applied {
+		if row.dirty {
+			return fmt.Errorf("migration %d_%s did not complete, repair the schema by hand and record the version it is at with migrate force", version, row.name)
+		}
+	}
+	return nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// execScript runs the statements of a migration one by one
+func execScript(ctx context.Context, db execer, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on semicolons outside of quotes and comments,
+// the driver only runs one statement at a time
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	var quote byte
+
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote != '`' && i+1 < len(script) {
+				current.WriteByte(ch)
+				i++
+				ch = script[i]
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '-' && strings.HasPrefix(script[i:], "--") && (i+2 == len(script) || script[i+2] <= ' '), ch == '#':
+			// Skip the comment up to the end of the line
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+			}
+			current.WriteByte('\n')
+			continue
+		case ch == ';':
+			flush()
+			continue
+		}
+		current.WriteByte(ch)
+	}
+	flush()
+
+	return statements
+}
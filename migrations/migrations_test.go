@@ -0,0 +1,347 @@
+package migrations
+
+import (
+	"auth_go/dbcommon"
+	"context"
+	"database/sql"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// newSQLiteMigrator returns a migrator for the migrations on an empty SQLite database,
+// or for the embedded ones if migrations is nil
+func newSQLiteMigrator(t *testing.T, migrations []Migration) *Migrator {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "auth.db")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if migrations == nil {
+		m, err := New(db, dbcommon.SQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	return &Migrator{db: db, dialect: dbcommon.SQLite, migrations: migrations}
+}
+
+// appliedStatus returns the versions Status reports as applied
+func appliedStatus(t *testing.T, m *Migrator) []int64 {
+	t.Helper()
+
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied []int64
+	for _, status := range statuses {
+		if status.Applied {
+			if status.AppliedAt.IsZero() {
+				t.Errorf("migration %d has no applied time", status.Version)
+			}
+			applied = append(applied, status.Version)
+		}
+	}
+	return applied
+}
+
+// tableExists reports whether the SQLite database has the table
+func tableExists(t *testing.T, m *Migrator, table string) bool {
+	t.Helper()
+
+	var count int
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+// versions returns the versions of the migrations
+func versions(migrations []Migration) []int64 {
+	var v []int64
+	for _, migration := range migrations {
+		v = append(v, migration.Version)
+	}
+	return v
+}
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "first", Up: "CREATE TABLE first (id INTEGER PRIMARY KEY);", Down: "DROP TABLE first;"},
+	{Version: 2, Name: "second", Up: "CREATE TABLE second (id INTEGER PRIMARY KEY);\nCREATE INDEX idx_second ON second (id);", Down: "DROP TABLE second;"},
+	{Version: 3, Name: "third", Up: "CREATE TABLE third (id INTEGER PRIMARY KEY);", Down: "DROP TABLE third;"},
+}
+
+// loadDialect returns the embedded migrations of the dialect
+func loadDialect(t *testing.T, dialect dbcommon.Dialect) []Migration {
+	t.Helper()
+
+	dir, err := fs.Sub(files, string(dialect))
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations
+}
+
+func TestDialectsHaveTheSameMigrations(t *testing.T) {
+	mysql := loadDialect(t, dbcommon.MySQL)
+
+	for _, dialect := range []dbcommon.Dialect{dbcommon.Postgres, dbcommon.SQLite} {
+		migrations := loadDialect(t, dialect)
+		if len(migrations) != len(mysql) {
+			t.Errorf("%s has %d migrations, mysql has %d", dialect, len(migrations), len(mysql))
+			continue
+		}
+		for i, migration := range migrations {
+			if migration.Version != mysql[i].Version || migration.Name != mysql[i].Name {
+				t.Errorf("%s migration %d_%s, mysql has %d_%s", dialect, migration.Version, migration.Name, mysql[i].Version, mysql[i].Name)
+			}
+		}
+	}
+}
+
+func TestNoMySQLSyntax(t *testing.T) {
+	mysqlOnly := []string{"AUTO_INCREMENT", "ENGINE", "UNSIGNED", "ON UPDATE CURRENT_TIMESTAMP", "`", "INSERT IGNORE", "MODIFY COLUMN"}
+	// SQLite accepts any type name, PostgreSQL only its own
+	unsupported := map[dbcommon.Dialect][]string{
+		dbcommon.Postgres: append([]string{"DATETIME", "TINYINT", "LONGTEXT", "AUTOINCREMENT"}, mysqlOnly...),
+		dbcommon.SQLite:   mysqlOnly,
+	}
+
+	for dialect, syntaxes := range unsupported {
+		for _, migration := range loadDialect(t, dialect) {
+			for _, statement := range splitStatements(migration.Up + ";" + migration.Down) {
+				for _, syntax := range syntaxes {
+					if strings.Contains(strings.ToUpper(statement), syntax) {
+						t.Errorf("%s migration %d_%s uses %s: %s", dialect, migration.Version, migration.Name, syntax, statement)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteMigrator(t, nil)
+
+	if err := m.Check(ctx); err == nil {
+		t.Error("Check passed on an empty database")
+	}
+
+	done, err := m.Up(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("Up(2) applied %v, want [1 2]", got)
+	}
+	if err := m.Check(ctx); err == nil {
+		t.Error("Check passed with migrations pending")
+	}
+
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedStatus(t, m); !reflect.DeepEqual(got, versions(m.migrations)) {
+		t.Errorf("applied %v after Up, want %v", got, versions(m.migrations))
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Errorf("Check failed with every migration applied: %v", err)
+	}
+
+	done, err = m.Down(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Version != m.Latest() {
+		t.Errorf("Down(1) reverted %v, want only %d", versions(done), m.Latest())
+	}
+	if tableExists(t, m, "access_tokens") {
+		t.Error("Down(1) left the table of the latest migration")
+	}
+
+	// Every down migration runs cleanly, and the up ones again after them
+	if _, err := m.Down(ctx, len(m.migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedStatus(t, m); len(got) != 0 {
+		t.Errorf("applied %v after reverting everything", got)
+	}
+	if tableExists(t, m, "users") {
+		t.Error("reverting everything left the users table")
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	migrations := append(testMigrations[:2:2], Migration{
+		Version: 3,
+		Name:    "broken",
+		Up:      "CREATE TABLE broken (id INTEGER PRIMARY KEY);\nNOT SQL;",
+		Down:    "DROP TABLE broken;",
+	})
+	m := newSQLiteMigrator(t, migrations)
+
+	done, err := m.Up(ctx, 0)
+	if err == nil {
+		t.Fatal("Up succeeded with a broken migration")
+	}
+	if got := versions(done); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("Up applied %v before failing, want [1 2]", got)
+	}
+	if got := appliedStatus(t, m); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("applied %v, want [1 2]", got)
+	}
+	// SQLite changes the schema in the transaction, the part that ran is undone
+	if tableExists(t, m, "broken") {
+		t.Error("the failed migration left its table behind")
+	}
+}
+
+func TestDirtyVersion(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteMigrator(t, testMigrations)
+
+	if _, err := m.Up(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	// What a MySQL migration failing part way leaves behind
+	if _, err := m.db.Exec("UPDATE schema_migrations SET dirty = TRUE WHERE version = 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[1].Dirty || statuses[0].Dirty {
+		t.Errorf("got dirty %v and %v, want only version 2 dirty", statuses[0].Dirty, statuses[1].Dirty)
+	}
+
+	if _, err := m.Up(ctx, 0); err == nil || !strings.Contains(err.Error(), "2_second did not complete") {
+		t.Errorf("Up on a dirty database: got %v", err)
+	}
+	if _, err := m.Down(ctx, 1); err == nil {
+		t.Error("Down ran on a dirty database")
+	}
+	if err := m.Check(ctx); err == nil {
+		t.Error("Check passed on a dirty database")
+	}
+	if tableExists(t, m, "third") {
+		t.Error("Up ran a migration on a dirty database")
+	}
+
+	// After repairing the schema by hand the version is recorded as clean
+	if err := m.Force(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestForce(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteMigrator(t, testMigrations)
+
+	if err := m.Force(ctx, 4); err == nil {
+		t.Error("Force accepted an unknown version")
+	}
+
+	// Adopting a database whose schema already is at version 2
+	if err := m.Force(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedStatus(t, m); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("applied %v after Force(2), want [1 2]", got)
+	}
+	if tableExists(t, m, "first") {
+		t.Error("Force ran a migration")
+	}
+
+	done, err := m.Up(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); !reflect.DeepEqual(got, []int64{3}) {
+		t.Errorf("Up after Force(2) applied %v, want [3]", got)
+	}
+
+	if err := m.Force(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedStatus(t, m); len(got) != 0 {
+		t.Errorf("applied %v after Force(0)", got)
+	}
+}
+
+func TestCheckUnknownVersion(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteMigrator(t, testMigrations)
+
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	// A newer release migrated the database further
+	if _, err := m.db.Exec("INSERT INTO schema_migrations (version, name, dirty) VALUES (4, 'newer', FALSE)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(ctx); err == nil || !strings.Contains(err.Error(), "newer than this release") {
+		t.Errorf("Check with an unknown version: got %v", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "", nil},
+		{"only comments", "-- nothing\n# here;\n", nil},
+		{"one without semicolon", "SELECT 1", []string{"SELECT 1"}},
+		{"several", "SELECT 1;\nSELECT 2;\n\n", []string{"SELECT 1", "SELECT 2"}},
+		{"semicolon in single quotes", "INSERT INTO t VALUES ('a;b');SELECT 2", []string{"INSERT INTO t VALUES ('a;b')", "SELECT 2"}},
+		{"semicolon in double quotes", `SELECT "a;b" FROM t`, []string{`SELECT "a;b" FROM t`}},
+		{"semicolon in backticks", "SELECT `a;b` FROM t", []string{"SELECT `a;b` FROM t"}},
+		{"doubled quote", "SELECT 'it''s;';SELECT 2", []string{"SELECT 'it''s;'", "SELECT 2"}},
+		{"escaped quote", `SELECT 'it\'s;';SELECT 2`, []string{`SELECT 'it\'s;'`, "SELECT 2"}},
+		{"escaped backslash", `SELECT 'a\\';SELECT 2`, []string{`SELECT 'a\\'`, "SELECT 2"}},
+		{"backslash in backticks", "SELECT `a\\`;SELECT 2", []string{"SELECT `a\\`", "SELECT 2"}},
+		{"dash comment", "SELECT 1; -- a comment; with semicolons\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"hash comment", "SELECT 1 # it's; not\n;SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"comment at the end", "SELECT 1;\n--", []string{"SELECT 1"}},
+		{"quote in comment", "-- don't\nSELECT 1;SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"comment marker in quotes", "SELECT '-- x; # y';SELECT 2", []string{"SELECT '-- x; # y'", "SELECT 2"}},
+		{"minus minus without space", "SELECT 1--1;SELECT 2", []string{"SELECT 1--1", "SELECT 2"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
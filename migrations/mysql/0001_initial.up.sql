@@ -0,0 +1,193 @@
+CREATE TABLE clients (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  namespace VARCHAR(32) NOT NULL,
+  name VARCHAR(191) NOT NULL,
+  client_secret TEXT,
+  allowed_scopes VARCHAR(1024) NOT NULL DEFAULT 'openid profile email',
+  -- 'global' shares users with every other global client, 'namespace' keeps its own users
+  user_pool VARCHAR(16) NOT NULL DEFAULT 'global',
+  require_email_verification BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (namespace)
+);
+
+CREATE TABLE users (
+  id   BIGINT  NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  uuid VARCHAR(36) NOT NULL,
+  -- 0 for the global user pool, otherwise the id of the client owning the pool
+  namespace_id BIGINT NOT NULL DEFAULT 0,
+  email VARCHAR(320)    NOT NULL,
+  firstname TEXT NOT NULL,
+  lastname TEXT NOT NULL,
+  password TEXT NOT NULL,
+  email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+  verification_sent_at DATETIME,
+  failed_login_attempts INT NOT NULL DEFAULT 0,
+  last_failed_login_at DATETIME,
+  locked_until DATETIME,
+  UNIQUE (namespace_id, email),
+  UNIQUE (uuid)
+);
+
+CREATE TABLE sessions (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  session_id BINARY(16) NOT NULL,
+  user_id BIGINT,
+  auth_code VARCHAR(255) NOT NULL,
+  client_id BIGINT NOT NULL,
+  pkce_challenge TEXT NOT NULL,
+  pkce_challenge_method TEXT NOT NULL,
+  state TEXT NOT NULL,
+  redirect_uri TEXT NOT NULL,
+  scope VARCHAR(1024) NOT NULL DEFAULT '',
+  nonce VARCHAR(255) NOT NULL DEFAULT '',
+  auth_time DATETIME,
+  -- set once the password is verified while the second factor is still outstanding
+  mfa_user_id BIGINT,
+  -- space separated authentication methods (RFC 8176) used to log in
+  amr VARCHAR(64) NOT NULL DEFAULT '',
+  expires_at DATETIME NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (mfa_user_id) REFERENCES users(id),
+  FOREIGN KEY (client_id) REFERENCES clients(id),
+  UNIQUE(session_id),
+  UNIQUE(auth_code)
+);
+
+CREATE TABLE refresh_tokens (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  token_hash CHAR(64) NOT NULL,
+  family_id VARCHAR(36) NOT NULL,
+  user_id BIGINT NOT NULL,
+  client_id BIGINT NOT NULL,
+  scope VARCHAR(1024) NOT NULL DEFAULT '',
+  auth_time DATETIME,
+  amr VARCHAR(64) NOT NULL DEFAULT '',
+  expires_at DATETIME NOT NULL,
+  used_at DATETIME,
+  revoked_at DATETIME,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (client_id) REFERENCES clients(id),
+  UNIQUE(token_hash),
+  INDEX(family_id)
+);
+
+CREATE TABLE signing_keys (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  kid VARCHAR(64) NOT NULL,
+  algorithm VARCHAR(16) NOT NULL,
+  private_key TEXT NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'active',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  rotated_at DATETIME,
+  UNIQUE(kid),
+  INDEX(status)
+);
+
+CREATE TABLE client_redirect_uris (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  client_id BIGINT NOT NULL,
+  redirect_uri VARCHAR(512) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE,
+  UNIQUE(client_id, redirect_uri)
+);
+
+CREATE TABLE revoked_tokens (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  jti VARCHAR(64) NOT NULL,
+  expires_at DATETIME NOT NULL,
+  revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE(jti),
+  INDEX(expires_at)
+);
+
+CREATE TABLE consents (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  client_id BIGINT NOT NULL,
+  scope VARCHAR(1024) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE,
+  UNIQUE(user_id, client_id)
+);
+
+CREATE TABLE password_reset_tokens (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  expires_at DATETIME NOT NULL,
+  used_at DATETIME,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(token_hash)
+);
+
+CREATE TABLE totp_credentials (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  -- encrypted with the MFA encryption key
+  secret TEXT NOT NULL,
+  confirmed_at DATETIME,
+  -- the last time step a code was accepted for, so codes can't be replayed
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(user_id)
+);
+
+CREATE TABLE recovery_codes (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at DATETIME,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  INDEX(user_id)
+);
+
+CREATE TABLE webauthn_credentials (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  credential_id VARBINARY(1023) NOT NULL,
+  -- COSE encoded
+  public_key BLOB NOT NULL,
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  aaguid VARBINARY(16) NOT NULL,
+  attestation_format VARCHAR(32) NOT NULL,
+  transports VARCHAR(255) NOT NULL DEFAULT '',
+  name VARCHAR(191) NOT NULL DEFAULT '',
+  last_used_at DATETIME,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(credential_id(255)),
+  INDEX(user_id)
+);
+
+CREATE TABLE webauthn_challenges (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  challenge VARCHAR(64) NOT NULL,
+  -- 'registration' or 'authentication'
+  ceremony VARCHAR(16) NOT NULL,
+  -- the user the ceremony is for, NULL for passkey logins where the user isn't known yet
+  user_id BIGINT,
+  expires_at DATETIME NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(challenge),
+  INDEX(expires_at)
+);
+
+CREATE TABLE rate_limit_counters (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  -- hash of the policy, key and window the requests are counted for
+  bucket CHAR(64) NOT NULL,
+  count BIGINT NOT NULL DEFAULT 1,
+  expires_at DATETIME NOT NULL,
+  UNIQUE(bucket),
+  INDEX(expires_at)
+);
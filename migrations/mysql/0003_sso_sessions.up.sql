@@ -0,0 +1,12 @@
+CREATE TABLE sso_sessions (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  amr VARCHAR(64) NOT NULL DEFAULT '',
+  auth_time DATETIME NOT NULL,
+  expires_at DATETIME NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(token_hash),
+  INDEX(expires_at)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE sessions DROP COLUMN login_hint;
+ALTER TABLE sessions DROP COLUMN prompt;
@@ -0,0 +1,2 @@
+ALTER TABLE sessions ADD COLUMN prompt VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN login_hint VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- the SSO session a user logged in with, so logging out can end what was started from it
+ALTER TABLE sessions ADD COLUMN sso_session_id BIGINT;
+ALTER TABLE refresh_tokens ADD COLUMN sso_session_id BIGINT;
+CREATE INDEX refresh_tokens_sso_session_id_idx ON refresh_tokens (sso_session_id);
@@ -0,0 +1,16 @@
+-- where clients are told about a logout (OpenID Connect Back-Channel and Front-Channel Logout 1.0)
+ALTER TABLE clients ADD COLUMN backchannel_logout_uri VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE clients ADD COLUMN frontchannel_logout_uri VARCHAR(512) NOT NULL DEFAULT '';
+
+-- the sid claim identifying the SSO session to clients
+ALTER TABLE sso_sessions ADD COLUMN sid CHAR(36) NOT NULL DEFAULT '';
+
+-- the clients that received tokens in an SSO session, notified when it ends
+CREATE TABLE sso_session_clients (
+  sso_session_id BIGINT NOT NULL,
+  client_id BIGINT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (sso_session_id, client_id),
+  FOREIGN KEY (sso_session_id) REFERENCES sso_sessions(id) ON DELETE CASCADE,
+  FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- the access tokens issued to users, so those of an SSO session or a user can be revoked together
+CREATE TABLE access_tokens (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  jti VARCHAR(64) NOT NULL,
+  user_id BIGINT NOT NULL,
+  sso_session_id BIGINT,
+  expires_at DATETIME NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(jti),
+  INDEX(sso_session_id),
+  INDEX(expires_at)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE sso_sessions (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  amr VARCHAR(64) NOT NULL DEFAULT '',
+  auth_time TIMESTAMPTZ NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(token_hash)
+);
+
+CREATE INDEX sso_sessions_expires_at_idx ON sso_sessions (expires_at);
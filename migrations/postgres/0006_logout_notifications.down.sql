@@ -0,0 +1,4 @@
+DROP TABLE sso_session_clients;
+ALTER TABLE sso_sessions DROP COLUMN sid;
+ALTER TABLE clients DROP COLUMN frontchannel_logout_uri;
+ALTER TABLE clients DROP COLUMN backchannel_logout_uri;
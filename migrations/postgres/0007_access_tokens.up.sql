@@ -0,0 +1,15 @@
+-- the access tokens issued to users, so those of an SSO session or a user can be revoked together
+CREATE TABLE access_tokens (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  jti VARCHAR(64) NOT NULL,
+  user_id BIGINT NOT NULL,
+  sso_session_id BIGINT,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(jti)
+);
+
+CREATE INDEX access_tokens_user_id_idx ON access_tokens (user_id);
+CREATE INDEX access_tokens_sso_session_id_idx ON access_tokens (sso_session_id);
+CREATE INDEX access_tokens_expires_at_idx ON access_tokens (expires_at);
@@ -0,0 +1,14 @@
+DROP TABLE rate_limit_counters;
+DROP TABLE webauthn_challenges;
+DROP TABLE webauthn_credentials;
+DROP TABLE recovery_codes;
+DROP TABLE totp_credentials;
+DROP TABLE password_reset_tokens;
+DROP TABLE consents;
+DROP TABLE revoked_tokens;
+DROP TABLE client_redirect_uris;
+DROP TABLE signing_keys;
+DROP TABLE refresh_tokens;
+DROP TABLE sessions;
+DROP TABLE users;
+DROP TABLE clients;
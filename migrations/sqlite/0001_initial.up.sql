@@ -0,0 +1,200 @@
+CREATE TABLE clients (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  namespace VARCHAR(32) NOT NULL,
+  name VARCHAR(191) NOT NULL,
+  client_secret TEXT,
+  allowed_scopes VARCHAR(1024) NOT NULL DEFAULT 'openid profile email',
+  -- 'global' shares users with every other global client, 'namespace' keeps its own users
+  user_pool VARCHAR(16) NOT NULL DEFAULT 'global',
+  require_email_verification BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (namespace)
+);
+
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  uuid VARCHAR(36) NOT NULL,
+  -- 0 for the global user pool, otherwise the id of the client owning the pool
+  namespace_id BIGINT NOT NULL DEFAULT 0,
+  email VARCHAR(320)    NOT NULL,
+  firstname TEXT NOT NULL,
+  lastname TEXT NOT NULL,
+  password TEXT NOT NULL,
+  email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+  verification_sent_at DATETIME,
+  failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+  last_failed_login_at DATETIME,
+  locked_until DATETIME,
+  UNIQUE (namespace_id, email),
+  UNIQUE (uuid)
+);
+
+CREATE TABLE sessions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  session_id BLOB NOT NULL,
+  user_id BIGINT,
+  auth_code VARCHAR(255) NOT NULL,
+  client_id BIGINT NOT NULL,
+  pkce_challenge TEXT NOT NULL,
+  pkce_challenge_method TEXT NOT NULL,
+  state TEXT NOT NULL,
+  redirect_uri TEXT NOT NULL,
+  scope VARCHAR(1024) NOT NULL DEFAULT '',
+  nonce VARCHAR(255) NOT NULL DEFAULT '',
+  auth_time DATETIME,
+  -- set once the password is verified while the second factor is still outstanding
+  mfa_user_id BIGINT,
+  -- space separated authentication methods (RFC 8176) used to log in
+  amr VARCHAR(64) NOT NULL DEFAULT '',
+  expires_at DATETIME NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (mfa_user_id) REFERENCES users(id),
+  FOREIGN KEY (client_id) REFERENCES clients(id),
+  UNIQUE(session_id),
+  UNIQUE(auth_code)
+);
+
+CREATE TABLE refresh_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  token_hash CHAR(64) NOT NULL,
+  family_id VARCHAR(36) NOT NULL,
+  user_id BIGINT NOT NULL,
+  client_id BIGINT NOT NULL,
+  scope VARCHAR(1024) NOT NULL DEFAULT '',
+  auth_time DATETIME,
+  amr VARCHAR(64) NOT NULL DEFAULT '',
+  expires_at DATETIME NOT NULL,
+  used_at DATETIME,
+  revoked_at DATETIME,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (client_id) REFERENCES clients(id),
+  UNIQUE(token_hash)
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+CREATE TABLE signing_keys (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  kid VARCHAR(64) NOT NULL,
+  algorithm VARCHAR(16) NOT NULL,
+  private_key TEXT NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'active',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  rotated_at DATETIME,
+  UNIQUE(kid)
+);
+
+CREATE INDEX signing_keys_status_idx ON signing_keys (status);
+
+CREATE TABLE client_redirect_uris (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  client_id BIGINT NOT NULL,
+  redirect_uri VARCHAR(512) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE,
+  UNIQUE(client_id, redirect_uri)
+);
+
+CREATE TABLE revoked_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  jti VARCHAR(64) NOT NULL,
+  expires_at DATETIME NOT NULL,
+  revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE(jti)
+);
+
+CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
+
+CREATE TABLE consents (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL,
+  client_id BIGINT NOT NULL,
+  scope VARCHAR(1024) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE,
+  UNIQUE(user_id, client_id)
+);
+
+CREATE TABLE password_reset_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  expires_at DATETIME NOT NULL,
+  used_at DATETIME,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(token_hash)
+);
+
+CREATE TABLE totp_credentials (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL,
+  -- encrypted with the MFA encryption key
+  secret TEXT NOT NULL,
+  confirmed_at DATETIME,
+  -- the last time step a code was accepted for, so codes can't be replayed
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(user_id)
+);
+
+CREATE TABLE recovery_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at DATETIME,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+CREATE TABLE webauthn_credentials (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL,
+  credential_id BLOB NOT NULL,
+  -- COSE encoded
+  public_key BLOB NOT NULL,
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  aaguid BLOB NOT NULL,
+  attestation_format VARCHAR(32) NOT NULL,
+  transports VARCHAR(255) NOT NULL DEFAULT '',
+  name VARCHAR(191) NOT NULL DEFAULT '',
+  last_used_at DATETIME,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(credential_id)
+);
+
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+CREATE TABLE webauthn_challenges (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  challenge VARCHAR(64) NOT NULL,
+  -- 'registration' or 'authentication'
+  ceremony VARCHAR(16) NOT NULL,
+  -- the user the ceremony is for, NULL for passkey logins where the user isn't known yet
+  user_id BIGINT,
+  expires_at DATETIME NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(challenge)
+);
+
+CREATE INDEX webauthn_challenges_expires_at_idx ON webauthn_challenges (expires_at);
+
+CREATE TABLE rate_limit_counters (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  -- hash of the policy, key and window the requests are counted for
+  bucket CHAR(64) NOT NULL,
+  count BIGINT NOT NULL DEFAULT 1,
+  expires_at DATETIME NOT NULL,
+  UNIQUE(bucket)
+);
+
+CREATE INDEX rate_limit_counters_expires_at_idx ON rate_limit_counters (expires_at);
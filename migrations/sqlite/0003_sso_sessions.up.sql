@@ -0,0 +1,13 @@
+CREATE TABLE sso_sessions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  amr VARCHAR(64) NOT NULL DEFAULT '',
+  auth_time DATETIME NOT NULL,
+  expires_at DATETIME NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE(token_hash)
+);
+
+CREATE INDEX sso_sessions_expires_at_idx ON sso_sessions (expires_at);
@@ -0,0 +1,3 @@
+DROP INDEX refresh_tokens_sso_session_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN sso_session_id;
+ALTER TABLE sessions DROP COLUMN sso_session_id;
@@ -1,5 +1,5 @@
 -- name: GetUserByEmail :one
-SELECT * FROM users WHERE email = ?;
+SELECT * FROM users WHERE namespace_id = ? AND email = ?;
 
 -- name: GetUserByID :one
 SELECT * FROM users WHERE id = ?;
@@ -8,36 +8,35 @@ SELECT * FROM users WHERE id = ?;
 SELECT * FROM users WHERE uuid = ?;
 
 -- name: CreateUser :exec
-INSERT INTO users (email, password, uuid, firstname, lastname) VALUES (?, ?, ?, ?, ?);
+INSERT INTO users (namespace_id, email, password, uuid, firstname, lastname) VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: ListUsers :many
+SELECT * FROM users WHERE namespace_id = ? ORDER BY id;
+
+-- name: DisableUser :exec
+UPDATE users SET disabled_at = CURRENT_TIMESTAMP WHERE id = ? AND disabled_at IS NULL;
+
+-- name: EnableUser :exec
+UPDATE users SET disabled_at = NULL WHERE id = ?;
 
 -- name: GetClientByNamespace :one
 SELECT * FROM clients WHERE namespace = ?;
 
 -- name: CreateAuthorizeSession :exec
-INSERT INTO sessions (auth_code, client_id, pkce_challenge, pkce_challenge_method, state, redirect_uri, expires_at, session_id)
-VALUES (?, ?, ?, ?, ?, ?, NOW() + INTERVAL 10 MINUTE, UUID_TO_BIN(UUID()));
+INSERT INTO sessions (auth_code, client_id, pkce_challenge, pkce_challenge_method, state, redirect_uri, scope, nonce, prompt, login_hint, expires_at, session_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 
 -- name: GetSessionByAuthCode :one
-SELECT s.id, s.session_id, s.user_id, s.auth_code, s.client_id, s.pkce_challenge, s.pkce_challenge_method, s.state, s.redirect_uri, s.created_at, s.expires_at, u.email as user_email
+SELECT s.id, s.session_id, s.user_id, s.auth_code, s.client_id, s.pkce_challenge, s.pkce_challenge_method, s.state, s.redirect_uri, s.scope, s.nonce, s.auth_time, s.mfa_user_id, s.amr, s.prompt, s.login_hint, s.sso_session_id, s.created_at, s.expires_at, u.email as user_email
 FROM sessions s
 LEFT JOIN users u ON s.user_id = u.id
 WHERE s.auth_code = ?;
 
--- name: DeleteSession :exec
-DELETE FROM sessions WHERE auth_code = ?;
-
--- name: CreateUserSession :execresult
-INSERT INTO sessions (session_id, user_id, expires_at)
-VALUES (UUID_TO_BIN(UUID()), ?, NOW() + INTERVAL 24 HOUR);
+-- name: ClearSessionPrompt :exec
+UPDATE sessions SET prompt = '' WHERE auth_code = ?;
 
--- name: GetUserSession :one
-SELECT s.id, s.user_id, s.expires_at, u.email as user_email
-FROM sessions s
-JOIN users u ON s.user_id = u.id
-WHERE s.session_id = UUID_TO_BIN(?);
-
--- name: DeleteUserSession :exec
-DELETE FROM sessions WHERE session_id = UUID_TO_BIN(?);
+-- name: DeleteSession :execrows
+DELETE FROM sessions WHERE auth_code = ?;
 
 -- name: GetUserByAuthCode :one
 SELECT u.id, u.email, u.password 
@@ -46,16 +45,249 @@ JOIN sessions s ON u.id = s.user_id
 WHERE s.auth_code = ?;
 
 -- name: GetClientByID :one
-SELECT id, namespace, name, created_at FROM clients WHERE id = ?;
+SELECT id, namespace, name, client_secret, allowed_scopes, user_pool, require_email_verification, created_at, backchannel_logout_uri, frontchannel_logout_uri FROM clients WHERE id = ?;
 
--- name: GetUserSessionByUserID :one
-SELECT s.id, BIN_TO_UUID(s.session_id) as session_id, s.user_id, s.expires_at, u.email as user_email
-FROM sessions s
-JOIN users u ON s.user_id = u.id
-WHERE s.user_id = ?
-ORDER BY s.created_at DESC LIMIT 1;
+-- name: ListClients :many
+SELECT * FROM clients ORDER BY id;
+
+-- name: CreateClient :exec
+INSERT INTO clients (namespace, name, client_secret, allowed_scopes, user_pool, require_email_verification, backchannel_logout_uri, frontchannel_logout_uri)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: UpdateClient :exec
+UPDATE clients
+SET name = ?, client_secret = ?, allowed_scopes = ?, user_pool = ?, require_email_verification = ?,
+  backchannel_logout_uri = ?, frontchannel_logout_uri = ?
+WHERE id = ?;
+
+-- name: DeleteClient :execrows
+DELETE FROM clients WHERE id = ?;
+
+-- name: DeleteClientSessions :exec
+DELETE FROM sessions WHERE client_id = ?;
+
+-- name: DeleteClientRefreshTokens :exec
+DELETE FROM refresh_tokens WHERE client_id = ?;
 
 -- name: UpdateUserSession :exec
 UPDATE sessions 
-SET user_id = ?
-WHERE auth_code = ?;
\ No newline at end of file
+SET user_id = ?, amr = ?, mfa_user_id = NULL, auth_time = ?, sso_session_id = ?
+WHERE auth_code = ?;
+
+-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (token_hash, family_id, user_id, client_id, scope, auth_time, amr, sso_session_id, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetRefreshTokenByHash :one
+SELECT * FROM refresh_tokens WHERE token_hash = ?;
+
+-- name: MarkRefreshTokenUsed :execrows
+UPDATE refresh_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND used_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE family_id = ? AND revoked_at IS NULL;
+
+-- name: CreateSigningKey :exec
+INSERT INTO signing_keys (kid, algorithm, private_key, status)
+VALUES (?, ?, ?, 'active');
+
+-- name: ListPublishedSigningKeys :many
+SELECT * FROM signing_keys
+WHERE status IN ('active', 'retiring')
+ORDER BY created_at DESC, id DESC;
+
+-- name: MarkSigningKeyRetiring :execrows
+UPDATE signing_keys
+SET status = 'retiring', rotated_at = CURRENT_TIMESTAMP
+WHERE kid = ? AND status = 'active';
+
+-- name: RetireSigningKeys :exec
+UPDATE signing_keys
+SET status = 'retired'
+WHERE status = 'retiring' AND rotated_at < ?;
+
+-- name: ListClientRedirectURIs :many
+SELECT redirect_uri FROM client_redirect_uris WHERE client_id = ?;
+
+-- name: CreateClientRedirectURI :exec
+INSERT INTO client_redirect_uris (client_id, redirect_uri) VALUES (?, ?);
+
+-- name: DeleteClientRedirectURIs :exec
+DELETE FROM client_redirect_uris WHERE client_id = ?;
+
+-- name: RevokeToken :exec
+INSERT IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?);
+
+-- name: IsTokenRevoked :one
+SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?;
+
+-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens WHERE expires_at < ?;
+
+-- name: CreateAccessToken :exec
+INSERT INTO access_tokens (jti, user_id, sso_session_id, expires_at) VALUES (?, ?, ?, ?);
+
+-- name: ListSSOSessionAccessTokens :many
+SELECT * FROM access_tokens WHERE sso_session_id = ? AND expires_at > ?;
+
+-- name: DeleteExpiredAccessTokens :exec
+DELETE FROM access_tokens WHERE expires_at < ?;
+
+-- name: GetConsent :one
+SELECT * FROM consents WHERE user_id = ? AND client_id = ?;
+
+-- name: UpsertConsent :exec
+INSERT INTO consents (user_id, client_id, scope) VALUES (?, ?, ?)
+ON DUPLICATE KEY UPDATE scope = VALUES(scope);
+
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?);
+
+-- name: GetPasswordResetTokenByHash :one
+SELECT * FROM password_reset_tokens WHERE token_hash = ?;
+
+-- name: MarkPasswordResetTokenUsed :execrows
+UPDATE password_reset_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND used_at IS NULL;
+
+-- name: ReleasePasswordResetToken :exec
+UPDATE password_reset_tokens SET used_at = NULL WHERE id = ?;
+
+-- name: DeletePasswordResetTokensByUserID :exec
+DELETE FROM password_reset_tokens WHERE user_id = ?;
+
+-- name: UpdateUserPassword :exec
+UPDATE users SET password = ? WHERE id = ?;
+
+-- name: DeleteUserSessionsByUserID :exec
+DELETE FROM sessions WHERE user_id = ?;
+
+-- name: CreateSSOSession :exec
+INSERT INTO sso_sessions (user_id, token_hash, sid, amr, auth_time, expires_at) VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: GetSSOSessionByHash :one
+SELECT * FROM sso_sessions WHERE token_hash = ?;
+
+-- name: GetSSOSessionByID :one
+SELECT * FROM sso_sessions WHERE id = ?;
+
+-- name: AddSSOSessionClient :exec
+INSERT IGNORE INTO sso_session_clients (sso_session_id, client_id) VALUES (?, ?);
+
+-- name: ListSSOSessionClients :many
+SELECT c.* FROM clients c
+JOIN sso_session_clients sc ON sc.client_id = c.id
+WHERE sc.sso_session_id = ?
+ORDER BY c.id;
+
+-- name: DeleteSSOSession :exec
+DELETE FROM sso_sessions WHERE token_hash = ?;
+
+-- name: DeleteSSOSessionsByUserID :exec
+DELETE FROM sso_sessions WHERE user_id = ?;
+
+-- name: DeleteExpiredSSOSessions :exec
+DELETE FROM sso_sessions WHERE expires_at < ?;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND revoked_at IS NULL;
+
+-- name: RevokeSSOSessionRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE sso_session_id = ? AND revoked_at IS NULL;
+
+-- name: SetUserEmailVerified :exec
+UPDATE users SET email_verified = TRUE WHERE id = ?;
+
+-- name: MarkVerificationSent :execrows
+UPDATE users
+SET verification_sent_at = CURRENT_TIMESTAMP
+WHERE id = ? AND (verification_sent_at IS NULL OR verification_sent_at < ?);
+
+-- name: SetSessionMFAPending :exec
+UPDATE sessions SET mfa_user_id = ? WHERE auth_code = ?;
+
+-- name: GetTOTPCredentialByUserID :one
+SELECT * FROM totp_credentials WHERE user_id = ?;
+
+-- name: UpsertTOTPCredential :exec
+INSERT INTO totp_credentials (user_id, secret) VALUES (?, ?)
+ON DUPLICATE KEY UPDATE secret = VALUES(secret), confirmed_at = NULL, last_used_step = 0;
+
+-- name: ConfirmTOTPCredential :exec
+UPDATE totp_credentials SET confirmed_at = CURRENT_TIMESTAMP WHERE user_id = ?;
+
+-- name: UseTOTPStep :execrows
+UPDATE totp_credentials
+SET last_used_step = ?
+WHERE user_id = ? AND last_used_step < ?;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?);
+
+-- name: ListUnusedRecoveryCodes :many
+SELECT * FROM recovery_codes WHERE user_id = ? AND used_at IS NULL;
+
+-- name: MarkRecoveryCodeUsed :execrows
+UPDATE recovery_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodesByUserID :exec
+DELETE FROM recovery_codes WHERE user_id = ?;
+
+-- name: CreateWebAuthnChallenge :exec
+INSERT INTO webauthn_challenges (challenge, ceremony, user_id, expires_at) VALUES (?, ?, ?, ?);
+
+-- name: GetWebAuthnChallenge :one
+SELECT * FROM webauthn_challenges WHERE challenge = ?;
+
+-- name: DeleteWebAuthnChallenge :execrows
+DELETE FROM webauthn_challenges WHERE id = ?;
+
+-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- name: CreateWebAuthnCredential :exec
+INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, aaguid, attestation_format, transports, name)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetWebAuthnCredentialByCredentialID :one
+SELECT * FROM webauthn_credentials WHERE credential_id = ?;
+
+-- name: ListWebAuthnCredentialsByUserID :many
+SELECT * FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at;
+
+-- name: UpdateWebAuthnSignCount :exec
+UPDATE webauthn_credentials SET sign_count = ?, last_used_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: RecordFailedLogin :exec
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1, last_failed_login_at = ?
+WHERE id = ?;
+
+-- name: LockUser :execrows
+UPDATE users
+SET locked_until = ?, failed_login_attempts = 0
+WHERE id = ? AND (locked_until IS NULL OR locked_until < ?);
+
+-- name: UnlockUser :exec
+UPDATE users
+SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL
+WHERE id = ?;
+
+-- name: IncrementRateLimitCounter :execresult
+-- LAST_INSERT_ID(expr) hands the incremented count back without a second query
+INSERT INTO rate_limit_counters (bucket, expires_at) VALUES (?, ?)
+ON DUPLICATE KEY UPDATE count = LAST_INSERT_ID(count + 1);
+
+-- name: DeleteExpiredRateLimitCounters :exec
+DELETE FROM rate_limit_counters WHERE expires_at < ?;
@@ -3,23 +3,56 @@ package routes
 import (
 	"auth_go/db"
 	"auth_go/dbcommon"
+	"auth_go/utils"
 	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/base64"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+// authorizeSessionLifetime is how long a user has to log in and consent before the request expires
+const authorizeSessionLifetime = 10 * time.Minute
+
+// AuthorizeParams are the parameters of an authorization request. Only the ones needed to know
+// where errors may be redirected to are bound as required, the others are checked by validate.
 type AuthorizeParams struct {
-	ResponseType        string `form:"response_type" binding:"required"`
+	ResponseType        string `form:"response_type"`
 	Namespace           string `form:"namespace" binding:"required"`
 	RedirectURI         string `form:"redirect_uri" binding:"required"`
-	CodeChallenge       string `form:"code_challenge" binding:"required"`
-	CodeChallengeMethod string `form:"code_challenge_method" binding:"required"`
-	State               string `form:"state" binding:"required"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	State               string `form:"state"`
+	Scope               string `form:"scope"`
+	Nonce               string `form:"nonce"`
+	Prompt              string `form:"prompt"`
+	MaxAge              string `form:"max_age"`
+	LoginHint           string `form:"login_hint"`
+}
+
+// validate checks the parameters whose errors are redirected back to the client
+func (p AuthorizeParams) validate() *OAuthError {
+	switch {
+	case p.ResponseType == "":
+		return invalidRequest("The response_type parameter is required")
+	case p.ResponseType != "code":
+		return unsupportedResponseType("Only the code response type is supported")
+	case p.State == "":
+		return invalidRequest("The state parameter is required")
+	case p.CodeChallenge == "":
+		return invalidRequest("PKCE is required, the code_challenge parameter is missing")
+	case p.CodeChallengeMethod != "S256" && p.CodeChallengeMethod != "plain":
+		return invalidRequest("The code_challenge_method must be S256 or plain")
+	}
+	return nil
 }
 
 func generateAuthCode() (string, error) {
@@ -34,15 +67,9 @@ func Authorize(db *db.Db) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var params AuthorizeParams
 		if err := c.ShouldBindQuery(&params); err != nil {
+			// Without a client and redirect URI there is nowhere to send the error to
 			log.Printf("Invalid parameters: %v", err)
-			http.Error(c.Writer, "Invalid parameters", http.StatusBadRequest)
-			return
-		}
-
-		// Validate response_type
-		if params.ResponseType != "code" {
-			log.Printf("Invalid response_type: %s", params.ResponseType)
-			http.Error(c.Writer, "Invalid response_type", http.StatusBadRequest)
+			renderError(c, http.StatusBadRequest, "The namespace and redirect_uri parameters are required")
 			return
 		}
 
@@ -51,22 +78,75 @@ func Authorize(db *db.Db) gin.HandlerFunc {
 		client, err := db.Queries.GetClientByNamespace(ctx, params.Namespace)
 		if err != nil {
 			log.Printf("Failed to get client by namespace %s: %v", params.Namespace, err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid namespace"})
+			renderError(c, http.StatusBadRequest, "Invalid namespace")
 			return
 		}
 
-		// Get session ID from cookie
-		authCode, err := c.Cookie("auth_code")
+		// Only ever redirect to a URI registered for the client
+		registered, err := isRegisteredRedirectURI(ctx, db, client.ID, params.RedirectURI)
 		if err != nil {
+			log.Printf("Failed to get redirect URIs for client %d: %v", client.ID, err)
+			renderError(c, http.StatusInternalServerError, "Failed to validate redirect URI")
+			return
+		}
+		if !registered {
+			log.Printf("Unregistered redirect_uri for client %d: %s", client.ID, params.RedirectURI)
+			renderError(c, http.StatusBadRequest, "The redirect URI is not registered for this client")
+			return
+		}
+
+		// The redirect URI is trusted, from here on errors are sent back to the client
+		if oauthErr := params.validate(); oauthErr != nil {
+			log.Printf("Invalid authorization request for client %d: %v", client.ID, oauthErr)
+			redirectError(c, params.RedirectURI, params.State, oauthErr)
+			return
+		}
+
+		// Only allow scopes the client has declared
+		if !utils.ScopeSubset(params.Scope, client.AllowedScopes) {
+			log.Printf("Client %d requested scope %q outside of %q", client.ID, params.Scope, client.AllowedScopes)
+			redirectError(c, params.RedirectURI, params.State, invalidScope("The requested scope is not allowed for this client"))
+			return
+		}
+		params.Scope = strings.Join(utils.ParseScope(params.Scope), " ")
+
+		// prompt and max_age decide whether the login form can be skipped
+		prompt, err := parsePrompt(params.Prompt)
+		if err != nil {
+			log.Printf("Invalid prompt for client %d: %v", client.ID, err)
+			redirectError(c, params.RedirectURI, params.State, invalidRequest("Invalid prompt parameter"))
+			return
+		}
+		notBefore, err := authTimeLimit(params.MaxAge, time.Now())
+		if err != nil {
+			log.Printf("Invalid max_age for client %d: %v", client.ID, err)
+			redirectError(c, params.RedirectURI, params.State, invalidRequest("Invalid max_age parameter"))
+			return
+		}
+
+		authSession, ok := continuedAuthorizeSession(ctx, c, db, client.ID, params)
+		if !ok {
+			// Users with an SSO session skip the login form, unless the client asks for a new login
+			var sso dbcommon.SsoSession
+			var loggedIn bool
+			if !hasPrompt(prompt, promptLogin) && !hasPrompt(prompt, promptSelectAccount) {
+				sso, loggedIn = clientSSOSession(ctx, c, db, client, notBefore)
+			}
+			if !loggedIn && prompt == promptNone {
+				redirectError(c, params.RedirectURI, params.State, loginRequired("The user has to log in"))
+				return
+			}
+
 			// Generate authorization code
 			authCode, err := generateAuthCode()
 			if err != nil {
 				log.Printf("Failed to generate authorization code: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate authorization code"})
+				redirectError(c, params.RedirectURI, params.State, serverError("Failed to generate authorization code"))
 				return
 			}
 
 			// Store authorization request parameters in database
+			sessionID := uuid.New()
 			createParams := dbcommon.CreateAuthorizeSessionParams{
 				AuthCode:            authCode,
 				ClientID:            client.ID,
@@ -74,47 +154,130 @@ func Authorize(db *db.Db) gin.HandlerFunc {
 				PkceChallengeMethod: params.CodeChallengeMethod,
 				State:               params.State,
 				RedirectUri:         params.RedirectURI,
+				Scope:               params.Scope,
+				Nonce:               params.Nonce,
+				Prompt:              prompt,
+				LoginHint:           params.LoginHint,
+				ExpiresAt:           time.Now().Add(authorizeSessionLifetime),
+				SessionID:           sessionID[:],
 			}
 
 			if err := db.Queries.CreateAuthorizeSession(ctx, createParams); err != nil {
 				log.Printf("Failed to create authorization session: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create authorization session"})
+				redirectError(c, params.RedirectURI, params.State, serverError("Failed to create authorization session"))
 				return
 			}
 
 			// Set auth code in cookie
-			c.SetCookie(
-				"auth_code", // name
-				authCode,    // value
-				3600,        // max age in seconds
-				"/",         // path
-				"",          // domain
-				true,        // secure (HTTPS only)
-				true,        // httpOnly
-			)
+			setCookie(c, "auth_code", authCode, 3600)
 
 			// Redirect to login page
+			if !loggedIn {
+				c.Redirect(http.StatusFound, "/login")
+				return
+			}
+
+			if err := resumeSSOSession(ctx, db, sso, authCode); err != nil {
+				log.Printf("Failed to resume SSO session of user %d: %v", sso.UserID, err)
+				redirectError(c, params.RedirectURI, params.State, serverError("Failed to update session"))
+				return
+			}
+			authSession, err = db.Queries.GetSessionByAuthCode(ctx, authCode)
+			if err != nil {
+				log.Printf("Failed to get authorization session: %v", err)
+				redirectError(c, params.RedirectURI, params.State, serverError("Failed to get authorization session"))
+				return
+			}
+		}
+
+		// The user has to log in before a code can be issued
+		if !authSession.UserID.Valid {
 			c.Redirect(http.StatusFound, "/login")
 			return
 		}
 
+		// Ask for consent to any scope the user hasn't granted this client yet
+		pending, err := consentPending(ctx, db, authSession)
+		if err != nil {
+			log.Printf("Failed to get consent for user %d: %v", authSession.UserID.Int64, err)
+			redirectError(c, params.RedirectURI, params.State, serverError("Failed to check consent"))
+			return
+		}
+		if pending {
+			if authSession.Prompt == promptNone {
+				endAuthorizeSession(ctx, c, db, authSession.AuthCode)
+				redirectError(c, params.RedirectURI, params.State, consentRequired("The user has to consent to the requested scope"))
+				return
+			}
+			c.Redirect(http.StatusFound, "/consent")
+			return
+		}
+
 		// Clear auth code cookie after successful authorization
-		c.SetCookie(
-			"auth_code", // name
-			"",          // value
-			-1,          // max age (negative to expire immediately)
-			"/",         // path
-			"",          // domain
-			true,        // secure (HTTPS only)
-			true,        // httpOnly
-		)
+		setCookie(c, "auth_code", "", -1)
 
 		// Redirect back to client with authorization code
-		redirectURL := fmt.Sprintf("%s?code=%s&state=%s",
-			params.RedirectURI,
-			authCode,
-			params.State)
+		redirectURL, err := buildRedirectURL(params.RedirectURI, url.Values{
+			"code":  {authSession.AuthCode},
+			"state": {params.State},
+		})
+		if err != nil {
+			log.Printf("Failed to build redirect URL from %s: %v", params.RedirectURI, err)
+			renderError(c, http.StatusBadRequest, "Invalid redirect URI")
+			return
+		}
 
 		c.Redirect(http.StatusFound, redirectURL)
 	}
 }
+
+// continuedAuthorizeSession returns the authorization request of the auth_code cookie when this
+// call continues it after login or consent. The cookie of an abandoned request doesn't match,
+// a new request is started instead.
+func continuedAuthorizeSession(ctx context.Context, c *gin.Context, db *db.Db, clientID int64, params AuthorizeParams) (dbcommon.GetSessionByAuthCodeRow, bool) {
+	authCode, err := c.Cookie("auth_code")
+	if err != nil {
+		return dbcommon.GetSessionByAuthCodeRow{}, false
+	}
+
+	authSession, err := db.Queries.GetSessionByAuthCode(ctx, authCode)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to get authorization session: %v", err)
+		}
+		return dbcommon.GetSessionByAuthCodeRow{}, false
+	}
+	if authSession.ClientID != clientID || authSession.RedirectUri != params.RedirectURI ||
+		authSession.State != params.State || authSession.PkceChallenge != params.CodeChallenge ||
+		!authSession.ExpiresAt.After(time.Now()) {
+		return dbcommon.GetSessionByAuthCodeRow{}, false
+	}
+	return authSession, true
+}
+
+// endAuthorizeSession deletes an authorization request that ended without a code, so it can't be resumed
+func endAuthorizeSession(ctx context.Context, c *gin.Context, db *db.Db, authCode string) {
+	if _, err := db.Queries.DeleteSession(ctx, authCode); err != nil {
+		log.Printf("Error deleting session %s: %v", authCode, err)
+	}
+	setCookie(c, "auth_code", "", -1)
+}
+
+// authorizeURL rebuilds the /authorize request an authorization session was started with
+func authorizeURL(namespace string, authSession dbcommon.GetSessionByAuthCodeRow) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"namespace":             {namespace},
+		"redirect_uri":          {authSession.RedirectUri},
+		"code_challenge":        {authSession.PkceChallenge},
+		"code_challenge_method": {authSession.PkceChallengeMethod},
+		"state":                 {authSession.State},
+	}
+	if authSession.Scope != "" {
+		query.Set("scope", authSession.Scope)
+	}
+	if authSession.Nonce != "" {
+		query.Set("nonce", authSession.Nonce)
+	}
+	return "/authorize?" + query.Encode()
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidClient       = errors.New("client authentication failed")
+	errClientNotIdentified = errors.New("no client identifier provided")
+)
+
+// clientCredentials holds how the caller identified itself on an endpoint that authenticates clients.
+// ID is the client namespace.
+type clientCredentials struct {
+	ID     string
+	Secret string
+	Basic  bool
+}
+
+// readClientCredentials reads client_secret_basic credentials from the Authorization header,
+// falling back to the client_id and client_secret (client_secret_post) values from the body.
+func readClientCredentials(c *gin.Context, clientID, clientSecret string) (clientCredentials, error) {
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		// RFC 6749 2.3.1 form-encodes both values before base64 encoding them
+		id, err := url.QueryUnescape(id)
+		if err != nil {
+			return clientCredentials{Basic: true}, errInvalidClient
+		}
+		secret, err = url.QueryUnescape(secret)
+		if err != nil {
+			return clientCredentials{Basic: true}, errInvalidClient
+		}
+		if clientSecret != "" {
+			// Using more than one authentication method is not allowed
+			return clientCredentials{Basic: true}, errInvalidClient
+		}
+		return clientCredentials{ID: id, Secret: secret, Basic: true}, nil
+	}
+
+	if clientID == "" {
+		return clientCredentials{}, errClientNotIdentified
+	}
+	return clientCredentials{ID: clientID, Secret: clientSecret}, nil
+}
+
+// authenticateClient looks up the client and verifies its secret when it is a confidential client.
+// Public clients have no secret and must not send one.
+func authenticateClient(ctx context.Context, db *db.Db, creds clientCredentials) (dbcommon.Client, error) {
+	client, err := db.Queries.GetClientByNamespace(ctx, creds.ID)
+	if err != nil {
+		return dbcommon.Client{}, errInvalidClient
+	}
+
+	if !client.ClientSecret.Valid {
+		if creds.Secret != "" {
+			return dbcommon.Client{}, errInvalidClient
+		}
+		return client, nil
+	}
+
+	if creds.Secret == "" {
+		return dbcommon.Client{}, errInvalidClient
+	}
+	match, err := utils.ComparePasswordAndHash(creds.Secret, client.ClientSecret.String)
+	if err != nil || !match {
+		return dbcommon.Client{}, errInvalidClient
+	}
+
+	return client, nil
+}
+
+// isConfidentialClient reports whether the client authenticates with a secret
+func isConfidentialClient(client dbcommon.Client) bool {
+	return client.ClientSecret.Valid
+}
+
+// abortInvalidClient responds to a failed client authentication
+func abortInvalidClient(c *gin.Context, creds clientCredentials) {
+	if creds.Basic {
+		c.Header("WWW-Authenticate", `Basic realm="token"`)
+	}
+	abortWithError(c, invalidClient("Client authentication failed"))
+}
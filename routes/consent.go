@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scopeDescriptions explains the known scopes on the consent page
+var scopeDescriptions = map[string]string{
+	"openid":  "Sign you in with your account",
+	"profile": "See your first and last name",
+	"email":   "See your email address",
+}
+
+type ScopeDescription struct {
+	Scope       string
+	Description string
+}
+
+type ConsentInput struct {
+	Action string `form:"action" binding:"required"`
+}
+
+// consentSession loads the logged in authorization session from the auth_code cookie
+func consentSession(c *gin.Context, db *db.Db) (dbcommon.GetSessionByAuthCodeRow, dbcommon.Client, bool) {
+	ctx := context.Background()
+
+	authCode, err := c.Cookie("auth_code")
+	if err != nil {
+		log.Printf("Error getting auth code from cookie: %v", err)
+		renderError(c, http.StatusBadRequest, "No authorization request found")
+		return dbcommon.GetSessionByAuthCodeRow{}, dbcommon.Client{}, false
+	}
+
+	authSession, err := db.Queries.GetSessionByAuthCode(ctx, authCode)
+	if err != nil || !authSession.UserID.Valid {
+		log.Printf("Error getting logged in session by auth code: %v", err)
+		renderError(c, http.StatusBadRequest, "Invalid authorization request")
+		return dbcommon.GetSessionByAuthCodeRow{}, dbcommon.Client{}, false
+	}
+
+	client, err := db.Queries.GetClientByID(ctx, authSession.ClientID)
+	if err != nil {
+		log.Printf("Error getting client by ID: %v", err)
+		renderError(c, http.StatusBadRequest, "Invalid client")
+		return dbcommon.GetSessionByAuthCodeRow{}, dbcommon.Client{}, false
+	}
+
+	return authSession, client, true
+}
+
+// grantedScope returns the scope the user has already consented to for the client
+func grantedScope(ctx context.Context, db *db.Db, userID, clientID int64) (string, error) {
+	consent, err := db.Queries.GetConsent(ctx, dbcommon.GetConsentParams{
+		UserID:   userID,
+		ClientID: clientID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return consent.Scope, err
+}
+
+// consentPending reports whether the user still has to consent to the scope of the authorization
+// request, either because part of it was never granted or because the client asked to be asked again
+func consentPending(ctx context.Context, db *db.Db, authSession dbcommon.GetSessionByAuthCodeRow) (bool, error) {
+	if authSession.Scope == "" {
+		return false, nil
+	}
+	if hasPrompt(authSession.Prompt, promptConsent) {
+		return true, nil
+	}
+	granted, err := grantedScope(ctx, db, authSession.UserID.Int64, authSession.ClientID)
+	if err != nil {
+		return false, err
+	}
+	return !utils.ScopeSubset(authSession.Scope, granted), nil
+}
+
+func ConsentPage(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authSession, client, ok := consentSession(c, db)
+		if !ok {
+			return
+		}
+
+		granted, err := grantedScope(context.Background(), db, authSession.UserID.Int64, client.ID)
+		if err != nil {
+			log.Printf("Error getting consent: %v", err)
+			renderError(c, http.StatusInternalServerError, "Failed to get consent")
+			return
+		}
+
+		// Only list the scopes that haven't been granted before, unless the client asked for consent again
+		reconsent := hasPrompt(authSession.Prompt, promptConsent)
+		var scopes []ScopeDescription
+		for _, scope := range utils.ParseScope(authSession.Scope) {
+			if utils.HasScope(granted, scope) && !reconsent {
+				continue
+			}
+			description, ok := scopeDescriptions[scope]
+			if !ok {
+				description = scope
+			}
+			scopes = append(scopes, ScopeDescription{Scope: scope, Description: description})
+		}
+
+		c.HTML(http.StatusOK, "consent.html", gin.H{
+			"NamespaceName": client.Name,
+			"Scopes":        scopes,
+		})
+	}
+}
+
+func Consent(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ConsentInput
+		if err := c.ShouldBind(&input); err != nil {
+			log.Printf("Error binding consent input: %v", err)
+			renderError(c, http.StatusBadRequest, "Invalid input")
+			return
+		}
+
+		authSession, client, ok := consentSession(c, db)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+
+		if input.Action != "approve" {
+			// The request is over, the code must not be usable later
+			endAuthorizeSession(ctx, c, db, authSession.AuthCode)
+			redirectError(c, authSession.RedirectUri, authSession.State, accessDenied("The user denied the request"))
+			return
+		}
+
+		granted, err := grantedScope(ctx, db, authSession.UserID.Int64, client.ID)
+		if err != nil {
+			log.Printf("Error getting consent: %v", err)
+			renderError(c, http.StatusInternalServerError, "Failed to get consent")
+			return
+		}
+
+		err = db.Queries.UpsertConsent(ctx, dbcommon.UpsertConsentParams{
+			UserID:   authSession.UserID.Int64,
+			ClientID: client.ID,
+			Scope:    utils.MergeScopes(granted, authSession.Scope),
+		})
+		if err != nil {
+			log.Printf("Error storing consent: %v", err)
+			renderError(c, http.StatusInternalServerError, "Failed to store consent")
+			return
+		}
+
+		// prompt=consent is satisfied, /authorize must not ask again
+		if err := db.Queries.ClearSessionPrompt(ctx, authSession.AuthCode); err != nil {
+			log.Printf("Error clearing prompt of session %s: %v", authSession.AuthCode, err)
+			renderError(c, http.StatusInternalServerError, "Failed to store consent")
+			return
+		}
+
+		c.Redirect(http.StatusFound, authorizeURL(client.Namespace, authSession))
+	}
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"auth_go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setCookie sets an HTTP only cookie with the configured cookie attributes, a negative maxAge deletes it
+func setCookie(c *gin.Context, name, value string, maxAge int) {
+	opts := utils.Cookies()
+	c.SetSameSite(opts.SameSite)
+	c.SetCookie(name, value, maxAge, "/", opts.Domain, opts.Secure, true)
+}
@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"auth_go/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenIDConfiguration serves the OpenID Connect discovery document
+func OpenIDConfiguration() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		issuer := utils.Issuer()
+
+		c.JSON(http.StatusOK, gin.H{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"userinfo_endpoint":                     issuer + "/userinfo",
+			"revocation_endpoint":                   issuer + "/revoke",
+			"introspection_endpoint":                issuer + "/introspect",
+			"end_session_endpoint":                  issuer + "/logout",
+			"jwks_uri":                              issuer + "/.well-known/jwks.json",
+			"response_types_supported":              []string{"code"},
+			"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": utils.SigningAlgorithms(),
+			"scopes_supported":                      []string{"openid", "email", "profile"},
+			"token_endpoint_auth_methods_supported": []string{"none", "client_secret_basic", "client_secret_post"},
+			"code_challenge_methods_supported":      []string{"plain", "S256"},
+			"backchannel_logout_supported":          true,
+			"backchannel_logout_session_supported":  true,
+			"frontchannel_logout_supported":         true,
+			"frontchannel_logout_session_supported": true,
+			"claims_supported": []string{
+				"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr", "sid",
+				"email", "email_verified", "given_name", "family_name",
+			},
+		})
+	}
+}
+
+// JWKS serves the public keys tokens are signed with
+func JWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"keys": utils.JSONWebKeySet()})
+	}
+}
@@ -0,0 +1,621 @@
+package routes
+
+import (
+	"auth_go/backchannel"
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/keys"
+	"auth_go/lockout"
+	"auth_go/utils"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	testNamespace   = "app"
+	testRedirectURI = "https://app.example/callback"
+	testEmail       = "jane@example.com"
+	testPassword    = "correct horse battery staple"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// testServer is the service wired to an in-memory store with one public client and one user
+type testServer struct {
+	router *gin.Engine
+	db     *db.Db
+	store  *db.MemoryStore
+	client dbcommon.Client
+	user   dbcommon.User
+	guard  *lockout.Guard
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	// Plain HTTP, the test browser doesn't send Secure cookies anywhere else
+	utils.SetCookieOptions(utils.CookieOptions{SameSite: http.SameSiteLaxMode})
+	utils.SetSessionKey([]byte("test session key of at least 32 bytes"))
+
+	store := db.NewMemoryStore()
+	database := db.NewDb(store)
+	utils.SetRevocationStore(database)
+
+	keyManager, err := keys.NewManager(database, "ES256", time.Hour, utils.AccessTokenLifetime, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyManager.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	client := createTestClient(t, store, testNamespace)
+	err = store.CreateClientRedirectURI(ctx, dbcommon.CreateClientRedirectURIParams{ClientID: client.ID, RedirectUri: testRedirectURI})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := utils.GenerateFromPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreateUser(ctx, dbcommon.CreateUserParams{
+		NamespaceID: globalUserPool,
+		Email:       testEmail,
+		Password:    hash,
+		Uuid:        uuid.NewString(),
+		Firstname:   "Jane",
+		Lastname:    "Doe",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{NamespaceID: globalUserPool, Email: testEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retry failed back-channel deliveries without making the tests wait
+	logoutNotifier := backchannel.NewNotifier(3, time.Second)
+	logoutNotifier.Backoff = 10 * time.Millisecond
+
+	guard := lockout.NewGuard(lockout.Policy{Threshold: 5, Duration: time.Minute}, lockout.Notifiers{})
+
+	r := gin.New()
+	r.LoadHTMLGlob("../templates/*")
+	r.GET("/authorize", Authorize(database))
+	r.GET("/login", LoginPage(database))
+	r.POST("/login", Login(database, guard))
+	r.POST("/login/webauthn/begin", BeginWebAuthnLogin(database))
+	r.POST("/login/webauthn/finish", FinishWebAuthnLogin(database, guard))
+	r.GET("/consent", ConsentPage(database))
+	r.POST("/consent", Consent(database))
+	r.GET("/logout", EndSession(database, false, logoutNotifier))
+	r.POST("/logout", EndSession(database, false, logoutNotifier))
+	r.POST("/token", Token(database))
+	r.GET("/validate", Validate(database))
+	r.GET("/userinfo", UserInfo(database))
+	r.POST("/introspect", Introspect(database))
+	r.POST("/revoke", Revoke(database))
+	r.POST("/webauthn/register/begin", BeginWebAuthnRegistration(database))
+	r.POST("/webauthn/register/finish", FinishWebAuthnRegistration(database))
+
+	return &testServer{router: r, db: database, store: store, client: client, user: user, guard: guard}
+}
+
+// createTestClient registers a public client
+func createTestClient(t *testing.T, store db.Store, namespace string) dbcommon.Client {
+	t.Helper()
+	ctx := context.Background()
+
+	err := store.CreateClient(ctx, dbcommon.CreateClientParams{
+		Namespace:     namespace,
+		Name:          "Test App",
+		AllowedScopes: "openid profile email",
+		UserPool:      UserPoolGlobal,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := store.GetClientByNamespace(ctx, namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// browser sends requests to the server, keeping cookies between them like a user agent
+type browser struct {
+	t       *testing.T
+	server  *testServer
+	cookies map[string]*http.Cookie
+}
+
+func (s *testServer) browser(t *testing.T) *browser {
+	return &browser{t: t, server: s, cookies: map[string]*http.Cookie{}}
+}
+
+func (b *browser) do(method, target string, form url.Values) *http.Response {
+	b.t.Helper()
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req := httptest.NewRequest(method, target, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return b.send(req)
+}
+
+// doJSON posts v as JSON, as the WebAuthn script of the login page does
+func (b *browser) doJSON(target string, v any) *http.Response {
+	b.t.Helper()
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return b.send(req)
+}
+
+// send sends the request with the browser's cookies and keeps the ones set in the response
+func (b *browser) send(req *http.Request) *http.Response {
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	b.server.router.ServeHTTP(rec, req)
+	resp := rec.Result()
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(b.cookies, cookie.Name)
+		} else {
+			b.cookies[cookie.Name] = cookie
+		}
+	}
+	return resp
+}
+
+// expectRedirect checks the response is a redirect and returns where to
+func (b *browser) expectRedirect(resp *http.Response) *url.URL {
+	b.t.Helper()
+
+	if resp.StatusCode != http.StatusFound {
+		body, _ := io.ReadAll(resp.Body)
+		b.t.Fatalf("got status %d, want redirect: %s", resp.StatusCode, body)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return location
+}
+
+// authorizeQuery builds the parameters the client sends to /authorize
+func authorizeQuery(challenge, method, scope string) url.Values {
+	query := url.Values{
+		"response_type":         {"code"},
+		"namespace":             {testNamespace},
+		"redirect_uri":          {testRedirectURI},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {method},
+		"state":                 {"xyz"},
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	return query
+}
+
+// authorize runs the user through /authorize, /login, consent when asked for and /authorize again,
+// returning the code handed to the client
+func (b *browser) authorize(challenge, method, scope string) string {
+	b.t.Helper()
+
+	query := authorizeQuery(challenge, method, scope)
+	location := b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+	if location.Path != "/login" {
+		b.t.Fatalf("authorize redirected to %s, want /login", location)
+	}
+	if _, ok := b.cookies["auth_code"]; !ok {
+		b.t.Fatal("authorize did not set the auth_code cookie")
+	}
+
+	if resp := b.do(http.MethodGet, "/login", nil); resp.StatusCode != http.StatusOK {
+		b.t.Fatalf("login page returned %d", resp.StatusCode)
+	}
+
+	location = b.expectRedirect(b.do(http.MethodPost, "/login", url.Values{
+		"username":     {testEmail},
+		"password":     {testPassword},
+		"namespace_id": {strconv.FormatInt(b.server.client.ID, 10)},
+	}))
+	if location.Path != "/authorize" {
+		b.t.Fatalf("login redirected to %s, want /authorize", location)
+	}
+
+	location = b.expectRedirect(b.do(http.MethodGet, location.String(), nil))
+	if location.Path == "/consent" {
+		if resp := b.do(http.MethodGet, "/consent", nil); resp.StatusCode != http.StatusOK {
+			b.t.Fatalf("consent page returned %d", resp.StatusCode)
+		}
+		location = b.expectRedirect(b.do(http.MethodPost, "/consent", url.Values{"action": {"approve"}}))
+		location = b.expectRedirect(b.do(http.MethodGet, location.String(), nil))
+	}
+
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURI {
+		b.t.Fatalf("authorize redirected to %s, want %s", location, testRedirectURI)
+	}
+	if state := location.Query().Get("state"); state != "xyz" {
+		b.t.Fatalf("got state %q, want xyz", state)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		b.t.Fatalf("no code in redirect %s", location)
+	}
+	return code
+}
+
+// exchange redeems a code at the token endpoint
+func (b *browser) exchange(code, verifier string) *http.Response {
+	b.t.Helper()
+
+	return b.do(http.MethodPost, "/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {testNamespace},
+	})
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func decodeJSON(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("got status %d, want %d: %s", resp.StatusCode, status, body)
+	}
+}
+
+// expectNoStore checks a token response forbids caching (RFC 6749 section 5.1)
+func expectNoStore(t *testing.T, resp *http.Response) {
+	t.Helper()
+
+	if got := resp.Header.Get("Cache-Control"); got != "no-store" {
+		t.Errorf("got Cache-Control %q, want no-store", got)
+	}
+	if got := resp.Header.Get("Pragma"); got != "no-cache" {
+		t.Errorf("got Pragma %q, want no-cache", got)
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		challenge string
+		scope     string
+	}{
+		{name: "S256", method: "S256", challenge: s256(testVerifier)},
+		{name: "plain", method: "plain", challenge: testVerifier},
+		{name: "openid with consent", method: "S256", challenge: s256(testVerifier), scope: "openid email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			b := server.browser(t)
+
+			code := b.authorize(tt.challenge, tt.method, tt.scope)
+			if _, ok := b.cookies["auth_code"]; ok {
+				t.Error("auth_code cookie was not cleared once the code was issued")
+			}
+
+			resp := b.exchange(code, testVerifier)
+			expectStatus(t, resp, http.StatusOK)
+			expectNoStore(t, resp)
+
+			var tokens struct {
+				AccessToken  string `json:"access_token"`
+				TokenType    string `json:"token_type"`
+				RefreshToken string `json:"refresh_token"`
+				IDToken      string `json:"id_token"`
+				Scope        string `json:"scope"`
+			}
+			decodeJSON(t, resp, &tokens)
+			if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.TokenType != "Bearer" {
+				t.Fatalf("incomplete token response %+v", tokens)
+			}
+			if tokens.Scope != tt.scope {
+				t.Errorf("got scope %q, want %q", tokens.Scope, tt.scope)
+			}
+			if wantID := tt.scope != ""; (tokens.IDToken != "") != wantID {
+				t.Errorf("got id_token %q, want one: %v", tokens.IDToken, wantID)
+			}
+
+			resp = b.refresh(tokens.RefreshToken)
+			expectStatus(t, resp, http.StatusOK)
+			expectNoStore(t, resp)
+
+			resp = b.do(http.MethodGet, "/validate", nil)
+			expectStatus(t, resp, http.StatusOK)
+			var validated struct {
+				UserUUID string `json:"user_uuid"`
+			}
+			decodeJSON(t, resp, &validated)
+			if validated.UserUUID != server.user.Uuid {
+				t.Errorf("validated user %q, want %q", validated.UserUUID, server.user.Uuid)
+			}
+		})
+	}
+}
+
+func TestAuthorizationCodeWrongVerifier(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		challenge string
+		verifier  string
+	}{
+		{name: "S256", method: "S256", challenge: s256(testVerifier), verifier: testVerifier + "x"},
+		{name: "S256 challenge sent as verifier", method: "S256", challenge: s256(testVerifier), verifier: s256(testVerifier)},
+		{name: "plain", method: "plain", challenge: testVerifier, verifier: testVerifier + "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			b := server.browser(t)
+
+			code := b.authorize(tt.challenge, tt.method, "")
+			expectStatus(t, b.exchange(code, tt.verifier), http.StatusBadRequest)
+
+			if _, ok := b.cookies["token"]; ok {
+				t.Error("token cookie set for a failed exchange")
+			}
+			expectStatus(t, b.do(http.MethodGet, "/validate", nil), http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestAuthorizationCodeReused(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+
+	code := b.authorize(s256(testVerifier), "S256", "")
+	expectStatus(t, b.exchange(code, testVerifier), http.StatusOK)
+	expectStatus(t, b.exchange(code, testVerifier), http.StatusBadRequest)
+}
+
+// expiredSessions makes every authorization session look like it expired a minute ago
+type expiredSessions struct {
+	db.Store
+}
+
+func (s expiredSessions) GetSessionByAuthCode(ctx context.Context, authCode string) (dbcommon.GetSessionByAuthCodeRow, error) {
+	session, err := s.Store.GetSessionByAuthCode(ctx, authCode)
+	session.ExpiresAt = time.Now().Add(-time.Minute)
+	return session, err
+}
+
+func TestAuthorizationCodeExpired(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+
+	code := b.authorize(s256(testVerifier), "S256", "")
+	server.db.Queries = expiredSessions{server.store}
+	expectStatus(t, b.exchange(code, testVerifier), http.StatusBadRequest)
+}
+
+// concurrentRedemption deletes every authorization session right after it is read, as a
+// concurrent request redeeming the same code would
+type concurrentRedemption struct {
+	db.Store
+}
+
+func (s concurrentRedemption) GetSessionByAuthCode(ctx context.Context, authCode string) (dbcommon.GetSessionByAuthCodeRow, error) {
+	session, err := s.Store.GetSessionByAuthCode(ctx, authCode)
+	if err == nil {
+		_, err = s.Store.DeleteSession(ctx, authCode)
+	}
+	return session, err
+}
+
+func TestAuthorizationCodeConcurrentRedemption(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+
+	code := b.authorize(s256(testVerifier), "S256", "")
+	server.db.Queries = concurrentRedemption{server.store}
+	resp := b.exchange(code, testVerifier)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	var body OAuthError
+	decodeJSON(t, resp, &body)
+	if body.Code != "invalid_grant" {
+		t.Errorf("got error %q, want invalid_grant", body.Code)
+	}
+}
+
+func TestAuthorizationCodeBeforeLogin(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+
+	query := authorizeQuery(s256(testVerifier), "S256", "")
+	b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+
+	// The code exists from the start of the request but is worthless until the user logged in,
+	// which includes the second factor
+	authCode, err := url.QueryUnescape(b.cookies["auth_code"].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pendingMFA := range []bool{false, true} {
+		if pendingMFA {
+			// A user from an earlier step of the request doesn't count while the second factor is pending
+			err := server.store.UpdateUserSession(context.Background(), dbcommon.UpdateUserSessionParams{
+				UserID:   sql.NullInt64{Int64: server.user.ID, Valid: true},
+				AuthCode: authCode,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = server.store.SetSessionMFAPending(context.Background(), dbcommon.SetSessionMFAPendingParams{
+				MfaUserID: sql.NullInt64{Int64: server.user.ID, Valid: true},
+				AuthCode:  authCode,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		resp := b.exchange(authCode, testVerifier)
+		expectStatus(t, resp, http.StatusBadRequest)
+		var body OAuthError
+		decodeJSON(t, resp, &body)
+		if body.Code != "invalid_grant" {
+			t.Errorf("pending MFA %v: got error %q, want invalid_grant", pendingMFA, body.Code)
+		}
+	}
+}
+
+func TestAuthorizationCodeBeforeConsent(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+
+	query := authorizeQuery(s256(testVerifier), "S256", "openid email")
+	b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+	location := b.expectRedirect(b.do(http.MethodPost, "/login", url.Values{
+		"username":     {testEmail},
+		"password":     {testPassword},
+		"namespace_id": {strconv.FormatInt(server.client.ID, 10)},
+	}))
+	location = b.expectRedirect(b.do(http.MethodGet, location.String(), nil))
+	if location.Path != "/consent" {
+		t.Fatalf("authorize redirected to %s, want /consent", location)
+	}
+
+	// The user logged in but never approved the scope
+	authCode, err := url.QueryUnescape(b.cookies["auth_code"].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := b.exchange(authCode, testVerifier)
+	expectStatus(t, resp, http.StatusBadRequest)
+	var body OAuthError
+	decodeJSON(t, resp, &body)
+	if body.Code != "invalid_grant" {
+		t.Fatalf("got error %q, want invalid_grant", body.Code)
+	}
+
+	// Once the user consents the same code is good
+	location = b.expectRedirect(b.do(http.MethodPost, "/consent", url.Values{"action": {"approve"}}))
+	location = b.expectRedirect(b.do(http.MethodGet, location.String(), nil))
+	if code := location.Query().Get("code"); code != authCode {
+		t.Fatalf("got code %q, want %q", code, authCode)
+	}
+	expectStatus(t, b.exchange(authCode, testVerifier), http.StatusOK)
+}
+
+func TestAuthorizationCodeOtherClient(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+
+	other := createTestClient(t, server.store, "other")
+
+	code := b.authorize(s256(testVerifier), "S256", "")
+	expectStatus(t, b.do(http.MethodPost, "/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {testVerifier},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {other.Namespace},
+	}), http.StatusBadRequest)
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+
+	query := authorizeQuery(s256(testVerifier), "S256", "")
+	b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+
+	expectStatus(t, b.do(http.MethodPost, "/login", url.Values{
+		"username":     {testEmail},
+		"password":     {"wrong"},
+		"namespace_id": {strconv.FormatInt(server.client.ID, 10)},
+	}), http.StatusUnauthorized)
+
+	// Without a logged in user /authorize sends the browser back to the login form
+	location := b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+	if location.Path != "/login" {
+		t.Fatalf("authorize redirected to %s, want /login", location)
+	}
+}
+
+func TestLoginDisabledUser(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+
+	if err := server.store.DisableUser(context.Background(), server.user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	query := authorizeQuery(s256(testVerifier), "S256", "")
+	b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+
+	expectStatus(t, b.do(http.MethodPost, "/login", url.Values{
+		"username":     {testEmail},
+		"password":     {testPassword},
+		"namespace_id": {strconv.FormatInt(server.client.ID, 10)},
+	}), http.StatusForbidden)
+}
+
+func TestAuthorizeAfterAbandonedRequest(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+
+	// The user leaves the login form, the auth_code cookie stays behind
+	query := authorizeQuery(s256(testVerifier), "S256", "")
+	query.Set("state", "abandoned")
+	b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+
+	code := b.authorize(s256(testVerifier), "S256", "")
+	expectStatus(t, b.exchange(code, testVerifier), http.StatusOK)
+}
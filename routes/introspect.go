@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IntrospectRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// inactiveToken is the only thing returned for tokens that are unknown, expired or revoked
+var inactiveToken = gin.H{"active": false}
+
+// Introspect reports whether a token is active and what it grants as described in RFC 7662.
+// Only confidential clients, such as resource servers, may introspect tokens.
+func Introspect(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req IntrospectRequest
+		if err := c.ShouldBind(&req); err != nil {
+			log.Printf("Error binding introspect request: %v", err)
+			abortWithError(c, invalidRequest("The token parameter is required"))
+			return
+		}
+
+		creds, err := readClientCredentials(c, req.ClientID, req.ClientSecret)
+		if err != nil {
+			log.Printf("Error reading client credentials: %v", err)
+			abortInvalidClient(c, creds)
+			return
+		}
+
+		ctx := context.Background()
+		client, err := authenticateClient(ctx, db, creds)
+		if err != nil || !isConfidentialClient(client) {
+			log.Printf("Error authenticating client %s for introspection: %v", creds.ID, err)
+			abortInvalidClient(c, creds)
+			return
+		}
+
+		// Try the hinted token type first, the hint is only an optimisation
+		var response gin.H
+		if req.TokenTypeHint == "refresh_token" {
+			response, err = introspectRefreshToken(ctx, db, req.Token)
+			if response == nil && err == nil {
+				response = introspectAccessToken(ctx, db, req.Token)
+			}
+		} else {
+			response = introspectAccessToken(ctx, db, req.Token)
+			if response == nil {
+				response, err = introspectRefreshToken(ctx, db, req.Token)
+			}
+		}
+		if err != nil {
+			log.Printf("Error introspecting token: %v", err)
+			abortWithError(c, serverError("Failed to introspect token"))
+			return
+		}
+		if response == nil {
+			response = inactiveToken
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// introspectAccessToken describes a valid, unrevoked access token of a user who is not disabled, or returns nil
+func introspectAccessToken(ctx context.Context, db *db.Db, token string) gin.H {
+	_, claims, err := validAccessToken(ctx, db, token)
+	if err != nil {
+		return nil
+	}
+
+	response := gin.H{
+		"active":     true,
+		"sub":        claims.Subject,
+		"client_id":  claims.ClientID,
+		"token_type": "Bearer",
+	}
+	if claims.Scope != "" {
+		response["scope"] = claims.Scope
+	}
+	if claims.ExpiresAt != nil {
+		response["exp"] = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response["iat"] = claims.IssuedAt.Unix()
+	}
+	if len(claims.Audience) > 0 {
+		response["aud"] = claims.Audience
+	}
+
+	return response
+}
+
+// introspectRefreshToken describes a refresh token, or returns nil when it is unknown
+func introspectRefreshToken(ctx context.Context, db *db.Db, token string) (gin.H, error) {
+	refreshToken, err := db.Queries.GetRefreshTokenByHash(ctx, utils.HashOpaqueToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if refreshToken.RevokedAt.Valid || refreshToken.UsedAt.Valid || time.Now().After(refreshToken.ExpiresAt) {
+		return inactiveToken, nil
+	}
+
+	user, err := db.Queries.GetUserByID(ctx, refreshToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt.Valid {
+		return inactiveToken, nil
+	}
+	client, err := db.Queries.GetClientByID(ctx, refreshToken.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := gin.H{
+		"active":    true,
+		"sub":       user.Uuid,
+		"client_id": client.Namespace,
+		"aud":       client.Namespace,
+		"exp":       refreshToken.ExpiresAt.Unix(),
+	}
+	if refreshToken.Scope != "" {
+		response["scope"] = refreshToken.Scope
+	}
+	if refreshToken.CreatedAt.Valid {
+		response["iat"] = refreshToken.CreatedAt.Time.Unix()
+	}
+
+	return response, nil
+}
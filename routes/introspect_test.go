@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// createResourceServer registers a confidential client that may introspect tokens
+func createResourceServer(t *testing.T, server *testServer, namespace, secret string) {
+	t.Helper()
+
+	hash, err := utils.GenerateFromPassword(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.store.CreateClient(context.Background(), dbcommon.CreateClientParams{
+		Namespace:    namespace,
+		Name:         "Resource Server",
+		ClientSecret: sql.NullString{String: hash, Valid: true},
+		UserPool:     UserPoolGlobal,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIDTokenIsNotAnAccessToken(t *testing.T) {
+	server := newTestServer(t)
+	createResourceServer(t, server, "api", "api-secret")
+	b := server.browser(t)
+	tokens := b.login()
+
+	introspect := func(token string) bool {
+		t.Helper()
+
+		resp := b.do(http.MethodPost, "/introspect", url.Values{
+			"token":         {token},
+			"client_id":     {"api"},
+			"client_secret": {"api-secret"},
+		})
+		expectStatus(t, resp, http.StatusOK)
+		var body struct {
+			Active bool `json:"active"`
+		}
+		decodeJSON(t, resp, &body)
+		return body.Active
+	}
+
+	validate := func(token string) int {
+		t.Helper()
+
+		b.cookies["token"] = &http.Cookie{Name: "token", Value: token}
+		return b.do(http.MethodGet, "/validate", nil).StatusCode
+	}
+
+	// The access token of the same login passes everywhere, so only the token type makes the difference
+	if _, err := utils.ValidateJWT(tokens.AccessToken); err != nil {
+		t.Fatalf("access token rejected: %v", err)
+	}
+	if !introspect(tokens.AccessToken) {
+		t.Error("access token introspected as inactive")
+	}
+	if status := validate(tokens.AccessToken); status != http.StatusOK {
+		t.Errorf("validate returned %d for the access token, want 200", status)
+	}
+
+	if _, err := utils.ValidateJWT(tokens.IDToken); err == nil {
+		t.Error("ValidateJWT accepted an ID token")
+	}
+	if introspect(tokens.IDToken) {
+		t.Error("ID token introspected as an active access token")
+	}
+	if status := validate(tokens.IDToken); status != http.StatusUnauthorized {
+		t.Errorf("validate returned %d for an ID token, want 401", status)
+	}
+}
+
+func TestDisabledUserTokensStopWorking(t *testing.T) {
+	server := newTestServer(t)
+	createResourceServer(t, server, "api", "api-secret")
+	b := server.browser(t)
+	tokens := b.login()
+
+	introspect := func(token string) bool {
+		t.Helper()
+
+		resp := b.do(http.MethodPost, "/introspect", url.Values{
+			"token":         {token},
+			"client_id":     {"api"},
+			"client_secret": {"api-secret"},
+		})
+		expectStatus(t, resp, http.StatusOK)
+		var body struct {
+			Active bool `json:"active"`
+		}
+		decodeJSON(t, resp, &body)
+		return body.Active
+	}
+
+	b.cookies["token"] = &http.Cookie{Name: "token", Value: tokens.AccessToken}
+	expectStatus(t, b.do(http.MethodGet, "/validate", nil), http.StatusOK)
+	expectStatus(t, b.do(http.MethodGet, "/userinfo", nil), http.StatusOK)
+	if !introspect(tokens.AccessToken) || !introspect(tokens.RefreshToken) {
+		t.Fatal("tokens introspected as inactive before disabling the user")
+	}
+
+	// Disabling alone, the tokens themselves are neither revoked nor expired
+	if err := server.store.DisableUser(context.Background(), server.user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStatus(t, b.do(http.MethodGet, "/validate", nil), http.StatusUnauthorized)
+	expectStatus(t, b.do(http.MethodGet, "/userinfo", nil), http.StatusUnauthorized)
+	if introspect(tokens.AccessToken) {
+		t.Error("access token of a disabled user introspected as active")
+	}
+	if introspect(tokens.RefreshToken) {
+		t.Error("refresh token of a disabled user introspected as active")
+	}
+}
@@ -0,0 +1,168 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/lockout"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startLogin sends the browser to /authorize so it has an authorization request to log in to
+func (b *browser) startLogin() {
+	b.t.Helper()
+
+	query := authorizeQuery(s256(testVerifier), "S256", "")
+	b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+}
+
+// loginWith posts the login form with the given password
+func (b *browser) loginWith(password string) *http.Response {
+	b.t.Helper()
+
+	return b.do(http.MethodPost, "/login", url.Values{
+		"username":     {testEmail},
+		"password":     {password},
+		"namespace_id": {strconv.FormatInt(b.server.client.ID, 10)},
+	})
+}
+
+// concurrentFailures counts another failed login for every one recorded, as a concurrent
+// request failing between reading the user and recording its own failure would
+type concurrentFailures struct {
+	db.Store
+}
+
+func (s concurrentFailures) RecordFailedLogin(ctx context.Context, arg dbcommon.RecordFailedLoginParams) error {
+	if err := s.Store.RecordFailedLogin(ctx, arg); err != nil {
+		return err
+	}
+	return s.Store.RecordFailedLogin(ctx, arg)
+}
+
+func TestLockoutCountsConcurrentFailures(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	b.startLogin()
+
+	// Three failures of a threshold of five, the fourth one lands together with a concurrent fifth
+	for range 3 {
+		expectStatus(t, b.loginWith("wrong"), http.StatusUnauthorized)
+	}
+	server.db.Queries = concurrentFailures{server.store}
+	expectStatus(t, b.loginWith("wrong"), http.StatusUnauthorized)
+	server.db.Queries = server.store
+
+	user, err := server.store.GetUserByID(context.Background(), server.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.LockedUntil.Valid {
+		t.Fatal("the account was not locked after the fifth failure")
+	}
+	expectStatus(t, b.loginWith(testPassword), http.StatusUnauthorized)
+}
+
+func TestLockoutLooksLikeUnknownEmail(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	b.startLogin()
+	for range 5 {
+		expectStatus(t, b.loginWith("wrong"), http.StatusUnauthorized)
+	}
+
+	// The locked account with its right password against an email nobody has
+	locked := b.loginWith(testPassword)
+	unknown := b.do(http.MethodPost, "/login", url.Values{
+		"username":     {"nobody@example.com"},
+		"password":     {testPassword},
+		"namespace_id": {strconv.FormatInt(server.client.ID, 10)},
+	})
+	lockedBody, _ := io.ReadAll(locked.Body)
+	unknownBody, _ := io.ReadAll(unknown.Body)
+	if locked.StatusCode != unknown.StatusCode || !bytes.Equal(lockedBody, unknownBody) {
+		t.Errorf("locked account got %d %s, unknown email %d %s", locked.StatusCode, lockedBody, unknown.StatusCode, unknownBody)
+	}
+	for _, header := range []string{"Retry-After", "Location"} {
+		if locked.Header.Get(header) != unknown.Header.Get(header) {
+			t.Errorf("locked account got %s %q, unknown email %q", header, locked.Header.Get(header), unknown.Header.Get(header))
+		}
+	}
+}
+
+// lockoutRecorder collects the lockouts the guard notifies about
+type lockoutRecorder struct {
+	events chan lockout.Event
+}
+
+func (r lockoutRecorder) AccountLocked(ctx context.Context, event lockout.Event) error {
+	r.events <- event
+	return nil
+}
+
+// recountBarrier holds every read of the failure count until all the expected requests have read it,
+// so they all decide on the lockout before any of them locks the account and resets the count
+type recountBarrier struct {
+	db.Store
+	read *sync.WaitGroup
+}
+
+func (s recountBarrier) GetUserByID(ctx context.Context, id int64) (dbcommon.User, error) {
+	user, err := s.Store.GetUserByID(ctx, id)
+	s.read.Done()
+	s.read.Wait()
+	return user, err
+}
+
+func TestLockoutNotifiesOnce(t *testing.T) {
+	server := newTestServer(t)
+	recorder := lockoutRecorder{events: make(chan lockout.Event, 10)}
+	server.guard.Notifier = recorder
+
+	// More concurrent failures than the threshold of five, each from its own browser,
+	// every one of them sees enough failures to lock the account
+	browsers := make([]*browser, 7)
+	for i := range browsers {
+		browsers[i] = server.browser(t)
+		browsers[i].startLogin()
+	}
+	var read sync.WaitGroup
+	read.Add(len(browsers))
+	server.db.Queries = recountBarrier{Store: server.store, read: &read}
+
+	var wg sync.WaitGroup
+	for _, b := range browsers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := b.loginWith("wrong"); resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("failed login returned %d, want 401", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case event := <-recorder.events:
+		if event.UserUUID != server.user.Uuid || event.Email != testEmail {
+			t.Errorf("got lockout event %+v for another user", event)
+		}
+		if !event.LockedUntil.After(time.Now()) {
+			t.Errorf("lockout event has locked until %v in the past", event.LockedUntil)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notifier was not told about the lockout")
+	}
+	select {
+	case event := <-recorder.events:
+		t.Errorf("the notifier was told about the lockout again: %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -3,10 +3,10 @@ package routes
 import (
 	"auth_go/db"
 	"auth_go/dbcommon"
+	"auth_go/lockout"
 	"auth_go/utils"
 	"context"
 	"database/sql"
-	"fmt"
 	"log"
 	"net/http"
 
@@ -19,7 +19,7 @@ type LoginInput struct {
 	NamespaceID int64  `form:"namespace_id" binding:"required"`
 }
 
-func Login(db *db.Db) gin.HandlerFunc {
+func Login(db *db.Db, guard *lockout.Guard) gin.HandlerFunc {
 	return func(g *gin.Context) {
 		var input LoginInput
 		if err := g.ShouldBind(&input); err != nil {
@@ -28,63 +28,102 @@ func Login(db *db.Db) gin.HandlerFunc {
 			return
 		}
 
-		// Get user from database
-		user, err := db.Queries.GetUserByEmail(context.Background(), input.Username)
+		ctx := context.Background()
+
+		// Get auth code from cookie
+		authCode, err := g.Cookie("auth_code")
+		if err != nil {
+			log.Printf("Error getting auth code from cookie: %v", err)
+			g.IndentedJSON(http.StatusBadRequest, gin.H{"error": "No authorization code found"})
+			return
+		}
+
+		// Get authorization request from database using auth code from cookie
+		authSession, err := db.Queries.GetSessionByAuthCode(ctx, authCode)
+		if err != nil {
+			log.Printf("Error getting session by auth code: %v", err)
+			g.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization code"})
+			return
+		}
+
+		// Get client information to get namespace and user pool
+		client, err := db.Queries.GetClientByID(ctx, authSession.ClientID)
+		if err != nil {
+			log.Printf("Error getting client by ID: %v", err)
+			g.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid client"})
+			return
+		}
+
+		// Get user from the client's user pool
+		user, err := db.Queries.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{
+			NamespaceID: userPoolID(client),
+			Email:       input.Username,
+		})
 		if err != nil {
 			log.Printf("Error getting user by email: %v", err)
 			g.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
 
+		// Locked accounts and accounts in backoff don't get to try the password at all. They get the
+		// answer an unknown email gets, anything else would tell who has an account.
+		if wait := loginWait(guard, user); wait > 0 {
+			log.Printf("Login attempt for user %s rejected, next attempt allowed in %v", user.Uuid, wait)
+			g.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
+
 		if match, _ := utils.ComparePasswordAndHash(input.Password, user.Password); match {
-			// Get auth code from cookie
-			authCode, err := g.Cookie("auth_code")
-			if err != nil {
-				log.Printf("Error getting auth code from cookie: %v", err)
-				g.IndentedJSON(http.StatusBadRequest, gin.H{"error": "No authorization code found"})
+			// Disabled accounts can't log in, whatever credentials they present
+			if user.DisabledAt.Valid {
+				log.Printf("Login refused for disabled user: %s", user.Uuid)
+				g.IndentedJSON(http.StatusForbidden, gin.H{"error": "This account has been disabled"})
 				return
 			}
 
-			// Update session with user ID
-			err = db.Queries.UpdateUserSession(context.Background(), dbcommon.UpdateUserSessionParams{
-				UserID:   sql.NullInt64{Int64: user.ID, Valid: true},
-				AuthCode: authCode,
-			})
-			if err != nil {
-				log.Printf("Error updating user session: %v", err)
-				g.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+			// Some clients only accept users who have verified their email
+			if client.RequireEmailVerification && !user.EmailVerified {
+				log.Printf("Login blocked until email is verified for user: %s", user.Uuid)
+				g.IndentedJSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before logging in"})
 				return
 			}
 
-			// Get authorization request from database using auth code from cookie
-			authSession, err := db.Queries.GetSessionByAuthCode(context.Background(), authCode)
+			// Users with an authenticator or security key still have to pass the second factor
+			totp, securityKey, err := secondFactors(ctx, db, user.ID)
 			if err != nil {
-				log.Printf("Error getting session by auth code: %v", err)
-				g.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization code"})
+				log.Printf("Error checking MFA enrollment for user %s: %v", user.Uuid, err)
+				g.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+				return
+			}
+			if totp || securityKey {
+				err = db.Queries.SetSessionMFAPending(ctx, dbcommon.SetSessionMFAPendingParams{
+					MfaUserID: sql.NullInt64{Int64: user.ID, Valid: true},
+					AuthCode:  authCode,
+				})
+				if err != nil {
+					log.Printf("Error updating user session: %v", err)
+					g.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+					return
+				}
+				g.Redirect(http.StatusFound, "/login/mfa")
 				return
 			}
 
-			// Get client information to get namespace
-			client, err := db.Queries.GetClientByID(context.Background(), authSession.ClientID)
-			if err != nil {
-				log.Printf("Error getting client by ID: %v", err)
-				g.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid client"})
+			// Update session with user ID
+			if err := completeLogin(ctx, g, db, authCode, user.ID, amrPassword); err != nil {
+				log.Printf("Error updating user session: %v", err)
+				g.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
 				return
 			}
+			clearLoginFailures(ctx, db, user)
 
 			// Redirect back to authorize endpoint with all OAuth parameters
-			redirectURL := fmt.Sprintf("/authorize?response_type=code&namespace=%s&redirect_uri=%s&code_challenge=%s&code_challenge_method=%s&state=%s",
-				client.Namespace,
-				authSession.RedirectUri,
-				authSession.PkceChallenge,
-				authSession.PkceChallengeMethod,
-				authSession.State,
-			)
-			g.Redirect(http.StatusFound, redirectURL)
+			g.Redirect(http.StatusFound, authorizeURL(client.Namespace, authSession))
 			return
 		}
 
 		log.Printf("Invalid password for user: %s", input.Username)
+		recordLoginFailure(ctx, db, guard, user, g.ClientIP())
 		g.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 	}
 }
@@ -119,6 +158,8 @@ func LoginPage(db *db.Db) gin.HandlerFunc {
 		c.HTML(http.StatusOK, "login.html", gin.H{
 			"NamespaceName": client.Name,
 			"NamespaceID":   client.ID,
+			"Namespace":     client.Namespace,
+			"LoginHint":     authSession.LoginHint,
 		})
 	}
 }
@@ -0,0 +1,253 @@
+package routes
+
+import (
+	"auth_go/backchannel"
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EndSessionParams are the parameters of OpenID Connect RP-Initiated Logout 1.0, section 2
+type EndSessionParams struct {
+	IDTokenHint           string `form:"id_token_hint"`
+	PostLogoutRedirectURI string `form:"post_logout_redirect_uri"`
+	State                 string `form:"state"`
+	ClientID              string `form:"client_id"`
+	// Confirm is sent by the confirmation page, it is only honoured on POST
+	Confirm string `form:"confirm"`
+}
+
+// EndSession logs the browser out of its SSO session, asking the user first unless the client
+// proved with id_token_hint that it is logging out the same user. With revokeTokens the refresh
+// tokens issued from the SSO session and the access token in the token cookie are revoked too.
+// The clients that received tokens in the session are notified through their logout URIs.
+func EndSession(db *db.Db, revokeTokens bool, notifier *backchannel.Notifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params EndSessionParams
+		if err := c.ShouldBind(&params); err != nil {
+			log.Printf("Error binding logout params: %v", err)
+			renderError(c, http.StatusBadRequest, "Invalid logout request")
+			return
+		}
+
+		ctx := context.Background()
+
+		var hint *utils.Claims
+		if params.IDTokenHint != "" {
+			claims, err := utils.ParseIDTokenHint(params.IDTokenHint)
+			if err != nil {
+				log.Printf("Error parsing id_token_hint: %v", err)
+				renderError(c, http.StatusBadRequest, "Invalid id_token_hint")
+				return
+			}
+			hint = claims
+		}
+
+		// The client comes from client_id or the audience of the hint, which must agree
+		clientID := params.ClientID
+		if hint != nil {
+			if clientID == "" {
+				clientID = hint.Audience[0]
+			} else if !slices.Contains(hint.Audience, clientID) {
+				renderError(c, http.StatusBadRequest, "id_token_hint was not issued to the client")
+				return
+			}
+		}
+
+		if params.PostLogoutRedirectURI != "" {
+			if clientID == "" {
+				renderError(c, http.StatusBadRequest, "post_logout_redirect_uri requires client_id or id_token_hint")
+				return
+			}
+			client, err := db.Queries.GetClientByNamespace(ctx, clientID)
+			if err != nil {
+				log.Printf("Error getting client by namespace: %v", err)
+				renderError(c, http.StatusBadRequest, "Invalid client")
+				return
+			}
+			registered, err := isRegisteredRedirectURI(ctx, db, client.ID, params.PostLogoutRedirectURI)
+			if err != nil {
+				log.Printf("Error getting client redirect URIs: %v", err)
+				renderError(c, http.StatusInternalServerError, "Failed to validate post_logout_redirect_uri")
+				return
+			}
+			if !registered {
+				renderError(c, http.StatusBadRequest, "post_logout_redirect_uri is not registered for the client")
+				return
+			}
+		}
+
+		session, loggedIn := currentSSOSession(ctx, c, db)
+
+		// A request without a matching hint could come from anywhere, so the user has to confirm it
+		confirmed := c.Request.Method == http.MethodPost && params.Confirm == "yes"
+		if loggedIn && !confirmed && !hintMatchesSession(ctx, db, hint, session) {
+			c.HTML(http.StatusOK, "logout.html", gin.H{
+				"PostLogoutRedirectURI": params.PostLogoutRedirectURI,
+				"State":                 params.State,
+				"ClientID":              clientID,
+			})
+			return
+		}
+
+		var frontchannelURIs []string
+		if loggedIn {
+			// The clients have to be listed before the session and its clients are deleted
+			frontchannelURIs = notifyLogout(ctx, db, notifier, session)
+			endSSOSession(ctx, c, db, session, revokeTokens)
+		}
+		if authCode, err := c.Cookie("auth_code"); err == nil {
+			endAuthorizeSession(ctx, c, db, authCode)
+		}
+		setCookie(c, ssoCookie, "", -1)
+		setCookie(c, "token", "", -1)
+
+		var redirectURL string
+		if params.PostLogoutRedirectURI != "" {
+			query := url.Values{}
+			if params.State != "" {
+				query.Set("state", params.State)
+			}
+			var err error
+			redirectURL, err = buildRedirectURL(params.PostLogoutRedirectURI, query)
+			if err != nil {
+				renderError(c, http.StatusBadRequest, "Invalid post_logout_redirect_uri")
+				return
+			}
+		}
+
+		// The front-channel logout URIs have to load in the browser before it leaves the page
+		if redirectURL == "" || len(frontchannelURIs) > 0 {
+			c.HTML(http.StatusOK, "logout.html", gin.H{
+				"LoggedOut":        true,
+				"FrontchannelURIs": frontchannelURIs,
+				"RedirectURL":      redirectURL,
+			})
+			return
+		}
+		c.Redirect(http.StatusFound, redirectURL)
+	}
+}
+
+// notifyLogout tells the clients that received tokens in the SSO session that it ended. Logout
+// tokens are posted to their back-channel logout URIs in the background, the front-channel
+// logout URIs are returned for the logout page to load in iframes.
+func notifyLogout(ctx context.Context, db *db.Db, notifier *backchannel.Notifier, session dbcommon.SsoSession) []string {
+	clients, err := db.Queries.ListSSOSessionClients(ctx, session.ID)
+	if err != nil {
+		log.Printf("Error listing clients of SSO session %d: %v", session.ID, err)
+		return nil
+	}
+
+	// Logout tokens identify the user as well as the session, clients may only track one of them
+	var subject string
+	if user, err := db.Queries.GetUserByID(ctx, session.UserID); err != nil {
+		log.Printf("Error getting user %d of SSO session: %v", session.UserID, err)
+	} else {
+		subject = user.Uuid
+	}
+
+	var frontchannelURIs []string
+	for _, client := range clients {
+		if client.BackchannelLogoutUri != "" {
+			logoutToken, err := utils.GenerateLogoutToken(utils.LogoutTokenParams{
+				Subject:   subject,
+				Audience:  client.Namespace,
+				SessionID: session.Sid,
+			})
+			if err != nil {
+				log.Printf("Error generating logout token for client %s: %v", client.Namespace, err)
+			} else {
+				go func() {
+					if err := notifier.Deliver(context.Background(), client.BackchannelLogoutUri, logoutToken); err != nil {
+						log.Printf("Error delivering logout token to client %s: %v", client.Namespace, err)
+					}
+				}()
+			}
+		}
+
+		if client.FrontchannelLogoutUri != "" {
+			query := url.Values{"iss": {utils.Issuer()}}
+			if session.Sid != "" {
+				query.Set("sid", session.Sid)
+			}
+			uri, err := buildRedirectURL(client.FrontchannelLogoutUri, query)
+			if err != nil {
+				log.Printf("Error building front-channel logout URI of client %s: %v", client.Namespace, err)
+				continue
+			}
+			frontchannelURIs = append(frontchannelURIs, uri)
+		}
+	}
+	return frontchannelURIs
+}
+
+// hintMatchesSession reports whether the ID token hint was issued to the user of the SSO session
+func hintMatchesSession(ctx context.Context, db *db.Db, hint *utils.Claims, session dbcommon.SsoSession) bool {
+	if hint == nil {
+		return false
+	}
+	user, err := db.Queries.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		log.Printf("Error getting user %d of SSO session: %v", session.UserID, err)
+		return false
+	}
+	return user.Uuid == hint.Subject
+}
+
+// endSSOSession deletes the SSO session, optionally revoking the tokens issued from it. Failures
+// are only logged, the cookies are cleared regardless so the browser is logged out.
+func endSSOSession(ctx context.Context, c *gin.Context, db *db.Db, session dbcommon.SsoSession, revokeTokens bool) {
+	if err := db.Queries.DeleteSSOSession(ctx, session.TokenHash); err != nil {
+		log.Printf("Error deleting SSO session %d: %v", session.ID, err)
+	}
+	if !revokeTokens {
+		return
+	}
+
+	ssoSessionID := sql.NullInt64{Int64: session.ID, Valid: true}
+	err := db.Queries.RevokeSSOSessionRefreshTokens(ctx, ssoSessionID)
+	if err != nil {
+		log.Printf("Error revoking refresh tokens of SSO session %d: %v", session.ID, err)
+	}
+
+	// The access tokens issued to every client of the session
+	tokens, err := db.Queries.ListSSOSessionAccessTokens(ctx, dbcommon.ListSSOSessionAccessTokensParams{
+		SsoSessionID: ssoSessionID,
+		ExpiresAt:    time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error listing access tokens of SSO session %d: %v", session.ID, err)
+	}
+	for _, token := range tokens {
+		if err := revokeJTI(ctx, db, token.Jti, token.ExpiresAt); err != nil {
+			log.Printf("Error revoking access token %s: %v", token.Jti, err)
+		}
+	}
+
+	// And the one in the cookie, which may have been issued before the session's tokens were recorded
+	token, err := c.Cookie("token")
+	if err != nil {
+		return
+	}
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		if !errors.Is(err, utils.ErrTokenRevoked) {
+			log.Printf("Error validating access token cookie: %v", err)
+		}
+		return
+	}
+	if err := revokeJTI(ctx, db, claims.ID, claims.ExpiresAt.Time); err != nil {
+		log.Printf("Error revoking access token %s: %v", claims.ID, err)
+	}
+}
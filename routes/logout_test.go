@@ -0,0 +1,373 @@
+package routes
+
+import (
+	"auth_go/backchannel"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type loginTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+}
+
+// login runs the flow with the openid scope and returns the tokens the client got
+func (b *browser) login() loginTokens {
+	b.t.Helper()
+
+	resp := b.exchange(b.authorize(s256(testVerifier), "S256", "openid"), testVerifier)
+	expectStatus(b.t, resp, http.StatusOK)
+	var tokens loginTokens
+	decodeJSON(b.t, resp, &tokens)
+	return tokens
+}
+
+// refresh exchanges a refresh token, returning the response
+func (b *browser) refresh(refreshToken string) *http.Response {
+	b.t.Helper()
+
+	return b.do(http.MethodPost, "/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {testNamespace},
+	})
+}
+
+// expectLoggedOut checks the browser has to log in again at /authorize
+func (b *browser) expectLoggedOut() {
+	b.t.Helper()
+
+	if _, ok := b.cookies[ssoCookie]; ok {
+		b.t.Error("the SSO session cookie was not cleared")
+	}
+	query := authorizeQuery(s256(testVerifier), "S256", "")
+	if location := b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil)); location.Path != "/login" {
+		b.t.Errorf("authorize redirected to %s after logout, want /login", location)
+	}
+}
+
+func TestLogoutWithIDTokenHint(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	tokens := b.login()
+
+	query := url.Values{
+		"id_token_hint":            {tokens.IDToken},
+		"post_logout_redirect_uri": {testRedirectURI},
+		"state":                    {"abc"},
+	}
+	location := b.expectRedirect(b.do(http.MethodGet, "/logout?"+query.Encode(), nil))
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURI {
+		t.Fatalf("logout redirected to %s, want %s", location, testRedirectURI)
+	}
+	if state := location.Query().Get("state"); state != "abc" {
+		t.Errorf("got state %q, want abc", state)
+	}
+	if _, ok := b.cookies["token"]; ok {
+		t.Error("the token cookie was not cleared")
+	}
+	b.expectLoggedOut()
+
+	// Tokens are only revoked when configured
+	expectStatus(t, b.refresh(tokens.RefreshToken), http.StatusOK)
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	server := newTestServer(t)
+	server.router.GET("/logout/revoking", EndSession(server.db, true, backchannel.NewNotifier(1, time.Second)))
+	b := server.browser(t)
+	tokens := b.login()
+
+	query := url.Values{"id_token_hint": {tokens.IDToken}}
+	expectStatus(t, b.do(http.MethodGet, "/logout/revoking?"+query.Encode(), nil), http.StatusOK)
+	b.expectLoggedOut()
+
+	resp := b.refresh(tokens.RefreshToken)
+	expectStatus(t, resp, http.StatusBadRequest)
+	var body OAuthError
+	decodeJSON(t, resp, &body)
+	if body.Code != "invalid_grant" {
+		t.Errorf("got error %q, want invalid_grant", body.Code)
+	}
+	if _, err := utils.ValidateJWT(tokens.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token validated with %v, want it revoked", err)
+	}
+}
+
+func TestLogoutRevokesTokensOfEveryClient(t *testing.T) {
+	server := newTestServer(t)
+	server.router.GET("/logout/revoking", EndSession(server.db, true, backchannel.NewNotifier(1, time.Second)))
+	b := server.browser(t)
+	addOtherClient(t, server, UserPoolGlobal)
+
+	// Both clients get tokens in the same SSO session
+	tokens := b.login()
+	location := b.expectRedirect(b.do(http.MethodGet, "/authorize?"+otherClientQuery().Encode(), nil))
+	resp := b.do(http.MethodPost, "/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"code_verifier": {testVerifier},
+		"redirect_uri":  {otherRedirectURI},
+		"client_id":     {"other"},
+	})
+	expectStatus(t, resp, http.StatusOK)
+	var other loginTokens
+	decodeJSON(t, resp, &other)
+
+	// Refreshing puts a new token of the first client in the cookie, neither token above is in it
+	expectStatus(t, b.refresh(tokens.RefreshToken), http.StatusOK)
+
+	query := url.Values{"id_token_hint": {tokens.IDToken}}
+	expectStatus(t, b.do(http.MethodGet, "/logout/revoking?"+query.Encode(), nil), http.StatusOK)
+
+	for name, token := range map[string]string{"first client": tokens.AccessToken, "second client": other.AccessToken} {
+		if _, err := utils.ValidateJWT(token); !errors.Is(err, utils.ErrTokenRevoked) {
+			t.Errorf("%s: access token validated with %v, want it revoked", name, err)
+		}
+	}
+}
+
+func TestLogoutInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		query func(tokens loginTokens) url.Values
+	}{
+		{
+			name: "unregistered post_logout_redirect_uri",
+			query: func(tokens loginTokens) url.Values {
+				return url.Values{"id_token_hint": {tokens.IDToken}, "post_logout_redirect_uri": {"https://evil.example/"}}
+			},
+		},
+		{
+			name: "post_logout_redirect_uri without client",
+			query: func(tokens loginTokens) url.Values {
+				return url.Values{"post_logout_redirect_uri": {testRedirectURI}}
+			},
+		},
+		{
+			name: "hint of another client",
+			query: func(tokens loginTokens) url.Values {
+				return url.Values{"id_token_hint": {tokens.IDToken}, "client_id": {"other"}}
+			},
+		},
+		{
+			name: "access token as hint",
+			query: func(tokens loginTokens) url.Values {
+				return url.Values{"id_token_hint": {tokens.AccessToken}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			b := server.browser(t)
+			tokens := b.login()
+
+			expectStatus(t, b.do(http.MethodGet, "/logout?"+tt.query(tokens).Encode(), nil), http.StatusBadRequest)
+			if _, ok := b.cookies[ssoCookie]; !ok {
+				t.Error("a rejected logout cleared the SSO session cookie")
+			}
+		})
+	}
+}
+
+func TestLogoutConfirmation(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	b.login()
+
+	// Without a hint the user is asked, following a link must not be enough
+	query := url.Values{"client_id": {testNamespace}, "post_logout_redirect_uri": {testRedirectURI}, "confirm": {"yes"}}
+	resp := b.do(http.MethodGet, "/logout?"+query.Encode(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	page, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(page), `name="confirm"`) {
+		t.Fatalf("logout without a hint didn't ask for confirmation: %s", page)
+	}
+	if _, ok := b.cookies[ssoCookie]; !ok {
+		t.Fatal("logout without confirmation cleared the SSO session cookie")
+	}
+
+	location := b.expectRedirect(b.do(http.MethodPost, "/logout", query))
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURI {
+		t.Fatalf("logout redirected to %s, want %s", location, testRedirectURI)
+	}
+	b.expectLoggedOut()
+}
+
+// setLogoutURIs registers the back-channel and front-channel logout URIs of a client
+func setLogoutURIs(t *testing.T, server *testServer, client dbcommon.Client, backchannelURI, frontchannelURI string) {
+	t.Helper()
+
+	err := server.store.UpdateClient(context.Background(), dbcommon.UpdateClientParams{
+		Name:                     client.Name,
+		ClientSecret:             client.ClientSecret,
+		AllowedScopes:            client.AllowedScopes,
+		UserPool:                 client.UserPool,
+		RequireEmailVerification: client.RequireEmailVerification,
+		BackchannelLogoutUri:     backchannelURI,
+		FrontchannelLogoutUri:    frontchannelURI,
+		ID:                       client.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// unverifiedClaims decodes the claims and header of a token the test received
+func unverifiedClaims(t *testing.T, token string) (jwt.MapClaims, map[string]any) {
+	t.Helper()
+
+	claims := jwt.MapClaims{}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims, parsed.Header
+}
+
+// logoutReceiver is a client's back-channel logout URI, failing the first delivery to exercise retries
+type logoutReceiver struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	tokens   chan string
+}
+
+func (r *logoutReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.attempts[req.URL.Path]++
+	attempt := r.attempts[req.URL.Path]
+	r.mu.Unlock()
+
+	if attempt == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+		http.Error(w, "unexpected content type "+ct, http.StatusBadRequest)
+		return
+	}
+	r.tokens <- req.URL.Path + " " + req.PostFormValue("logout_token")
+}
+
+func TestBackchannelLogout(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	other := addOtherClient(t, server, UserPoolGlobal)
+	idle := createTestClient(t, server.store, "idle")
+
+	receiver := &logoutReceiver{attempts: map[string]int{}, tokens: make(chan string, 4)}
+	rp := httptest.NewServer(receiver)
+	defer rp.Close()
+	setLogoutURIs(t, server, server.client, rp.URL+"/app", "")
+	setLogoutURIs(t, server, other, rp.URL+"/other", "")
+	setLogoutURIs(t, server, idle, rp.URL+"/idle", "")
+
+	// Both clients get tokens in the same SSO session
+	tokens := b.login()
+	location := b.expectRedirect(b.do(http.MethodGet, "/authorize?"+otherClientQuery().Encode(), nil))
+	expectStatus(t, b.do(http.MethodPost, "/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"code_verifier": {testVerifier},
+		"redirect_uri":  {otherRedirectURI},
+		"client_id":     {"other"},
+	}), http.StatusOK)
+
+	idClaims, _ := unverifiedClaims(t, tokens.IDToken)
+	sid, _ := idClaims["sid"].(string)
+	if sid == "" {
+		t.Fatal("the ID token has no sid claim")
+	}
+
+	query := url.Values{"id_token_hint": {tokens.IDToken}, "post_logout_redirect_uri": {testRedirectURI}}
+	b.expectRedirect(b.do(http.MethodGet, "/logout?"+query.Encode(), nil))
+
+	received := map[string]string{}
+	for len(received) < 2 {
+		select {
+		case delivery := <-receiver.tokens:
+			path, token, _ := strings.Cut(delivery, " ")
+			received[path] = token
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got logout tokens for %v, want /app and /other", received)
+		}
+	}
+
+	for path, audience := range map[string]string{"/app": testNamespace, "/other": "other"} {
+		claims, header := unverifiedClaims(t, received[path])
+		if header["typ"] != "logout+jwt" {
+			t.Errorf("%s: got typ %v, want logout+jwt", path, header["typ"])
+		}
+		if aud, _ := claims.GetAudience(); len(aud) != 1 || aud[0] != audience {
+			t.Errorf("%s: got aud %v, want %s", path, aud, audience)
+		}
+		if claims["iss"] != utils.Issuer() || claims["sub"] != server.user.Uuid || claims["sid"] != sid {
+			t.Errorf("%s: got iss %v, sub %v and sid %v, want %s, %s and %s",
+				path, claims["iss"], claims["sub"], claims["sid"], utils.Issuer(), server.user.Uuid, sid)
+		}
+		events, _ := claims["events"].(map[string]any)
+		if _, ok := events["http://schemas.openid.net/event/backchannel-logout"]; !ok {
+			t.Errorf("%s: got events %v, want the back-channel logout event", path, claims["events"])
+		}
+		if _, ok := claims["nonce"]; ok {
+			t.Errorf("%s: logout tokens must not have a nonce", path)
+		}
+
+		// A logout token is no substitute for any other token
+		if _, err := utils.ParseIDTokenHint(received[path]); err == nil {
+			t.Errorf("%s: the logout token was accepted as an id_token_hint", path)
+		}
+		if _, err := utils.ValidateJWT(received[path]); err == nil {
+			t.Errorf("%s: the logout token was accepted as an access token", path)
+		}
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if receiver.attempts["/app"] != 2 {
+		t.Errorf("got %d deliveries to /app, want a retry after the first failed", receiver.attempts["/app"])
+	}
+	if receiver.attempts["/idle"] != 0 {
+		t.Error("a client that got no tokens in the session was notified")
+	}
+}
+
+func TestFrontchannelLogout(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	setLogoutURIs(t, server, server.client, "", "https://app.example/frontchannel-logout")
+	tokens := b.login()
+
+	idClaims, _ := unverifiedClaims(t, tokens.IDToken)
+	query := url.Values{"id_token_hint": {tokens.IDToken}, "post_logout_redirect_uri": {testRedirectURI}, "state": {"abc"}}
+
+	// The browser has to load the iframe before it returns to the client
+	resp := b.do(http.MethodGet, "/logout?"+query.Encode(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	page, _ := io.ReadAll(resp.Body)
+
+	iframe := "https://app.example/frontchannel-logout?" + url.Values{"iss": {utils.Issuer()}, "sid": {idClaims["sid"].(string)}}.Encode()
+	if !strings.Contains(string(page), `<iframe src="`+html.EscapeString(iframe)+`"`) {
+		t.Errorf("the logout page has no iframe for %s: %s", iframe, page)
+	}
+	if !strings.Contains(string(page), `href="`+html.EscapeString(testRedirectURI+"?state=abc")+`"`) {
+		t.Errorf("the logout page doesn't lead back to the client: %s", page)
+	}
+	b.expectLoggedOut()
+}
@@ -0,0 +1,401 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/lockout"
+	"auth_go/utils"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+// Authentication method references (RFC 8176) recorded on the session
+const (
+	amrPassword    = "pwd"
+	amrOTP         = "otp"
+	amrHardwareKey = "hwk"
+	amrMFA         = "mfa"
+)
+
+// recoveryCodeCount is how many recovery codes are handed out when TOTP is enabled
+const recoveryCodeCount = 10
+
+type MFAInput struct {
+	Code         string `form:"code"`
+	RecoveryCode string `form:"recovery_code"`
+}
+
+type ConfirmTOTPInput struct {
+	Code string `form:"code" json:"code" binding:"required"`
+}
+
+// hasConfirmedTOTP reports whether the user finished enrolling an authenticator
+func hasConfirmedTOTP(ctx context.Context, db *db.Db, userID int64) (bool, error) {
+	credential, err := db.Queries.GetTOTPCredentialByUserID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return credential.ConfirmedAt.Valid, nil
+}
+
+// secondFactors reports which second factors the user has set up
+func secondFactors(ctx context.Context, db *db.Db, userID int64) (totp bool, securityKey bool, err error) {
+	if totp, err = hasConfirmedTOTP(ctx, db, userID); err != nil {
+		return false, false, err
+	}
+	credentials, err := db.Queries.ListWebAuthnCredentialsByUserID(ctx, userID)
+	if err != nil {
+		return false, false, err
+	}
+	return totp, len(credentials) > 0, nil
+}
+
+// useTOTPCode checks a code against the user's authenticator, accepting each time step only once
+func useTOTPCode(ctx context.Context, db *db.Db, credential dbcommon.TotpCredential, code string) (bool, error) {
+	secret, err := utils.DecryptSecret(credential.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// Claim the step, a code seen before (or an older one) must not work again
+	rows, err := db.Queries.UseTOTPStep(ctx, dbcommon.UseTOTPStepParams{
+		LastUsedStep:   step,
+		UserID:         credential.UserID,
+		LastUsedStep_2: step,
+	})
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// useRecoveryCode spends one of the user's unused recovery codes if code matches it
+func useRecoveryCode(ctx context.Context, db *db.Db, userID int64, code string) (bool, error) {
+	codes, err := db.Queries.ListUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	code = utils.NormalizeRecoveryCode(code)
+	for _, recoveryCode := range codes {
+		if match, _ := utils.ComparePasswordAndHash(code, recoveryCode.CodeHash); !match {
+			continue
+		}
+		rows, err := db.Queries.MarkRecoveryCodeUsed(ctx, recoveryCode.ID)
+		if err != nil {
+			return false, err
+		}
+		return rows == 1, nil
+	}
+	return false, nil
+}
+
+// mfaSession loads the authorization session of a user who still has to pass the second factor
+func mfaSession(c *gin.Context, db *db.Db) (dbcommon.GetSessionByAuthCodeRow, dbcommon.Client, bool) {
+	ctx := context.Background()
+
+	authCode, err := c.Cookie("auth_code")
+	if err != nil {
+		log.Printf("Error getting auth code from cookie: %v", err)
+		renderError(c, http.StatusBadRequest, "No authorization request found")
+		return dbcommon.GetSessionByAuthCodeRow{}, dbcommon.Client{}, false
+	}
+
+	authSession, err := db.Queries.GetSessionByAuthCode(ctx, authCode)
+	if err != nil || !authSession.MfaUserID.Valid {
+		log.Printf("Error getting session awaiting MFA by auth code: %v", err)
+		renderError(c, http.StatusBadRequest, "Invalid authorization request")
+		return dbcommon.GetSessionByAuthCodeRow{}, dbcommon.Client{}, false
+	}
+
+	client, err := db.Queries.GetClientByID(ctx, authSession.ClientID)
+	if err != nil {
+		log.Printf("Error getting client by ID: %v", err)
+		renderError(c, http.StatusBadRequest, "Invalid client")
+		return dbcommon.GetSessionByAuthCodeRow{}, dbcommon.Client{}, false
+	}
+
+	return authSession, client, true
+}
+
+func MFAPage(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authSession, client, ok := mfaSession(c, db)
+		if !ok {
+			return
+		}
+
+		totp, securityKey, err := secondFactors(context.Background(), db, authSession.MfaUserID.Int64)
+		if err != nil {
+			log.Printf("Error getting second factors for user %d: %v", authSession.MfaUserID.Int64, err)
+			renderError(c, http.StatusInternalServerError, "Failed to load second factors")
+			return
+		}
+
+		c.HTML(http.StatusOK, "mfa.html", gin.H{
+			"NamespaceName": client.Name,
+			"TOTP":          totp,
+			"SecurityKey":   securityKey,
+		})
+	}
+}
+
+// VerifyMFA completes a login with either an authenticator code or a recovery code
+func VerifyMFA(db *db.Db, guard *lockout.Guard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input MFAInput
+		if err := c.ShouldBind(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+			log.Printf("Error binding MFA input: %v", err)
+			renderError(c, http.StatusBadRequest, "Invalid input")
+			return
+		}
+
+		authSession, client, ok := mfaSession(c, db)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		userID := authSession.MfaUserID.Int64
+
+		user, err := db.Queries.GetUserByID(ctx, userID)
+		if err != nil {
+			log.Printf("Error getting user %d: %v", userID, err)
+			renderError(c, http.StatusInternalServerError, "Failed to verify code")
+			return
+		}
+
+		// Codes are short, guessing them counts towards the lockout just like passwords
+		if wait := loginWait(guard, user); wait > 0 {
+			abortLoginThrottled(c, user, wait)
+			return
+		}
+
+		var verified bool
+		var amr string
+		if input.Code != "" {
+			var credential dbcommon.TotpCredential
+			credential, err = db.Queries.GetTOTPCredentialByUserID(ctx, userID)
+			if err == nil && credential.ConfirmedAt.Valid {
+				verified, err = useTOTPCode(ctx, db, credential, input.Code)
+			} else if errors.Is(err, sql.ErrNoRows) {
+				err = nil
+			}
+			amr = amrPassword + " " + amrOTP + " " + amrMFA
+		} else {
+			verified, err = useRecoveryCode(ctx, db, userID, input.RecoveryCode)
+			amr = amrPassword + " " + amrMFA
+		}
+		if err != nil {
+			log.Printf("Error verifying second factor for user %d: %v", userID, err)
+			renderError(c, http.StatusInternalServerError, "Failed to verify code")
+			return
+		}
+		if !verified {
+			log.Printf("Invalid second factor for user %d", userID)
+			recordLoginFailure(ctx, db, guard, user, c.ClientIP())
+			totp, securityKey, _ := secondFactors(ctx, db, userID)
+			c.HTML(http.StatusUnauthorized, "mfa.html", gin.H{
+				"NamespaceName": client.Name,
+				"TOTP":          totp,
+				"SecurityKey":   securityKey,
+				"Error":         "Invalid code",
+			})
+			return
+		}
+
+		// The account may have been disabled since the password was checked
+		if user.DisabledAt.Valid {
+			log.Printf("Login refused for disabled user: %s", user.Uuid)
+			renderError(c, http.StatusForbidden, "This account has been disabled")
+			return
+		}
+
+		if err := completeLogin(ctx, c, db, authSession.AuthCode, userID, amr); err != nil {
+			log.Printf("Error updating user session: %v", err)
+			renderError(c, http.StatusInternalServerError, "Failed to update session")
+			return
+		}
+		clearLoginFailures(ctx, db, user)
+
+		c.Redirect(http.StatusFound, authorizeURL(client.Namespace, authSession))
+	}
+}
+
+// totpIssuer is the name authenticator apps show next to the account
+func totpIssuer() string {
+	if u, err := url.Parse(utils.Issuer()); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return utils.Issuer()
+}
+
+// EnrollTOTP starts enrolment of an authenticator app for the user the access token was issued to.
+// The secret only takes effect once a code from it is confirmed.
+func EnrollTOTP(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := authenticatedUser(c, db)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		enrolled, err := hasConfirmedTOTP(ctx, db, user.ID)
+		if err != nil {
+			log.Printf("Error getting TOTP credential for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll authenticator"})
+			return
+		}
+		if enrolled {
+			c.JSON(http.StatusConflict, gin.H{"error": "An authenticator is already enabled"})
+			return
+		}
+
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			log.Printf("Error generating TOTP secret: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll authenticator"})
+			return
+		}
+
+		encrypted, err := utils.EncryptSecret(secret)
+		if errors.Is(err, utils.ErrNoSecretKey) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Multi-factor authentication is not configured"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error encrypting TOTP secret: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll authenticator"})
+			return
+		}
+
+		err = db.Queries.UpsertTOTPCredential(ctx, dbcommon.UpsertTOTPCredentialParams{
+			UserID: user.ID,
+			Secret: encrypted,
+		})
+		if err != nil {
+			log.Printf("Error storing TOTP credential for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll authenticator"})
+			return
+		}
+
+		uri := utils.TOTPURI(totpIssuer(), user.Email, secret)
+		png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+		if err != nil {
+			log.Printf("Error generating TOTP QR code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll authenticator"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": uri,
+			"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		})
+	}
+}
+
+// ConfirmTOTP enables the enrolled authenticator once the user proves it works,
+// returning a fresh set of recovery codes. They are only ever shown here.
+func ConfirmTOTP(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := authenticatedUser(c, db)
+		if !ok {
+			return
+		}
+
+		var input ConfirmTOTPInput
+		if err := c.ShouldBind(&input); err != nil {
+			log.Printf("Error binding confirm TOTP input: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+			return
+		}
+
+		ctx := context.Background()
+		credential, err := db.Queries.GetTOTPCredentialByUserID(ctx, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No authenticator enrollment in progress"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error getting TOTP credential for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm authenticator"})
+			return
+		}
+		if credential.ConfirmedAt.Valid {
+			c.JSON(http.StatusConflict, gin.H{"error": "An authenticator is already enabled"})
+			return
+		}
+
+		verified, err := useTOTPCode(ctx, db, credential, input.Code)
+		if err != nil {
+			log.Printf("Error verifying TOTP code for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm authenticator"})
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+			return
+		}
+
+		codes, err := replaceRecoveryCodes(ctx, db, user.ID)
+		if err != nil {
+			log.Printf("Error creating recovery codes for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm authenticator"})
+			return
+		}
+
+		if err := db.Queries.ConfirmTOTPCredential(ctx, user.ID); err != nil {
+			log.Printf("Error confirming TOTP credential for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm authenticator"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and stores a new set, returning them in plain text
+func replaceRecoveryCodes(ctx context.Context, db *db.Db, userID int64) ([]string, error) {
+	if err := db.Queries.DeleteRecoveryCodesByUserID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := utils.GenerateFromPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		err = db.Queries.CreateRecoveryCode(ctx, dbcommon.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hash,
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
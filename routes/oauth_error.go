@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthError is an error response of RFC 6749. The token, revocation and introspection endpoints
+// return it as JSON (section 5.2), /authorize adds it to the query of the redirect URI (section 4.1.2.1).
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	// Status is the HTTP status of the response when the error isn't redirected
+	Status int `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// invalidRequest is for a request missing a parameter or having one that isn't valid
+func invalidRequest(description string) *OAuthError {
+	return &OAuthError{Code: "invalid_request", Description: description, Status: http.StatusBadRequest}
+}
+
+// invalidClient is for a client that is unknown or failed to authenticate
+func invalidClient(description string) *OAuthError {
+	return &OAuthError{Code: "invalid_client", Description: description, Status: http.StatusUnauthorized}
+}
+
+// invalidGrant is for a code or refresh token that is invalid, expired, revoked or issued to another client
+func invalidGrant(description string) *OAuthError {
+	return &OAuthError{Code: "invalid_grant", Description: description, Status: http.StatusBadRequest}
+}
+
+// unauthorizedClient is for a client that may not use the grant type it asked for
+func unauthorizedClient(description string) *OAuthError {
+	return &OAuthError{Code: "unauthorized_client", Description: description, Status: http.StatusBadRequest}
+}
+
+// unsupportedGrantType is for a grant type the token endpoint doesn't know
+func unsupportedGrantType(description string) *OAuthError {
+	return &OAuthError{Code: "unsupported_grant_type", Description: description, Status: http.StatusBadRequest}
+}
+
+// unsupportedResponseType is for a response type /authorize doesn't know
+func unsupportedResponseType(description string) *OAuthError {
+	return &OAuthError{Code: "unsupported_response_type", Description: description, Status: http.StatusBadRequest}
+}
+
+// invalidScope is for a scope that is unknown or more than the client may have
+func invalidScope(description string) *OAuthError {
+	return &OAuthError{Code: "invalid_scope", Description: description, Status: http.StatusBadRequest}
+}
+
+// accessDenied is for a request the user turned down
+func accessDenied(description string) *OAuthError {
+	return &OAuthError{Code: "access_denied", Description: description, Status: http.StatusForbidden}
+}
+
+// loginRequired is for prompt=none when the user would have to log in (OpenID Connect Core 3.1.2.6)
+func loginRequired(description string) *OAuthError {
+	return &OAuthError{Code: "login_required", Description: description, Status: http.StatusBadRequest}
+}
+
+// consentRequired is for prompt=none when the user would have to consent (OpenID Connect Core 3.1.2.6)
+func consentRequired(description string) *OAuthError {
+	return &OAuthError{Code: "consent_required", Description: description, Status: http.StatusBadRequest}
+}
+
+// invalidToken is for a bearer token that is expired, revoked or malformed (RFC 6750 section 3.1)
+func invalidToken(description string) *OAuthError {
+	return &OAuthError{Code: "invalid_token", Description: description, Status: http.StatusUnauthorized}
+}
+
+// serverError is for a failure on our side
+func serverError(description string) *OAuthError {
+	return &OAuthError{Code: "server_error", Description: description, Status: http.StatusInternalServerError}
+}
+
+// temporarilyUnavailable is for a failure that is expected to go away, such as an unreachable database
+func temporarilyUnavailable(description string) *OAuthError {
+	return &OAuthError{Code: "temporarily_unavailable", Description: description, Status: http.StatusServiceUnavailable}
+}
+
+// abortWithError responds with the error as JSON, which must not be cached (RFC 6749 section 5.1)
+func abortWithError(c *gin.Context, err *OAuthError) {
+	noStore(c)
+	c.AbortWithStatusJSON(err.Status, err)
+}
+
+// respondWithTokens responds with issued tokens, which must not be cached either (RFC 6749 section 5.1)
+func respondWithTokens(c *gin.Context, response gin.H) {
+	noStore(c)
+	c.JSON(http.StatusOK, response)
+}
+
+// noStore keeps the response out of browser and proxy caches
+func noStore(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+}
+
+// abortBearerError responds to a request to a protected resource with the error in the
+// WWW-Authenticate header as well as the body (RFC 6750 section 3)
+func abortBearerError(c *gin.Context, err *OAuthError) {
+	c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error=%q`, err.Code))
+	c.AbortWithStatusJSON(err.Status, err)
+}
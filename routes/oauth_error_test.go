@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestAuthorizeRedirectedErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(query url.Values)
+		code   string
+	}{
+		{name: "missing response_type", change: func(q url.Values) { q.Del("response_type") }, code: "invalid_request"},
+		{name: "unsupported response_type", change: func(q url.Values) { q.Set("response_type", "token") }, code: "unsupported_response_type"},
+		{name: "missing code_challenge", change: func(q url.Values) { q.Del("code_challenge") }, code: "invalid_request"},
+		{name: "unsupported code_challenge_method", change: func(q url.Values) { q.Set("code_challenge_method", "S512") }, code: "invalid_request"},
+		{name: "scope not allowed", change: func(q url.Values) { q.Set("scope", "admin") }, code: "invalid_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			b := server.browser(t)
+
+			query := authorizeQuery(s256(testVerifier), "S256", "")
+			tt.change(query)
+			result := expectClientRedirect(t, b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil)))
+			if got := result.Get("error"); got != tt.code {
+				t.Errorf("got error %q, want %q", got, tt.code)
+			}
+			if result.Get("error_description") == "" {
+				t.Error("no error_description in redirect")
+			}
+		})
+	}
+}
+
+func TestAuthorizeUntrustedRedirect(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(query url.Values)
+	}{
+		{name: "missing redirect_uri", change: func(q url.Values) { q.Del("redirect_uri") }},
+		{name: "unregistered redirect_uri", change: func(q url.Values) { q.Set("redirect_uri", "https://evil.example/callback") }},
+		{name: "unknown namespace", change: func(q url.Values) { q.Set("namespace", "unknown") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			b := server.browser(t)
+
+			query := authorizeQuery(s256(testVerifier), "S256", "")
+			tt.change(query)
+			resp := b.do(http.MethodGet, "/authorize?"+query.Encode(), nil)
+			expectStatus(t, resp, http.StatusBadRequest)
+			if location := resp.Header.Get("Location"); location != "" {
+				t.Errorf("redirected to %s", location)
+			}
+		})
+	}
+}
+
+func TestTokenErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+		code   string
+	}{
+		{
+			name:   "missing grant_type",
+			form:   url.Values{"client_id": {testNamespace}},
+			status: http.StatusBadRequest,
+			code:   "invalid_request",
+		},
+		{
+			name:   "unsupported grant_type",
+			form:   url.Values{"grant_type": {"password"}, "client_id": {testNamespace}},
+			status: http.StatusBadRequest,
+			code:   "unsupported_grant_type",
+		},
+		{
+			name:   "unknown client",
+			form:   url.Values{"grant_type": {"authorization_code"}, "client_id": {"unknown"}},
+			status: http.StatusUnauthorized,
+			code:   "invalid_client",
+		},
+		{
+			name:   "missing code_verifier",
+			form:   url.Values{"grant_type": {"authorization_code"}, "client_id": {testNamespace}, "code": {"abc"}},
+			status: http.StatusBadRequest,
+			code:   "invalid_request",
+		},
+		{
+			name: "unknown code",
+			form: url.Values{
+				"grant_type":    {"authorization_code"},
+				"client_id":     {testNamespace},
+				"code":          {"abc"},
+				"code_verifier": {testVerifier},
+				"redirect_uri":  {testRedirectURI},
+			},
+			status: http.StatusBadRequest,
+			code:   "invalid_grant",
+		},
+		{
+			name:   "unknown refresh token",
+			form:   url.Values{"grant_type": {"refresh_token"}, "client_id": {testNamespace}, "refresh_token": {"abc"}},
+			status: http.StatusBadRequest,
+			code:   "invalid_grant",
+		},
+		{
+			name:   "client_credentials for a public client",
+			form:   url.Values{"grant_type": {"client_credentials"}, "client_id": {testNamespace}},
+			status: http.StatusBadRequest,
+			code:   "unauthorized_client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			b := server.browser(t)
+
+			resp := b.do(http.MethodPost, "/token", tt.form)
+			expectStatus(t, resp, tt.status)
+			if got := resp.Header.Get("Cache-Control"); got != "no-store" {
+				t.Errorf("got Cache-Control %q, want no-store", got)
+			}
+			var body OAuthError
+			decodeJSON(t, resp, &body)
+			if body.Code != tt.code || body.Description == "" {
+				t.Errorf("got %+v, want error %s with a description", body, tt.code)
+			}
+		})
+	}
+}
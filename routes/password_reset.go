@@ -0,0 +1,216 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/mail"
+	"auth_go/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mailTimeout bounds how long delivering a single mail may take
+const mailTimeout = 30 * time.Second
+
+type ForgotPasswordInput struct {
+	Email     string `form:"email" binding:"required"`
+	Namespace string `form:"namespace"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `form:"token" binding:"required"`
+	Password string `form:"password" binding:"required"`
+}
+
+func ForgotPasswordPage(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.HTML(http.StatusOK, "forgot_password.html", gin.H{
+			"Namespace": c.Query("namespace"),
+		})
+	}
+}
+
+func ForgotPassword(db *db.Db, mailer mail.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ForgotPasswordInput
+		if err := c.ShouldBind(&input); err != nil {
+			log.Printf("Error binding forgot password input: %v", err)
+			c.HTML(http.StatusBadRequest, "forgot_password.html", gin.H{"Error": "Email is required"})
+			return
+		}
+
+		// Always answer the same way so the form can't be used to find out who has an account
+		sent := gin.H{
+			"Namespace": input.Namespace,
+			"Message":   "If an account exists for that email, a link to reset the password has been sent.",
+		}
+
+		ctx := context.Background()
+		namespaceID, err := NamespaceUserPool(ctx, db, input.Namespace)
+		if err != nil {
+			log.Printf("Error getting client by namespace %s: %v", input.Namespace, err)
+			c.HTML(http.StatusOK, "forgot_password.html", sent)
+			return
+		}
+
+		user, err := db.Queries.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{
+			NamespaceID: namespaceID,
+			Email:       input.Email,
+		})
+		if err != nil {
+			log.Printf("Password reset requested for unknown email: %v", err)
+			c.HTML(http.StatusOK, "forgot_password.html", sent)
+			return
+		}
+
+		token, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			log.Printf("Error generating password reset token: %v", err)
+			c.HTML(http.StatusInternalServerError, "forgot_password.html", gin.H{"Error": "Failed to reset password"})
+			return
+		}
+
+		err = db.Queries.CreatePasswordResetToken(ctx, dbcommon.CreatePasswordResetTokenParams{
+			UserID:    user.ID,
+			TokenHash: utils.HashOpaqueToken(token),
+			ExpiresAt: time.Now().Add(utils.PasswordResetLifetime),
+		})
+		if err != nil {
+			log.Printf("Error storing password reset token: %v", err)
+			c.HTML(http.StatusInternalServerError, "forgot_password.html", gin.H{"Error": "Failed to reset password"})
+			return
+		}
+
+		link := utils.Issuer() + "/password/reset?" + url.Values{"token": {token}}.Encode()
+		msg := mail.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %v.\n\n%s\n\n"+
+				"If you didn't ask to reset your password you can ignore this email.\n",
+				user.Firstname, utils.PasswordResetLifetime, link),
+		}
+
+		// Deliver in the background so response time doesn't reveal whether the account exists
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+			defer cancel()
+			if err := mailer.Send(ctx, msg); err != nil {
+				log.Printf("Error sending password reset mail to user %s: %v", user.Uuid, err)
+			}
+		}()
+
+		c.HTML(http.StatusOK, "forgot_password.html", sent)
+	}
+}
+
+// validResetToken returns the stored reset token if it exists, is unused and hasn't expired
+func validResetToken(ctx context.Context, db *db.Db, token string) (dbcommon.PasswordResetToken, bool) {
+	resetToken, err := db.Queries.GetPasswordResetTokenByHash(ctx, utils.HashOpaqueToken(token))
+	if err != nil {
+		log.Printf("Error getting password reset token: %v", err)
+		return resetToken, false
+	}
+	if resetToken.UsedAt.Valid || time.Now().After(resetToken.ExpiresAt) {
+		return resetToken, false
+	}
+	return resetToken, true
+}
+
+func ResetPasswordPage(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if _, ok := validResetToken(context.Background(), db, token); !ok {
+			renderError(c, http.StatusBadRequest, "This password reset link is invalid or has expired")
+			return
+		}
+
+		c.HTML(http.StatusOK, "reset_password.html", gin.H{"Token": token})
+	}
+}
+
+func ResetPassword(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ResetPasswordInput
+		if err := c.ShouldBind(&input); err != nil {
+			log.Printf("Error binding reset password input: %v", err)
+			c.HTML(http.StatusBadRequest, "reset_password.html", gin.H{
+				"Token": c.PostForm("token"),
+				"Error": "A new password is required",
+			})
+			return
+		}
+
+		ctx := context.Background()
+		resetToken, ok := validResetToken(ctx, db, input.Token)
+		if !ok {
+			renderError(c, http.StatusBadRequest, "This password reset link is invalid or has expired")
+			return
+		}
+
+		encodedHash, err := utils.GenerateFromPassword(input.Password)
+		if err != nil {
+			log.Printf("Error generating password hash: %v", err)
+			renderError(c, http.StatusInternalServerError, "Failed to reset password")
+			return
+		}
+
+		// Claim the token, a concurrent request may have used it already
+		rows, err := db.Queries.MarkPasswordResetTokenUsed(ctx, resetToken.ID)
+		if err != nil || rows == 0 {
+			log.Printf("Error marking password reset token %d as used: %v", resetToken.ID, err)
+			renderError(c, http.StatusBadRequest, "This password reset link is invalid or has expired")
+			return
+		}
+
+		err = db.Queries.UpdateUserPassword(ctx, dbcommon.UpdateUserPasswordParams{
+			Password: encodedHash,
+			ID:       resetToken.UserID,
+		})
+		if err != nil {
+			log.Printf("Error updating password for user %d: %v", resetToken.UserID, err)
+			// The password is unchanged, the link can be used to try again
+			if err := db.Queries.ReleasePasswordResetToken(ctx, resetToken.ID); err != nil {
+				log.Printf("Error releasing password reset token %d: %v", resetToken.ID, err)
+			}
+			renderError(c, http.StatusInternalServerError, "Failed to reset password")
+			return
+		}
+
+		// Whoever knew the old password must not stay logged in
+		if err := InvalidateUserSessions(ctx, db, resetToken.UserID); err != nil {
+			log.Printf("Error invalidating sessions for user %d: %v", resetToken.UserID, err)
+			renderError(c, http.StatusInternalServerError, "Failed to reset password")
+			return
+		}
+
+		// Proving access to the mailbox lifts a lockout
+		if err := db.Queries.UnlockUser(ctx, resetToken.UserID); err != nil {
+			log.Printf("Error unlocking user %d: %v", resetToken.UserID, err)
+		}
+
+		c.HTML(http.StatusOK, "reset_password.html", gin.H{
+			"Message": "Your password has been changed. You can now log in with your new password.",
+		})
+	}
+}
+
+// InvalidateUserSessions ends every session, SSO session and refresh token of the user, along with outstanding reset links
+func InvalidateUserSessions(ctx context.Context, db *db.Db, userID int64) error {
+	if err := db.Queries.DeleteUserSessionsByUserID(ctx, sql.NullInt64{Int64: userID, Valid: true}); err != nil {
+		return err
+	}
+	if err := db.Queries.DeleteSSOSessionsByUserID(ctx, userID); err != nil {
+		return err
+	}
+	if err := db.Queries.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	return db.Queries.DeletePasswordResetTokensByUserID(ctx, userID)
+}
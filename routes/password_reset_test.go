@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// failingPasswordUpdate fails to store new passwords, as an unavailable database would
+type failingPasswordUpdate struct {
+	db.Store
+}
+
+func (s failingPasswordUpdate) UpdateUserPassword(ctx context.Context, arg dbcommon.UpdateUserPasswordParams) error {
+	return errors.New("database unavailable")
+}
+
+func TestResetPasswordFailureKeepsLink(t *testing.T) {
+	server := newTestServer(t)
+	server.router.GET("/password/reset", ResetPasswordPage(server.db))
+	server.router.POST("/password/reset", ResetPassword(server.db))
+	b := server.browser(t)
+	ctx := context.Background()
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.store.CreatePasswordResetToken(ctx, dbcommon.CreatePasswordResetTokenParams{
+		UserID:    server.user.ID,
+		TokenHash: utils.HashOpaqueToken(token),
+		ExpiresAt: time.Now().Add(utils.PasswordResetLifetime),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset := url.Values{"token": {token}, "password": {"a new password"}}
+
+	server.db.Queries = failingPasswordUpdate{server.store}
+	expectStatus(t, b.do(http.MethodPost, "/password/reset", reset), http.StatusInternalServerError)
+
+	// The password didn't change, so the link still works
+	server.db.Queries = server.store
+	expectStatus(t, b.do(http.MethodGet, "/password/reset?"+url.Values{"token": {token}}.Encode(), nil), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPost, "/password/reset", reset), http.StatusOK)
+
+	user, err := server.store.GetUserByID(ctx, server.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Password == server.user.Password {
+		t.Error("the password was not changed")
+	}
+	expectStatus(t, b.do(http.MethodPost, "/password/reset", reset), http.StatusBadRequest)
+}
@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values of the prompt parameter (OpenID Connect Core 1.0, section 3.1.2.1)
+const (
+	// promptNone asks for a code without showing any page, failing when the user would have to act
+	promptNone = "none"
+	// promptLogin asks for the user to log in again even with an SSO session
+	promptLogin = "login"
+	// promptConsent asks for the consent page even for scopes granted before
+	promptConsent = "consent"
+	// promptSelectAccount asks for a choice of account, which is the login form as there is one SSO session per browser
+	promptSelectAccount = "select_account"
+)
+
+// parsePrompt validates the space separated prompt parameter and returns it normalized
+func parsePrompt(prompt string) (string, error) {
+	values := strings.Fields(prompt)
+	for _, value := range values {
+		switch value {
+		case promptNone, promptLogin, promptConsent, promptSelectAccount:
+		default:
+			return "", fmt.Errorf("unsupported prompt value %q", value)
+		}
+	}
+	if slices.Contains(values, promptNone) && len(values) > 1 {
+		return "", errors.New("prompt none can't be combined with other values")
+	}
+	return strings.Join(values, " "), nil
+}
+
+// hasPrompt reports whether the normalized prompt contains value
+func hasPrompt(prompt, value string) bool {
+	return slices.Contains(strings.Fields(prompt), value)
+}
+
+// authTimeLimit returns the earliest authentication time max_age accepts, zero when it isn't given
+func authTimeLimit(maxAge string, now time.Time) (time.Time, error) {
+	if maxAge == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.Atoi(maxAge)
+	if err != nil || seconds < 0 {
+		return time.Time{}, errors.New("max_age must be a non-negative number of seconds")
+	}
+	return now.Add(-time.Duration(seconds) * time.Second), nil
+}
@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// authorizeWith sends the browser to /authorize with extra parameters and returns where it is redirected
+func (b *browser) authorizeWith(scope string, extra url.Values) *url.URL {
+	b.t.Helper()
+
+	query := authorizeQuery(s256(testVerifier), "S256", scope)
+	for key, values := range extra {
+		query[key] = values
+	}
+	return b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+}
+
+// expectClientRedirect checks the browser was sent back to the client and returns the query it got
+func expectClientRedirect(t *testing.T, location *url.URL) url.Values {
+	t.Helper()
+
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURI {
+		t.Fatalf("authorize redirected to %s, want %s", location, testRedirectURI)
+	}
+	if state := location.Query().Get("state"); state != "xyz" {
+		t.Fatalf("got state %q, want xyz", state)
+	}
+	return location.Query()
+}
+
+func TestPromptNone(t *testing.T) {
+	t.Run("without SSO session", func(t *testing.T) {
+		server := newTestServer(t)
+		b := server.browser(t)
+
+		query := expectClientRedirect(t, b.authorizeWith("", url.Values{"prompt": {"none"}}))
+		if got := query.Get("error"); got != "login_required" {
+			t.Fatalf("got error %q, want login_required", got)
+		}
+	})
+
+	t.Run("with SSO session", func(t *testing.T) {
+		server := newTestServer(t)
+		b := server.browser(t)
+		b.authorize(s256(testVerifier), "S256", "")
+
+		query := expectClientRedirect(t, b.authorizeWith("", url.Values{"prompt": {"none"}}))
+		if query.Get("code") == "" {
+			t.Fatalf("no code in redirect %v", query)
+		}
+	})
+
+	t.Run("without consent", func(t *testing.T) {
+		server := newTestServer(t)
+		b := server.browser(t)
+		b.authorize(s256(testVerifier), "S256", "")
+
+		query := expectClientRedirect(t, b.authorizeWith("openid", url.Values{"prompt": {"none"}}))
+		if got := query.Get("error"); got != "consent_required" {
+			t.Fatalf("got error %q, want consent_required", got)
+		}
+		if _, ok := b.cookies["auth_code"]; ok {
+			t.Error("auth_code cookie was not cleared")
+		}
+	})
+}
+
+func TestPromptInvalid(t *testing.T) {
+	for _, prompt := range []string{"none login", "unknown"} {
+		t.Run(prompt, func(t *testing.T) {
+			server := newTestServer(t)
+			b := server.browser(t)
+
+			query := expectClientRedirect(t, b.authorizeWith("", url.Values{"prompt": {prompt}}))
+			if got := query.Get("error"); got != "invalid_request" {
+				t.Fatalf("got error %q, want invalid_request", got)
+			}
+		})
+	}
+}
+
+func TestPromptLoginWithHint(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	b.authorize(s256(testVerifier), "S256", "")
+
+	location := b.authorizeWith("", url.Values{"prompt": {"login"}, "login_hint": {"hint@example.com"}})
+	if location.Path != "/login" {
+		t.Fatalf("authorize redirected to %s, want /login", location)
+	}
+
+	resp := b.do(http.MethodGet, "/login", nil)
+	expectStatus(t, resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `value="hint@example.com"`) {
+		t.Error("login form is not pre-filled with the login hint")
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	b.authorize(s256(testVerifier), "S256", "")
+
+	query := expectClientRedirect(t, b.authorizeWith("", url.Values{"max_age": {"3600"}}))
+	if query.Get("code") == "" {
+		t.Fatalf("no code in redirect %v", query)
+	}
+
+	location := b.authorizeWith("", url.Values{"max_age": {"0"}})
+	if location.Path != "/login" {
+		t.Fatalf("authorize redirected to %s, want /login", location)
+	}
+}
+
+func TestPromptConsent(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	b.authorize(s256(testVerifier), "S256", "openid")
+
+	// Consent was granted, yet the client asks for it again
+	location := b.authorizeWith("openid", url.Values{"prompt": {"consent"}})
+	if location.Path != "/consent" {
+		t.Fatalf("authorize redirected to %s, want /consent", location)
+	}
+	resp := b.do(http.MethodGet, "/consent", nil)
+	expectStatus(t, resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), scopeDescriptions["openid"]) {
+		t.Error("consent page does not list the scope granted before")
+	}
+
+	location = b.expectRedirect(b.do(http.MethodPost, "/consent", url.Values{"action": {"approve"}}))
+	query := expectClientRedirect(t, b.expectRedirect(b.do(http.MethodGet, location.String(), nil)))
+	if query.Get("code") == "" {
+		t.Fatalf("no code in redirect %v", query)
+	}
+}
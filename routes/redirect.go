@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"auth_go/db"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// isRegisteredRedirectURI reports whether redirectURI exactly matches one registered for the client
+func isRegisteredRedirectURI(ctx context.Context, db *db.Db, clientID int64, redirectURI string) (bool, error) {
+	registered, err := db.Queries.ListClientRedirectURIs(ctx, clientID)
+	if err != nil {
+		return false, err
+	}
+
+	// Compare in Go rather than SQL so the match is byte for byte regardless of collation
+	for _, uri := range registered {
+		if uri == redirectURI {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// buildRedirectURL adds params to the query of redirectURI, keeping any parameters it already has
+func buildRedirectURL(redirectURI string, params url.Values) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+	if !u.IsAbs() || u.Fragment != "" {
+		return "", errors.New("redirect URI must be absolute and have no fragment")
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// renderError shows the error page, used when we can't safely redirect back to the client
+func renderError(c *gin.Context, status int, message string) {
+	c.HTML(status, "error.html", gin.H{"Error": message})
+}
+
+// redirectError sends an OAuth error back to an already validated redirect URI
+func redirectError(c *gin.Context, redirectURI, state string, oauthErr *OAuthError) {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	redirectURL, err := buildRedirectURL(redirectURI, params)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, oauthErr.Description)
+		return
+	}
+	c.Redirect(http.StatusFound, redirectURL)
+}
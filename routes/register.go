@@ -3,16 +3,18 @@ package routes
 import (
 	"auth_go/db"
 	"auth_go/dbcommon"
+	"auth_go/mail"
 	"auth_go/utils"
 	"context"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-func Register(db *db.Db) gin.HandlerFunc {
+func Register(db *db.Db, mailer mail.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		if c.PostForm("email") == "" || c.PostForm("password") == "" || c.PostForm("firstname") == "" || c.PostForm("lastname") == "" {
@@ -22,7 +24,27 @@ func Register(db *db.Db) gin.HandlerFunc {
 
 		ctx := context.Background()
 
-		user, err := db.Queries.GetUserByEmail(ctx, c.PostForm("email"))
+		// Register into the user pool of the client the form was shown for, or the global pool
+		namespaceID := globalUserPool
+		if c.PostForm("namespace_id") != "" {
+			clientID, err := strconv.ParseInt(c.PostForm("namespace_id"), 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid namespace"})
+				return
+			}
+			client, err := db.Queries.GetClientByID(ctx, clientID)
+			if err != nil {
+				log.Printf("Error getting client by ID %d: %v", clientID, err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid namespace"})
+				return
+			}
+			namespaceID = userPoolID(client)
+		}
+
+		user, err := db.Queries.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{
+			NamespaceID: namespaceID,
+			Email:       c.PostForm("email"),
+		})
 		if err == nil && user.Email != "" {
 			log.Printf("Error getting user by email: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
@@ -36,13 +58,29 @@ func Register(db *db.Db) gin.HandlerFunc {
 			return
 		}
 
-		db.Queries.CreateUser(ctx, dbcommon.CreateUserParams{
-			Email:     c.PostForm("email"),
-			Password:  encodedHash,
-			Uuid:      uuid.New().String(),
-			Firstname: c.PostForm("firstname"),
-			Lastname:  c.PostForm("lastname"),
+		userUUID := uuid.New().String()
+		err = db.Queries.CreateUser(ctx, dbcommon.CreateUserParams{
+			NamespaceID: namespaceID,
+			Email:       c.PostForm("email"),
+			Password:    encodedHash,
+			Uuid:        userUUID,
+			Firstname:   c.PostForm("firstname"),
+			Lastname:    c.PostForm("lastname"),
 		})
+		if err != nil {
+			log.Printf("Error creating user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
+		}
+
+		// Ask the user to prove they own the address
+		user, err = db.Queries.GetUserByUUID(ctx, userUUID)
+		if err == nil {
+			err = sendVerificationEmail(ctx, db, mailer, user)
+		}
+		if err != nil {
+			log.Printf("Error sending verification email to user %s: %v", userUUID, err)
+		}
 
 		c.JSON(http.StatusOK, gin.H{"status": "User created successfully"})
 	}
@@ -50,8 +88,21 @@ func Register(db *db.Db) gin.HandlerFunc {
 
 func RegisterPage(db *db.Db) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		data := gin.H{}
+
+		// Register into the namespace's user pool when one is given
+		if namespace := c.Query("namespace"); namespace != "" {
+			client, err := db.Queries.GetClientByNamespace(context.Background(), namespace)
+			if err != nil {
+				log.Printf("Error getting client by namespace %s: %v", namespace, err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid namespace"})
+				return
+			}
+			data["NamespaceName"] = client.Name
+			data["NamespaceID"] = client.ID
+		}
 
 		// Render login page with authorization parameters
-		c.HTML(http.StatusOK, "register.html", gin.H{})
+		c.HTML(http.StatusOK, "register.html", data)
 	}
 }
@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RevokeRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+var errTokenNotOwned = errors.New("token was not issued to this client")
+
+// tokenRevoker revokes token if it is of the type it handles, reporting whether it was
+type tokenRevoker func(ctx context.Context, db *db.Db, client dbcommon.Client, token string) (bool, error)
+
+// Revoke invalidates an access or refresh token as described in RFC 7009.
+// Unknown, expired or already revoked tokens are not an error, and neither are
+// tokens of another client, which are left alone.
+func Revoke(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RevokeRequest
+		if err := c.ShouldBind(&req); err != nil {
+			log.Printf("Error binding revoke request: %v", err)
+			abortWithError(c, invalidRequest("The token parameter is required"))
+			return
+		}
+
+		creds, err := readClientCredentials(c, req.ClientID, req.ClientSecret)
+		if err != nil {
+			log.Printf("Error reading client credentials: %v", err)
+			abortInvalidClient(c, creds)
+			return
+		}
+
+		ctx := context.Background()
+		client, err := authenticateClient(ctx, db, creds)
+		if err != nil {
+			log.Printf("Error authenticating client %s: %v", creds.ID, err)
+			abortInvalidClient(c, creds)
+			return
+		}
+
+		// Try the hinted token type first, the hint is only an optimisation
+		revokers := []tokenRevoker{
+			revokeAccessToken,
+			revokeRefreshToken,
+		}
+		if req.TokenTypeHint == "refresh_token" {
+			revokers[0], revokers[1] = revokers[1], revokers[0]
+		}
+
+		for _, revoke := range revokers {
+			found, err := revoke(ctx, db, client, req.Token)
+			if errors.Is(err, errTokenNotOwned) {
+				// RFC 7009 has no error for this, answering like for an unknown token doesn't tell the client it exists
+				log.Printf("Client %s tried to revoke a token issued to another client", client.Namespace)
+				break
+			}
+			if err != nil {
+				log.Printf("Error revoking token: %v", err)
+				abortWithError(c, temporarilyUnavailable("Failed to revoke token"))
+				return
+			}
+			if found {
+				break
+			}
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+// revokeAccessToken records the jti of a valid access token as revoked
+func revokeAccessToken(ctx context.Context, db *db.Db, client dbcommon.Client, token string) (bool, error) {
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		// Not an access token we can revoke, or already invalid
+		return false, nil
+	}
+
+	if claims.ClientID != client.Namespace {
+		return false, errTokenNotOwned
+	}
+
+	if err := revokeJTI(ctx, db, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// revokeJTI records the access token with the jti as revoked, taking effect on this instance immediately
+func revokeJTI(ctx context.Context, db *db.Db, jti string, expiresAt time.Time) error {
+	err := db.Queries.RevokeToken(ctx, dbcommon.RevokeTokenParams{
+		Jti:       jti,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	utils.MarkRevoked(jti, expiresAt)
+	return nil
+}
+
+// revokeRefreshToken revokes the refresh token along with the rest of its family
+func revokeRefreshToken(ctx context.Context, db *db.Db, client dbcommon.Client, token string) (bool, error) {
+	refreshToken, err := db.Queries.GetRefreshTokenByHash(ctx, utils.HashOpaqueToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if refreshToken.ClientID != client.ID {
+		return false, errTokenNotOwned
+	}
+
+	if err := db.Queries.RevokeRefreshTokenFamily(ctx, refreshToken.FamilyID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"auth_go/utils"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRevokeTokenOfAnotherClient(t *testing.T) {
+	server := newTestServer(t)
+	addOtherClient(t, server, UserPoolGlobal)
+	b := server.browser(t)
+	tokens := b.login()
+
+	revoke := func(clientID, token string) {
+		t.Helper()
+
+		resp := b.do(http.MethodPost, "/revoke", url.Values{"token": {token}, "client_id": {clientID}})
+		expectStatus(t, resp, http.StatusOK)
+	}
+
+	// Answered like an unknown token, and nothing is revoked
+	revoke("other", tokens.AccessToken)
+	revoke("other", tokens.RefreshToken)
+	if _, err := utils.ValidateJWT(tokens.AccessToken); err != nil {
+		t.Errorf("another client revoked the access token: %v", err)
+	}
+	resp := b.refresh(tokens.RefreshToken)
+	expectStatus(t, resp, http.StatusOK)
+	var refreshed loginTokens
+	decodeJSON(t, resp, &refreshed)
+
+	// The client the tokens were issued to can revoke them
+	revoke(testNamespace, refreshed.AccessToken)
+	revoke(testNamespace, refreshed.RefreshToken)
+	if _, err := utils.ValidateJWT(refreshed.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token validated with %v, want it revoked", err)
+	}
+	expectStatus(t, b.refresh(refreshed.RefreshToken), http.StatusBadRequest)
+}
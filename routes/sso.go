@@ -0,0 +1,161 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ssoCookie holds the signed token of the browser's SSO session
+const ssoCookie = "sso_session"
+
+// completeLogin attaches the authenticated user to the authorization request and remembers
+// the login in an SSO session, so authorization requests of other clients skip the login form
+func completeLogin(ctx context.Context, c *gin.Context, db *db.Db, authCode string, userID int64, amr string) error {
+	authTime := time.Now()
+
+	// The login still completes when it can't be remembered
+	var ssoSessionID sql.NullInt64
+	if session, err := startSSOSession(ctx, c, db, userID, amr, authTime); err != nil {
+		log.Printf("Error starting SSO session for user %d: %v", userID, err)
+	} else {
+		ssoSessionID = sql.NullInt64{Int64: session.ID, Valid: true}
+	}
+
+	return db.Queries.UpdateUserSession(ctx, dbcommon.UpdateUserSessionParams{
+		UserID:       sql.NullInt64{Int64: userID, Valid: true},
+		Amr:          amr,
+		AuthTime:     sql.NullTime{Time: authTime, Valid: true},
+		SsoSessionID: ssoSessionID,
+		AuthCode:     authCode,
+	})
+}
+
+// startSSOSession stores a new SSO session and sets its cookie, replacing the one the browser had
+func startSSOSession(ctx context.Context, c *gin.Context, db *db.Db, userID int64, amr string, authTime time.Time) (dbcommon.SsoSession, error) {
+	if previous, ok := ssoToken(c); ok {
+		if err := db.Queries.DeleteSSOSession(ctx, utils.HashOpaqueToken(previous)); err != nil {
+			log.Printf("Error deleting previous SSO session: %v", err)
+		}
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return dbcommon.SsoSession{}, err
+	}
+	tokenHash := utils.HashOpaqueToken(token)
+	err = db.Queries.CreateSSOSession(ctx, dbcommon.CreateSSOSessionParams{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		Sid:       uuid.NewString(),
+		Amr:       amr,
+		AuthTime:  authTime,
+		ExpiresAt: authTime.Add(utils.SessionLifetime),
+	})
+	if err != nil {
+		return dbcommon.SsoSession{}, err
+	}
+	session, err := db.Queries.GetSSOSessionByHash(ctx, tokenHash)
+	if err != nil {
+		return dbcommon.SsoSession{}, err
+	}
+
+	setCookie(c, ssoCookie, utils.SignCookie(ssoCookie, token), int(utils.SessionLifetime.Seconds()))
+	return session, nil
+}
+
+// currentSSOSession returns the unexpired SSO session of the browser, if it has one
+func currentSSOSession(ctx context.Context, c *gin.Context, db *db.Db) (dbcommon.SsoSession, bool) {
+	token, ok := ssoToken(c)
+	if !ok {
+		return dbcommon.SsoSession{}, false
+	}
+
+	session, err := db.Queries.GetSSOSessionByHash(ctx, utils.HashOpaqueToken(token))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting SSO session: %v", err)
+		}
+		return dbcommon.SsoSession{}, false
+	}
+	if !session.ExpiresAt.After(time.Now()) {
+		return dbcommon.SsoSession{}, false
+	}
+	return session, true
+}
+
+// clientSSOSession returns the browser's SSO session if its user can use the client without
+// logging in, which requires the user to have authenticated no earlier than notBefore
+func clientSSOSession(ctx context.Context, c *gin.Context, db *db.Db, client dbcommon.Client, notBefore time.Time) (dbcommon.SsoSession, bool) {
+	session, ok := currentSSOSession(ctx, c, db)
+	if !ok || session.AuthTime.Before(notBefore) {
+		return dbcommon.SsoSession{}, false
+	}
+
+	user, err := db.Queries.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		log.Printf("Error getting user %d of SSO session: %v", session.UserID, err)
+		return dbcommon.SsoSession{}, false
+	}
+	if user.NamespaceID != userPoolID(client) || user.DisabledAt.Valid {
+		return dbcommon.SsoSession{}, false
+	}
+	if client.RequireEmailVerification && !user.EmailVerified {
+		return dbcommon.SsoSession{}, false
+	}
+	return session, true
+}
+
+// resumeSSOSession logs the user of an SSO session into the authorization request
+func resumeSSOSession(ctx context.Context, db *db.Db, session dbcommon.SsoSession, authCode string) error {
+	// Keep the original authentication time and methods, the user didn't authenticate again
+	return db.Queries.UpdateUserSession(ctx, dbcommon.UpdateUserSessionParams{
+		UserID:       sql.NullInt64{Int64: session.UserID, Valid: true},
+		Amr:          session.Amr,
+		AuthTime:     sql.NullTime{Time: session.AuthTime, Valid: true},
+		SsoSessionID: sql.NullInt64{Int64: session.ID, Valid: true},
+		AuthCode:     authCode,
+	})
+}
+
+// trackSSOSessionClient records that the client received tokens in the SSO session, so it is told
+// when the session ends, and returns the sid of the session. Without the session, e.g. after the
+// user logged out, the tokens are still issued but aren't tied to any session.
+func trackSSOSessionClient(ctx context.Context, db *db.Db, ssoSessionID sql.NullInt64, client dbcommon.Client) string {
+	if !ssoSessionID.Valid {
+		return ""
+	}
+	session, err := db.Queries.GetSSOSessionByID(ctx, ssoSessionID.Int64)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting SSO session %d: %v", ssoSessionID.Int64, err)
+		}
+		return ""
+	}
+
+	err = db.Queries.AddSSOSessionClient(ctx, dbcommon.AddSSOSessionClientParams{
+		SsoSessionID: session.ID,
+		ClientID:     client.ID,
+	})
+	if err != nil {
+		log.Printf("Error adding client %s to SSO session %d: %v", client.Namespace, session.ID, err)
+	}
+	return session.Sid
+}
+
+// ssoToken returns the token of the SSO session cookie if its signature is valid
+func ssoToken(c *gin.Context) (string, bool) {
+	signed, err := c.Cookie(ssoCookie)
+	if err != nil {
+		return "", false
+	}
+	return utils.VerifyCookie(ssoCookie, signed)
+}
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"auth_go/dbcommon"
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+const otherRedirectURI = "https://other.example/callback"
+
+// addOtherClient registers a second client in the given user pool
+func addOtherClient(t *testing.T, server *testServer, userPool string) dbcommon.Client {
+	t.Helper()
+	ctx := context.Background()
+
+	other := createTestClient(t, server.store, "other")
+	other.UserPool = userPool
+	err := server.store.UpdateClient(ctx, dbcommon.UpdateClientParams{
+		Name:          other.Name,
+		AllowedScopes: other.AllowedScopes,
+		UserPool:      other.UserPool,
+		ID:            other.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.store.CreateClientRedirectURI(ctx, dbcommon.CreateClientRedirectURIParams{ClientID: other.ID, RedirectUri: otherRedirectURI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return other
+}
+
+// otherClientQuery builds the parameters the second client sends to /authorize
+func otherClientQuery() url.Values {
+	query := authorizeQuery(s256(testVerifier), "S256", "")
+	query.Set("namespace", "other")
+	query.Set("redirect_uri", otherRedirectURI)
+	return query
+}
+
+func TestSSOSessionAcrossClients(t *testing.T) {
+	server := newTestServer(t)
+	b := server.browser(t)
+	addOtherClient(t, server, UserPoolGlobal)
+
+	b.authorize(s256(testVerifier), "S256", "")
+	if _, ok := b.cookies[ssoCookie]; !ok {
+		t.Fatal("login did not set the SSO session cookie")
+	}
+
+	// The second client gets a code without the login form
+	location := b.expectRedirect(b.do(http.MethodGet, "/authorize?"+otherClientQuery().Encode(), nil))
+	if got := location.Scheme + "://" + location.Host + location.Path; got != otherRedirectURI {
+		t.Fatalf("authorize redirected to %s, want %s", location, otherRedirectURI)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in redirect %s", location)
+	}
+
+	expectStatus(t, b.do(http.MethodPost, "/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {testVerifier},
+		"redirect_uri":  {otherRedirectURI},
+		"client_id":     {"other"},
+	}), http.StatusOK)
+}
+
+func TestSSOSessionRequiresLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		userPool string
+		prepare  func(t *testing.T, server *testServer, b *browser)
+	}{
+		{
+			name:     "tampered cookie",
+			userPool: UserPoolGlobal,
+			prepare: func(t *testing.T, server *testServer, b *browser) {
+				b.cookies[ssoCookie].Value = "forged" + b.cookies[ssoCookie].Value
+			},
+		},
+		{
+			name:     "sessions invalidated",
+			userPool: UserPoolGlobal,
+			prepare: func(t *testing.T, server *testServer, b *browser) {
+				if err := InvalidateUserSessions(context.Background(), server.db, server.user.ID); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:     "disabled user",
+			userPool: UserPoolGlobal,
+			prepare: func(t *testing.T, server *testServer, b *browser) {
+				if err := server.store.DisableUser(context.Background(), server.user.ID); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:     "other user pool",
+			userPool: UserPoolNamespace,
+			prepare:  func(t *testing.T, server *testServer, b *browser) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			b := server.browser(t)
+			addOtherClient(t, server, tt.userPool)
+
+			b.authorize(s256(testVerifier), "S256", "")
+			tt.prepare(t, server, b)
+
+			location := b.expectRedirect(b.do(http.MethodGet, "/authorize?"+otherClientQuery().Encode(), nil))
+			if location.Path != "/login" {
+				t.Fatalf("authorize redirected to %s, want /login", location)
+			}
+		})
+	}
+}
@@ -2,108 +2,411 @@ package routes
 
 import (
 	"auth_go/db"
+	"auth_go/dbcommon"
 	"auth_go/utils"
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
 	"log"
-	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type TokenRequest struct {
-	GrantType    string `json:"grant_type" binding:"required"`
-	Code         string `json:"code" binding:"required"`
-	Namespace    string `json:"namespace" binding:"required"`
-	CodeVerifier string `json:"code_verifier" binding:"required"`
+	GrantType    string `json:"grant_type" form:"grant_type" binding:"required"`
+	Code         string `json:"code" form:"code"`
+	Namespace    string `json:"namespace" form:"namespace"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	Scope        string `json:"scope" form:"scope"`
 }
 
 func Token(db *db.Db) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req TokenRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
+		if err := c.ShouldBind(&req); err != nil {
 			log.Printf("Error binding token request: %v", err)
-			http.Error(c.Writer, "Error binding request", http.StatusBadRequest)
+			abortWithError(c, invalidRequest("The grant_type parameter is required"))
 			return
 		}
 
-		// 1. Validate grant type is "authorization_code"
-		if req.GrantType != "authorization_code" {
-			log.Printf("Invalid grant type: %s", req.GrantType)
-			http.Error(c.Writer, "Invalid grant type", http.StatusBadRequest)
-			return
+		// The client is identified by its namespace, sent as client_id or the legacy namespace field
+		clientID := req.ClientID
+		if clientID == "" {
+			clientID = req.Namespace
 		}
 
-		// 2. Verify client exists
-		_, err := db.Queries.GetClientByNamespace(context.Background(), req.Namespace)
+		creds, err := readClientCredentials(c, clientID, req.ClientSecret)
 		if err != nil {
-			log.Printf("Error getting client by namespace %s: %v", req.Namespace, err)
-			http.Error(c.Writer, "Invalid client", http.StatusBadRequest)
+			log.Printf("Error reading client credentials: %v", err)
+			abortInvalidClient(c, creds)
 			return
 		}
 
-		// 3. Get the authorization session using the auth code
-		authSession, err := db.Queries.GetSessionByAuthCode(context.Background(), req.Code)
+		// Verify client exists and authenticate it if it is confidential
+		client, err := authenticateClient(context.Background(), db, creds)
 		if err != nil {
-			log.Printf("Error getting session by auth code: %v", err)
-			http.Error(c.Writer, "Invalid authorization code", http.StatusBadRequest)
+			log.Printf("Error authenticating client %s: %v", creds.ID, err)
+			abortInvalidClient(c, creds)
 			return
 		}
 
-		// 4. Verify the session hasn't expired
-		if time.Now().After(authSession.ExpiresAt) {
-			log.Printf("Authorization code expired at %v", authSession.ExpiresAt)
-			http.Error(c.Writer, "Authorization code expired", http.StatusBadRequest)
-			return
+		switch req.GrantType {
+		case "authorization_code":
+			authorizationCodeGrant(c, db, client, req)
+		case "refresh_token":
+			refreshTokenGrant(c, db, client, req)
+		case "client_credentials":
+			clientCredentialsGrant(c, client, req)
+		default:
+			log.Printf("Invalid grant type: %s", req.GrantType)
+			abortWithError(c, unsupportedGrantType("The grant type is not supported"))
 		}
+	}
+}
 
-		// 5. Verify PKCE code verifier
-		if !verifyPKCE(req.CodeVerifier, authSession.PkceChallenge, authSession.PkceChallengeMethod) {
-			log.Printf("Invalid PKCE code verifier for session %s", authSession.AuthCode)
-			http.Error(c.Writer, "Invalid code verifier", http.StatusBadRequest)
-			return
-		}
+func authorizationCodeGrant(c *gin.Context, db *db.Db, client dbcommon.Client, req TokenRequest) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		log.Printf("Missing code or code_verifier for authorization_code grant")
+		abortWithError(c, invalidRequest("The code and code_verifier parameters are required"))
+		return
+	}
 
-		// 6. Get user information
-		user, err := db.Queries.GetUserByID(context.Background(), authSession.UserID.Int64)
-		if err != nil {
-			log.Printf("Error getting user by ID: %v", err)
-			http.Error(c.Writer, "Failed to get user", http.StatusInternalServerError)
-			return
-		}
+	// 1. Get the authorization session using the auth code
+	authSession, err := db.Queries.GetSessionByAuthCode(context.Background(), req.Code)
+	if err != nil {
+		log.Printf("Error getting session by auth code: %v", err)
+		abortWithError(c, invalidGrant("Invalid authorization code"))
+		return
+	}
 
-		// 7. Generate access token using the email from the session
-		accessToken, err := utils.GenerateJWT(user.Uuid)
-		if err != nil {
-			log.Printf("Error generating JWT for user %s: %v", user.Uuid, err)
-			http.Error(c.Writer, "Failed to generate token", http.StatusInternalServerError)
-			return
-		}
+	// 2. Verify the code was issued to this client
+	if authSession.ClientID != client.ID {
+		log.Printf("Authorization code issued to client %d used by client %d", authSession.ClientID, client.ID)
+		abortWithError(c, invalidGrant("Invalid authorization code"))
+		return
+	}
+
+	// 3. Verify the redirect URI is the one used at authorize time
+	if req.RedirectURI != authSession.RedirectUri {
+		log.Printf("Redirect URI %s does not match authorization request", req.RedirectURI)
+		abortWithError(c, invalidGrant("The redirect URI does not match the authorization request"))
+		return
+	}
+
+	// 4. Verify the session hasn't expired
+	if time.Now().After(authSession.ExpiresAt) {
+		log.Printf("Authorization code expired at %v", authSession.ExpiresAt)
+		abortWithError(c, invalidGrant("The authorization code has expired"))
+		return
+	}
+
+	// 5. Verify PKCE code verifier
+	if !verifyPKCE(req.CodeVerifier, authSession.PkceChallenge, authSession.PkceChallengeMethod) {
+		log.Printf("Invalid PKCE code verifier for session %s", authSession.AuthCode)
+		abortWithError(c, invalidGrant("Invalid code verifier"))
+		return
+	}
 
-		// 8. Delete the authorization session
-		if err := db.Queries.DeleteSession(context.Background(), authSession.AuthCode); err != nil {
-			log.Printf("Error deleting session %s: %v", authSession.AuthCode, err)
-			http.Error(c.Writer, "Failed to clean up session", http.StatusInternalServerError)
+	// 6. Verify the user finished logging in, including any second factor
+	if !authSession.UserID.Valid || authSession.MfaUserID.Valid {
+		log.Printf("Authorization code of session %s redeemed before the login completed", authSession.AuthCode)
+		abortWithError(c, invalidGrant("Invalid authorization code"))
+		return
+	}
+
+	// 7. Verify the user consented to the scope, the code may have been read before the consent page
+	pending, err := consentPending(context.Background(), db, authSession)
+	if err != nil {
+		log.Printf("Error checking consent of session %s: %v", authSession.AuthCode, err)
+		abortWithError(c, serverError("Failed to check consent"))
+		return
+	}
+	if pending {
+		log.Printf("Authorization code of session %s redeemed before the user consented", authSession.AuthCode)
+		abortWithError(c, invalidGrant("Invalid authorization code"))
+		return
+	}
+
+	// 8. Delete the authorization session before issuing anything, the code is single use
+	// and a concurrent redemption may have beaten us to it (RFC 6749 section 4.1.2)
+	rows, err := db.Queries.DeleteSession(context.Background(), authSession.AuthCode)
+	if err != nil {
+		log.Printf("Error deleting session %s: %v", authSession.AuthCode, err)
+		abortWithError(c, serverError("Failed to clean up session"))
+		return
+	}
+	if rows == 0 {
+		log.Printf("Authorization code of session %s was already redeemed", authSession.AuthCode)
+		abortWithError(c, invalidGrant("Invalid authorization code"))
+		return
+	}
+
+	// 9. Get user information
+	user, err := db.Queries.GetUserByID(context.Background(), authSession.UserID.Int64)
+	if err != nil {
+		log.Printf("Error getting user by ID: %v", err)
+		abortWithError(c, serverError("Failed to get user"))
+		return
+	}
+
+	// 10. Return the tokens, starting a new refresh token family
+	issueTokens(c, db, user, client, tokenGrant{
+		FamilyID:     uuid.New().String(),
+		Scope:        authSession.Scope,
+		Nonce:        authSession.Nonce,
+		AuthTime:     authSession.AuthTime,
+		Amr:          authSession.Amr,
+		SsoSessionID: authSession.SsoSessionID,
+	})
+}
+
+func refreshTokenGrant(c *gin.Context, db *db.Db, client dbcommon.Client, req TokenRequest) {
+	ctx := context.Background()
+
+	if req.RefreshToken == "" {
+		log.Printf("Missing refresh_token for refresh_token grant")
+		abortWithError(c, invalidRequest("The refresh_token parameter is required"))
+		return
+	}
+
+	// 1. Look up the stored refresh token by its hash
+	refreshToken, err := db.Queries.GetRefreshTokenByHash(ctx, utils.HashOpaqueToken(req.RefreshToken))
+	if err != nil {
+		log.Printf("Error getting refresh token: %v", err)
+		abortWithError(c, invalidGrant("Invalid refresh token"))
+		return
+	}
+
+	// 2. Verify the token was issued to this client
+	if refreshToken.ClientID != client.ID {
+		log.Printf("Refresh token issued to client %d used by client %d", refreshToken.ClientID, client.ID)
+		abortWithError(c, invalidGrant("Invalid refresh token"))
+		return
+	}
+
+	// 3. Verify the token family hasn't been revoked
+	if refreshToken.RevokedAt.Valid {
+		log.Printf("Revoked refresh token presented for family %s", refreshToken.FamilyID)
+		abortWithError(c, invalidGrant("Invalid refresh token"))
+		return
+	}
+
+	// 4. A token that was already rotated is being replayed, so revoke the whole family
+	if refreshToken.UsedAt.Valid {
+		revokeRefreshTokenFamily(db, refreshToken.FamilyID)
+		abortWithError(c, invalidGrant("Invalid refresh token"))
+		return
+	}
+
+	// 5. Verify the token hasn't expired
+	if time.Now().After(refreshToken.ExpiresAt) {
+		log.Printf("Refresh token expired at %v", refreshToken.ExpiresAt)
+		abortWithError(c, invalidGrant("The refresh token has expired"))
+		return
+	}
+
+	// 6. Mark the token as used, a concurrent request may have beaten us to it
+	rows, err := db.Queries.MarkRefreshTokenUsed(ctx, refreshToken.ID)
+	if err != nil {
+		log.Printf("Error marking refresh token %d as used: %v", refreshToken.ID, err)
+		abortWithError(c, serverError("Failed to rotate refresh token"))
+		return
+	}
+	if rows == 0 {
+		revokeRefreshTokenFamily(db, refreshToken.FamilyID)
+		abortWithError(c, invalidGrant("Invalid refresh token"))
+		return
+	}
+
+	// 7. A narrower scope may be requested, but never more than was originally granted
+	scope := refreshToken.Scope
+	if req.Scope != "" {
+		if !utils.ScopeSubset(req.Scope, refreshToken.Scope) {
+			log.Printf("Refresh requested scope %q outside of granted %q", req.Scope, refreshToken.Scope)
+			abortWithError(c, invalidScope("The requested scope exceeds the scope originally granted"))
 			return
 		}
+		scope = strings.Join(utils.ParseScope(req.Scope), " ")
+	}
+
+	// 8. Get user information
+	user, err := db.Queries.GetUserByID(ctx, refreshToken.UserID)
+	if err != nil {
+		log.Printf("Error getting user by ID: %v", err)
+		abortWithError(c, serverError("Failed to get user"))
+		return
+	}
+
+	// 9. Disabled accounts don't get new tokens
+	if user.DisabledAt.Valid {
+		log.Printf("Refresh refused for disabled user %s", user.Uuid)
+		abortWithError(c, invalidGrant("Invalid refresh token"))
+		return
+	}
+
+	// 10. Return the tokens, rotating within the same family
+	issueTokens(c, db, user, client, tokenGrant{
+		FamilyID:     refreshToken.FamilyID,
+		Scope:        scope,
+		AuthTime:     refreshToken.AuthTime,
+		Amr:          refreshToken.Amr,
+		SsoSessionID: refreshToken.SsoSessionID,
+	})
+}
+
+func clientCredentialsGrant(c *gin.Context, client dbcommon.Client, req TokenRequest) {
+	// Only clients that can keep a secret may obtain tokens on their own behalf
+	if !isConfidentialClient(client) {
+		log.Printf("Public client %s attempted client_credentials grant", client.Namespace)
+		abortWithError(c, unauthorizedClient("Only confidential clients may use the client_credentials grant"))
+		return
+	}
+
+	// Only scopes the client has declared may be granted
+	if !utils.ScopeSubset(req.Scope, client.AllowedScopes) {
+		log.Printf("Client %s requested scope %q outside of %q", client.Namespace, req.Scope, client.AllowedScopes)
+		abortWithError(c, invalidScope("The requested scope is not allowed for this client"))
+		return
+	}
+	scope := strings.Join(utils.ParseScope(req.Scope), " ")
+
+	accessToken, err := utils.GenerateJWT(utils.AccessTokenParams{
+		ClientID: client.Namespace,
+		Scope:    scope,
+	})
+	if err != nil {
+		log.Printf("Error generating JWT for client %s: %v", client.Namespace, err)
+		abortWithError(c, serverError("Failed to generate token"))
+		return
+	}
+
+	response := gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(utils.AccessTokenLifetime.Seconds()),
+	}
+	if scope != "" {
+		response["scope"] = scope
+	}
+	respondWithTokens(c, response)
+}
+
+func revokeRefreshTokenFamily(db *db.Db, familyID string) {
+	log.Printf("Refresh token reuse detected, revoking family %s", familyID)
+	if err := db.Queries.RevokeRefreshTokenFamily(context.Background(), familyID); err != nil {
+		log.Printf("Error revoking refresh token family %s: %v", familyID, err)
+	}
+}
+
+// tokenGrant describes what the tokens issued by issueTokens were granted for
+type tokenGrant struct {
+	FamilyID string
+	Scope    string
+	Nonce    string
+	AuthTime sql.NullTime
+	// Amr is the space separated list of authentication methods used to log in
+	Amr string
+	// SsoSessionID is the SSO session the user logged in with, logging out of it can revoke the tokens
+	SsoSessionID sql.NullInt64
+}
+
+func issueTokens(c *gin.Context, db *db.Db, user dbcommon.User, client dbcommon.Client, grant tokenGrant) {
+	// Generate access token, recording its jti so logging out or disabling the user can revoke it
+	jti := uuid.New().String()
+	accessToken, err := utils.GenerateJWT(utils.AccessTokenParams{
+		ID:       jti,
+		UserUUID: user.Uuid,
+		ClientID: client.Namespace,
+		Scope:    grant.Scope,
+		Amr:      strings.Fields(grant.Amr),
+	})
+	if err != nil {
+		log.Printf("Error generating JWT for user %s: %v", user.Uuid, err)
+		abortWithError(c, serverError("Failed to generate token"))
+		return
+	}
+
+	err = db.Queries.CreateAccessToken(context.Background(), dbcommon.CreateAccessTokenParams{
+		Jti:          jti,
+		UserID:       user.ID,
+		SsoSessionID: grant.SsoSessionID,
+		ExpiresAt:    time.Now().Add(utils.AccessTokenLifetime),
+	})
+	if err != nil {
+		log.Printf("Error storing access token for user %s: %v", user.Uuid, err)
+		abortWithError(c, serverError("Failed to generate token"))
+		return
+	}
+
+	// Generate and store refresh token
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating refresh token for user %s: %v", user.Uuid, err)
+		abortWithError(c, serverError("Failed to generate token"))
+		return
+	}
+
+	err = db.Queries.CreateRefreshToken(context.Background(), dbcommon.CreateRefreshTokenParams{
+		TokenHash:    utils.HashOpaqueToken(refreshToken),
+		FamilyID:     grant.FamilyID,
+		UserID:       user.ID,
+		ClientID:     client.ID,
+		Scope:        grant.Scope,
+		AuthTime:     grant.AuthTime,
+		Amr:          grant.Amr,
+		SsoSessionID: grant.SsoSessionID,
+		ExpiresAt:    time.Now().Add(utils.RefreshTokenLifetime),
+	})
+	if err != nil {
+		log.Printf("Error storing refresh token for user %s: %v", user.Uuid, err)
+		abortWithError(c, serverError("Failed to generate token"))
+		return
+	}
 
-		// 9. Return the tokens
-		c.SetCookie(
-			"token",     // name
-			accessToken, // value
-			3600,        // max age in seconds
-			"/",         // path
-			"",          // domain
-			true,        // secure (HTTPS only)
-			true,        // httpOnly
-		)
-		c.JSON(http.StatusOK, gin.H{
-			"token_type": "Bearer",
-			"expires_in": 3600,
+	sid := trackSSOSessionClient(context.Background(), db, grant.SsoSessionID, client)
+
+	response := gin.H{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(utils.AccessTokenLifetime.Seconds()),
+		"refresh_token": refreshToken,
+	}
+	if grant.Scope != "" {
+		response["scope"] = grant.Scope
+	}
+
+	// Issue an ID token when the client asked for OpenID Connect
+	if utils.HasScope(grant.Scope, "openid") {
+		idToken, err := utils.GenerateIDToken(utils.IDTokenParams{
+			Subject:       user.Uuid,
+			Audience:      client.Namespace,
+			Nonce:         grant.Nonce,
+			AuthTime:      grant.AuthTime.Time,
+			Amr:           strings.Fields(grant.Amr),
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			GivenName:     user.Firstname,
+			FamilyName:    user.Lastname,
+			SessionID:     sid,
 		})
+		if err != nil {
+			log.Printf("Error generating ID token for user %s: %v", user.Uuid, err)
+			abortWithError(c, serverError("Failed to generate token"))
+			return
+		}
+		response["id_token"] = idToken
 	}
+
+	setCookie(c, "token", accessToken, int(utils.AccessTokenLifetime.Seconds()))
+	respondWithTokens(c, response)
 }
 
 func verifyPKCE(verifier, challenge, method string) bool {
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"auth_go/db"
+	"auth_go/dbcommon"
 	"context"
 	"log"
 	"net/http"
@@ -9,6 +10,14 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// requestNamespace returns the client namespace from the Namespace header or namespace query parameter
+func requestNamespace(c *gin.Context) string {
+	if namespace := c.GetHeader("Namespace"); namespace != "" {
+		return namespace
+	}
+	return c.Query("namespace")
+}
+
 // GetUserByUUID fetches a user by their UUID
 func GetUserByUUID(db *db.Db) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -19,9 +28,16 @@ func GetUserByUUID(db *db.Db) gin.HandlerFunc {
 			return
 		}
 
-		// Fetch user from database
-		user, err := db.Queries.GetUserByUUID(context.Background(), uuid)
+		ctx := context.Background()
+		namespaceID, err := NamespaceUserPool(ctx, db, requestNamespace(c))
 		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid namespace"})
+			return
+		}
+
+		// Fetch user from database, it has to be in the namespace's user pool
+		user, err := db.Queries.GetUserByUUID(ctx, uuid)
+		if err != nil || user.NamespaceID != namespaceID {
 			log.Printf("Error fetching user by UUID %s: %v", uuid, err)
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
@@ -45,7 +61,17 @@ func GetUserByEmail(db *db.Db) gin.HandlerFunc {
 			return
 		}
 
-		user, err := db.Queries.GetUserByEmail(context.Background(), email)
+		ctx := context.Background()
+		namespaceID, err := NamespaceUserPool(ctx, db, requestNamespace(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid namespace"})
+			return
+		}
+
+		user, err := db.Queries.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{
+			NamespaceID: namespaceID,
+			Email:       email,
+		})
 		if err != nil {
 			log.Printf("Warning: fetching user by email %s: %v", email, err)
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
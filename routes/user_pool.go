@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"context"
+)
+
+const (
+	// UserPoolGlobal clients share one pool of users
+	UserPoolGlobal = "global"
+	// UserPoolNamespace clients keep users that only exist within their namespace
+	UserPoolNamespace = "namespace"
+)
+
+// globalUserPool is the namespace_id of users in the shared pool
+const globalUserPool int64 = 0
+
+// userPoolID returns the namespace_id the client's users are stored under
+func userPoolID(client dbcommon.Client) int64 {
+	if client.UserPool == UserPoolNamespace {
+		return client.ID
+	}
+	return globalUserPool
+}
+
+// NamespaceUserPool resolves the user pool of a client namespace, an empty namespace means the global pool
+func NamespaceUserPool(ctx context.Context, db *db.Db, namespace string) (int64, error) {
+	if namespace == "" {
+		return globalUserPool, nil
+	}
+
+	client, err := db.Queries.GetClientByNamespace(ctx, namespace)
+	if err != nil {
+		return 0, err
+	}
+	return userPoolID(client), nil
+}
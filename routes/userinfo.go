@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/utils"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bearerToken returns the access token from the Authorization header, falling back to the token cookie
+func bearerToken(c *gin.Context) (string, bool) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", false
+		}
+		return token, true
+	}
+
+	token, err := c.Cookie("token")
+	if err != nil || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// authenticatedUser returns the user the bearer access token was issued to, responding with 401 if there is none
+func authenticatedUser(c *gin.Context, db *db.Db) (dbcommon.User, bool) {
+	user, _, ok := authenticatedToken(c, db)
+	return user, ok
+}
+
+// authenticatedToken is authenticatedUser that also returns the claims of the access token
+func authenticatedToken(c *gin.Context, db *db.Db) (dbcommon.User, *utils.Claims, bool) {
+	token, ok := bearerToken(c)
+	if !ok {
+		abortBearerError(c, &OAuthError{Code: "invalid_request", Description: "No access token was sent", Status: http.StatusUnauthorized})
+		return dbcommon.User{}, nil, false
+	}
+
+	user, claims, err := validAccessToken(context.Background(), db, token)
+	if err != nil {
+		log.Printf("Invalid token: %v", err)
+		abortBearerError(c, invalidToken("The access token is invalid"))
+		return dbcommon.User{}, nil, false
+	}
+
+	return user, claims, true
+}
+
+// validAccessToken validates the access token and returns the user it was issued to.
+// Tokens of a user who was disabled since are rejected, disabling doesn't revoke them.
+func validAccessToken(ctx context.Context, db *db.Db, token string) (dbcommon.User, *utils.Claims, error) {
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		return dbcommon.User{}, nil, err
+	}
+
+	user, err := db.Queries.GetUserByUUID(ctx, claims.UserUUID)
+	if err != nil {
+		return dbcommon.User{}, nil, fmt.Errorf("fetching user by UUID %s: %w", claims.UserUUID, err)
+	}
+	if user.DisabledAt.Valid {
+		return dbcommon.User{}, nil, fmt.Errorf("user %s is disabled", user.Uuid)
+	}
+
+	return user, claims, nil
+}
+
+// UserInfo returns the OpenID Connect claims of the user the access token was issued to, limited
+// to the claims of the scopes the token was granted (OpenID Connect Core 1.0, section 5.4)
+func UserInfo(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, claims, ok := authenticatedToken(c, db)
+		if !ok {
+			return
+		}
+
+		info := gin.H{"sub": user.Uuid}
+		if utils.HasScope(claims.Scope, "email") {
+			info["email"] = user.Email
+			info["email_verified"] = user.EmailVerified
+		}
+		if utils.HasScope(claims.Scope, "profile") {
+			info["given_name"] = user.Firstname
+			info["family_name"] = user.Lastname
+		}
+		c.JSON(http.StatusOK, info)
+	}
+}
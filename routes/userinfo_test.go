@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUserInfoScopes(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  []string
+	}{
+		{scope: "openid", want: []string{"sub"}},
+		{scope: "openid email", want: []string{"sub", "email", "email_verified"}},
+		{scope: "openid profile", want: []string{"sub", "given_name", "family_name"}},
+		{scope: "openid profile email", want: []string{"sub", "email", "email_verified", "given_name", "family_name"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			server := newTestServer(t)
+			b := server.browser(t)
+
+			// The token endpoint leaves the access token in the token cookie
+			code := b.authorize(s256(testVerifier), "S256", tt.scope)
+			expectStatus(t, b.exchange(code, testVerifier), http.StatusOK)
+
+			resp := b.do(http.MethodGet, "/userinfo", nil)
+			expectStatus(t, resp, http.StatusOK)
+			var info map[string]any
+			decodeJSON(t, resp, &info)
+
+			if len(info) != len(tt.want) {
+				t.Errorf("got claims %v, want %v", info, tt.want)
+			}
+			for _, claim := range tt.want {
+				if _, ok := info[claim]; !ok {
+					t.Errorf("claim %s missing from %v", claim, info)
+				}
+			}
+			if info["sub"] != server.user.Uuid {
+				t.Errorf("got sub %v, want %s", info["sub"], server.user.Uuid)
+			}
+		})
+	}
+}
@@ -2,7 +2,7 @@ package routes
 
 import (
 	"auth_go/db"
-	"auth_go/utils"
+	"context"
 	"log"
 	"net/http"
 
@@ -20,13 +20,13 @@ func Validate(db *db.Db) gin.HandlerFunc {
 		}
 
 		// Validate token
-		claims, err := utils.ValidateJWT(token)
+		user, _, err := validAccessToken(context.Background(), db, token)
 		if err != nil {
 			log.Printf("Invalid token: %v", err)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"user_uuid": claims.UserUUID})
+		c.JSON(http.StatusOK, gin.H{"user_uuid": user.Uuid})
 	}
 }
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/mail"
+	"auth_go/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// verificationResendInterval is the minimum time between two verification mails to the same user
+const verificationResendInterval = 5 * time.Minute
+
+var errVerificationThrottled = errors.New("verification email sent too recently")
+
+type ResendVerificationInput struct {
+	Email     string `form:"email" binding:"required"`
+	Namespace string `form:"namespace"`
+}
+
+// sendVerificationEmail mails the user a signed link to verify their address, at most once per resend interval
+func sendVerificationEmail(ctx context.Context, db *db.Db, mailer mail.Mailer, user dbcommon.User) error {
+	// Claiming the send slot in the database throttles across all instances
+	rows, err := db.Queries.MarkVerificationSent(ctx, dbcommon.MarkVerificationSentParams{
+		ID:                 user.ID,
+		VerificationSentAt: sql.NullTime{Time: time.Now().Add(-verificationResendInterval), Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errVerificationThrottled
+	}
+
+	token, err := utils.GenerateEmailVerificationToken(user.Uuid, user.Email)
+	if err != nil {
+		return err
+	}
+
+	link := utils.Issuer() + "/verify-email?" + url.Values{"token": {token}}.Encode()
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %v.\n\n%s\n",
+			user.Firstname, utils.EmailVerificationLifetime, link),
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := mailer.Send(ctx, msg); err != nil {
+			log.Printf("Error sending verification mail to user %s: %v", user.Uuid, err)
+		}
+	}()
+
+	return nil
+}
+
+func VerifyEmail(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userUUID, email, err := utils.ValidateEmailVerificationToken(c.Query("token"))
+		if err != nil {
+			log.Printf("Invalid email verification token: %v", err)
+			c.HTML(http.StatusBadRequest, "verify_email.html", gin.H{
+				"Error": "This verification link is invalid or has expired",
+			})
+			return
+		}
+
+		ctx := context.Background()
+		user, err := db.Queries.GetUserByUUID(ctx, userUUID)
+		// The link only verifies the address it was sent to
+		if err != nil || user.Email != email {
+			log.Printf("Email verification for unknown user or changed email %s: %v", userUUID, err)
+			c.HTML(http.StatusBadRequest, "verify_email.html", gin.H{
+				"Error": "This verification link is invalid or has expired",
+			})
+			return
+		}
+
+		if err := db.Queries.SetUserEmailVerified(ctx, user.ID); err != nil {
+			log.Printf("Error verifying email for user %s: %v", user.Uuid, err)
+			c.HTML(http.StatusInternalServerError, "verify_email.html", gin.H{
+				"Error": "Failed to verify email",
+			})
+			return
+		}
+
+		c.HTML(http.StatusOK, "verify_email.html", gin.H{
+			"Message": "Your email address has been verified.",
+		})
+	}
+}
+
+func ResendVerificationEmail(db *db.Db, mailer mail.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ResendVerificationInput
+		if err := c.ShouldBind(&input); err != nil {
+			log.Printf("Error binding resend verification input: %v", err)
+			c.HTML(http.StatusBadRequest, "verify_email.html", gin.H{"Error": "Email is required"})
+			return
+		}
+
+		// Always answer the same way so the form can't be used to find out who has an account
+		sent := gin.H{"Message": "If the address needs verifying, a new verification link has been sent."}
+
+		ctx := context.Background()
+		namespaceID, err := NamespaceUserPool(ctx, db, input.Namespace)
+		if err != nil {
+			log.Printf("Error getting client by namespace %s: %v", input.Namespace, err)
+			c.HTML(http.StatusOK, "verify_email.html", sent)
+			return
+		}
+
+		user, err := db.Queries.GetUserByEmail(ctx, dbcommon.GetUserByEmailParams{
+			NamespaceID: namespaceID,
+			Email:       input.Email,
+		})
+		if err != nil || user.EmailVerified {
+			c.HTML(http.StatusOK, "verify_email.html", sent)
+			return
+		}
+
+		if err := sendVerificationEmail(ctx, db, mailer, user); err != nil {
+			log.Printf("Error resending verification email to user %s: %v", user.Uuid, err)
+		}
+
+		c.HTML(http.StatusOK, "verify_email.html", sent)
+	}
+}
@@ -0,0 +1,362 @@
+package routes
+
+import (
+	"auth_go/db"
+	"auth_go/dbcommon"
+	"auth_go/lockout"
+	"auth_go/utils"
+	"auth_go/webauthn"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webauthnTimeout bounds how long a ceremony may take, in the browser and for its stored challenge
+const webauthnTimeout = 5 * time.Minute
+
+const (
+	ceremonyRegistration   = "registration"
+	ceremonyAuthentication = "authentication"
+)
+
+var errInvalidChallenge = errors.New("unknown or expired webauthn challenge")
+
+type WebAuthnRegistrationInput struct {
+	Name       string                          `json:"name"`
+	Credential webauthn.RegistrationCredential `json:"credential" binding:"required"`
+}
+
+// relyingParty describes this service to authenticators, credentials are scoped to the issuer's host
+func relyingParty() webauthn.RelyingParty {
+	u, err := url.Parse(utils.Issuer())
+	if err != nil {
+		return webauthn.RelyingParty{}
+	}
+	return webauthn.RelyingParty{
+		ID:     u.Hostname(),
+		Name:   u.Host,
+		Origin: u.Scheme + "://" + u.Host,
+	}
+}
+
+// newWebAuthnChallenge creates and stores the challenge for a ceremony, optionally bound to a user
+func newWebAuthnChallenge(ctx context.Context, db *db.Db, ceremony string, userID sql.NullInt64) ([]byte, error) {
+	// Abandoned ceremonies leave their challenges behind
+	if err := db.Queries.DeleteExpiredWebAuthnChallenges(ctx); err != nil {
+		log.Printf("Error deleting expired webauthn challenges: %v", err)
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Queries.CreateWebAuthnChallenge(ctx, dbcommon.CreateWebAuthnChallengeParams{
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Ceremony:  ceremony,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(webauthnTimeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge looks up the challenge a response was created for and deletes it so it can only be used once
+func consumeWebAuthnChallenge(ctx context.Context, db *db.Db, clientDataJSON []byte, ceremony string) (dbcommon.WebauthnChallenge, []byte, error) {
+	challenge, err := webauthn.ClientDataChallenge(clientDataJSON)
+	if err != nil {
+		return dbcommon.WebauthnChallenge{}, nil, err
+	}
+
+	stored, err := db.Queries.GetWebAuthnChallenge(ctx, base64.RawURLEncoding.EncodeToString(challenge))
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbcommon.WebauthnChallenge{}, nil, errInvalidChallenge
+	}
+	if err != nil {
+		return dbcommon.WebauthnChallenge{}, nil, err
+	}
+	if stored.Ceremony != ceremony || time.Now().After(stored.ExpiresAt) {
+		return dbcommon.WebauthnChallenge{}, nil, errInvalidChallenge
+	}
+
+	// Claim the challenge, a concurrent request may have used it already
+	rows, err := db.Queries.DeleteWebAuthnChallenge(ctx, stored.ID)
+	if err != nil {
+		return dbcommon.WebauthnChallenge{}, nil, err
+	}
+	if rows == 0 {
+		return dbcommon.WebauthnChallenge{}, nil, errInvalidChallenge
+	}
+
+	return stored, challenge, nil
+}
+
+// credentialDescriptors lists stored credentials the way authenticators expect them
+func credentialDescriptors(credentials []dbcommon.WebauthnCredential) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.CredentialID,
+			Transports: strings.Fields(credential.Transports),
+		})
+	}
+	return descriptors
+}
+
+// BeginWebAuthnRegistration starts registering a security key or passkey for the user the access token was issued to
+func BeginWebAuthnRegistration(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := authenticatedUser(c, db)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		credentials, err := db.Queries.ListWebAuthnCredentialsByUserID(ctx, user.ID)
+		if err != nil {
+			log.Printf("Error listing webauthn credentials for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+			return
+		}
+
+		challenge, err := newWebAuthnChallenge(ctx, db, ceremonyRegistration, sql.NullInt64{Int64: user.ID, Valid: true})
+		if err != nil {
+			log.Printf("Error creating webauthn challenge: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+			return
+		}
+
+		options := relyingParty().CreationOptions(webauthn.UserEntity{
+			ID:          []byte(user.Uuid),
+			Name:        user.Email,
+			DisplayName: strings.TrimSpace(user.Firstname + " " + user.Lastname),
+		}, challenge, webauthnTimeout, credentialDescriptors(credentials))
+
+		c.JSON(http.StatusOK, gin.H{"publicKey": options})
+	}
+}
+
+// FinishWebAuthnRegistration verifies the authenticator's response and stores the new credential
+func FinishWebAuthnRegistration(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := authenticatedUser(c, db)
+		if !ok {
+			return
+		}
+
+		var input WebAuthnRegistrationInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			log.Printf("Error binding webauthn registration input: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		ctx := context.Background()
+		stored, challenge, err := consumeWebAuthnChallenge(ctx, db, input.Credential.Response.ClientDataJSON, ceremonyRegistration)
+		if err != nil || stored.UserID.Int64 != user.ID {
+			log.Printf("Invalid webauthn registration challenge for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Registration expired, please try again"})
+			return
+		}
+
+		credential, err := relyingParty().VerifyRegistration(challenge, input.Credential, false)
+		if err != nil {
+			log.Printf("Error verifying webauthn registration for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to verify security key"})
+			return
+		}
+
+		err = db.Queries.CreateWebAuthnCredential(ctx, dbcommon.CreateWebAuthnCredentialParams{
+			UserID:            user.ID,
+			CredentialID:      credential.ID,
+			PublicKey:         credential.PublicKey,
+			SignCount:         int64(credential.SignCount),
+			Aaguid:            credential.AAGUID,
+			AttestationFormat: credential.AttestationFormat,
+			Transports:        strings.Join(input.Credential.Response.Transports, " "),
+			Name:              input.Name,
+		})
+		if err != nil {
+			log.Printf("Error storing webauthn credential for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to store security key"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": base64.RawURLEncoding.EncodeToString(credential.ID)})
+	}
+}
+
+// BeginWebAuthnLogin starts an assertion for the authorization request in the auth_code cookie.
+// After a password it asks for one of the user's security keys, otherwise for any passkey.
+func BeginWebAuthnLogin(db *db.Db) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authCode, err := c.Cookie("auth_code")
+		if err != nil {
+			log.Printf("Error getting auth code from cookie: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No authorization code found"})
+			return
+		}
+
+		ctx := context.Background()
+		authSession, err := db.Queries.GetSessionByAuthCode(ctx, authCode)
+		if err != nil {
+			log.Printf("Error getting session by auth code: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization code"})
+			return
+		}
+
+		// Passkeys have to verify the user themselves, as there is no password
+		var allow []webauthn.CredentialDescriptor
+		userVerification := "required"
+		if authSession.MfaUserID.Valid {
+			credentials, err := db.Queries.ListWebAuthnCredentialsByUserID(ctx, authSession.MfaUserID.Int64)
+			if err != nil {
+				log.Printf("Error listing webauthn credentials for user %d: %v", authSession.MfaUserID.Int64, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+				return
+			}
+			allow = credentialDescriptors(credentials)
+			userVerification = "discouraged"
+		}
+
+		challenge, err := newWebAuthnChallenge(ctx, db, ceremonyAuthentication, authSession.MfaUserID)
+		if err != nil {
+			log.Printf("Error creating webauthn challenge: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+
+		options := relyingParty().RequestOptions(challenge, webauthnTimeout, allow, userVerification)
+		c.JSON(http.StatusOK, gin.H{"publicKey": options})
+	}
+}
+
+// FinishWebAuthnLogin verifies the assertion and logs the user into the authorization request
+func FinishWebAuthnLogin(db *db.Db, guard *lockout.Guard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input webauthn.AssertionCredential
+		if err := c.ShouldBindJSON(&input); err != nil {
+			log.Printf("Error binding webauthn assertion: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		authCode, err := c.Cookie("auth_code")
+		if err != nil {
+			log.Printf("Error getting auth code from cookie: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No authorization code found"})
+			return
+		}
+
+		ctx := context.Background()
+		authSession, err := db.Queries.GetSessionByAuthCode(ctx, authCode)
+		if err != nil {
+			log.Printf("Error getting session by auth code: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization code"})
+			return
+		}
+
+		client, err := db.Queries.GetClientByID(ctx, authSession.ClientID)
+		if err != nil {
+			log.Printf("Error getting client by ID: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client"})
+			return
+		}
+
+		stored, challenge, err := consumeWebAuthnChallenge(ctx, db, input.Response.ClientDataJSON, ceremonyAuthentication)
+		if err != nil {
+			log.Printf("Invalid webauthn login challenge: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Login expired, please try again"})
+			return
+		}
+
+		credential, err := db.Queries.GetWebAuthnCredentialByCredentialID(ctx, input.ID)
+		if err != nil {
+			log.Printf("Error getting webauthn credential: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown security key"})
+			return
+		}
+
+		user, err := db.Queries.GetUserByID(ctx, credential.UserID)
+		if err != nil {
+			log.Printf("Error getting user %d: %v", credential.UserID, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown security key"})
+			return
+		}
+
+		// A second factor must belong to the user who entered the password, a passkey to the client's user pool
+		secondFactor := stored.UserID.Valid
+		if secondFactor && (stored.UserID.Int64 != user.ID || authSession.MfaUserID.Int64 != user.ID) {
+			log.Printf("Security key of user %s used for another user's login", user.Uuid)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown security key"})
+			return
+		}
+		if !secondFactor && (user.NamespaceID != userPoolID(client) ||
+			(len(input.Response.UserHandle) > 0 && string(input.Response.UserHandle) != user.Uuid)) {
+			log.Printf("Passkey of user %s is not valid for client %s", user.Uuid, client.Namespace)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown security key"})
+			return
+		}
+
+		// A lockout covers every way of logging in, not just the password form
+		if wait := loginWait(guard, user); wait > 0 {
+			abortLoginThrottled(c, user, wait)
+			return
+		}
+
+		assertion, err := relyingParty().VerifyAssertion(challenge, input, credential.PublicKey, uint32(credential.SignCount), !secondFactor)
+		if err != nil {
+			log.Printf("Error verifying webauthn assertion for user %s: %v", user.Uuid, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to verify security key"})
+			return
+		}
+
+		// Same order as the password login, refused accounts leave the credential untouched
+		if user.DisabledAt.Valid {
+			log.Printf("Login refused for disabled user: %s", user.Uuid)
+			c.JSON(http.StatusForbidden, gin.H{"error": "This account has been disabled"})
+			return
+		}
+
+		if client.RequireEmailVerification && !user.EmailVerified {
+			log.Printf("Login blocked until email is verified for user: %s", user.Uuid)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before logging in"})
+			return
+		}
+
+		err = db.Queries.UpdateWebAuthnSignCount(ctx, dbcommon.UpdateWebAuthnSignCountParams{
+			SignCount: int64(assertion.SignCount),
+			ID:        credential.ID,
+		})
+		if err != nil {
+			log.Printf("Error updating webauthn sign count: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+			return
+		}
+
+		amr := amrHardwareKey + " " + amrMFA
+		if secondFactor {
+			amr = fmt.Sprintf("%s %s %s", amrPassword, amrHardwareKey, amrMFA)
+		}
+		if err := completeLogin(ctx, c, db, authCode, user.ID, amr); err != nil {
+			log.Printf("Error updating user session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+			return
+		}
+		clearLoginFailures(ctx, db, user)
+
+		c.JSON(http.StatusOK, gin.H{"redirect": authorizeURL(client.Namespace, authSession)})
+	}
+}
@@ -0,0 +1,161 @@
+package routes
+
+import (
+	"auth_go/dbcommon"
+	"auth_go/webauthn"
+	"auth_go/webauthn/webauthntest"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// registerPasskey registers a passkey for the logged in user of the browser, whose token cookie holds an access token
+func (b *browser) registerPasskey() *webauthntest.Authenticator {
+	b.t.Helper()
+
+	resp := b.doJSON("/webauthn/register/begin", nil)
+	expectStatus(b.t, resp, http.StatusOK)
+	var begin struct {
+		PublicKey webauthn.CreationOptions `json:"publicKey"`
+	}
+	decodeJSON(b.t, resp, &begin)
+
+	authenticator, err := webauthntest.New(webauthn.AlgES256)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	credential, err := authenticator.Register(relyingParty(), begin.PublicKey.Challenge, "packed")
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	expectStatus(b.t, b.doJSON("/webauthn/register/finish", WebAuthnRegistrationInput{
+		Name:       "laptop",
+		Credential: credential,
+	}), http.StatusCreated)
+	return authenticator
+}
+
+// passkeyLogin answers the passkey login of the authorization request the browser is in, returning the response
+func (b *browser) passkeyLogin(authenticator *webauthntest.Authenticator, userHandle string) *http.Response {
+	b.t.Helper()
+
+	resp := b.doJSON("/login/webauthn/begin", nil)
+	expectStatus(b.t, resp, http.StatusOK)
+	var begin struct {
+		PublicKey webauthn.RequestOptions `json:"publicKey"`
+	}
+	decodeJSON(b.t, resp, &begin)
+	if begin.PublicKey.UserVerification != "required" {
+		b.t.Errorf("passkey login asks for user verification %q, want required", begin.PublicKey.UserVerification)
+	}
+
+	assertion, err := authenticator.Assert(relyingParty(), begin.PublicKey.Challenge, []byte(userHandle))
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return b.doJSON("/login/webauthn/finish", assertion)
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	server := newTestServer(t)
+	owner := server.browser(t)
+	owner.login()
+	authenticator := owner.registerPasskey()
+
+	// A browser without the SSO session logs in with the passkey alone
+	b := server.browser(t)
+	b.startLogin()
+	resp := b.passkeyLogin(authenticator, server.user.Uuid)
+	expectStatus(t, resp, http.StatusOK)
+	var finish struct {
+		Redirect string `json:"redirect"`
+	}
+	decodeJSON(t, resp, &finish)
+
+	location := b.expectRedirect(b.do(http.MethodGet, finish.Redirect, nil))
+	code := expectClientRedirect(t, location).Get("code")
+	resp = b.exchange(code, testVerifier)
+	expectStatus(t, resp, http.StatusOK)
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	decodeJSON(t, resp, &tokens)
+	claims, _ := unverifiedClaims(t, tokens.AccessToken)
+	if amr := fmt.Sprint(claims["amr"]); amr != fmt.Sprint([]string{amrHardwareKey, amrMFA}) {
+		t.Errorf("got amr %s, want [%s %s]", amr, amrHardwareKey, amrMFA)
+	}
+
+	credential, err := server.store.GetWebAuthnCredentialByCredentialID(context.Background(), authenticator.CredentialID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.SignCount != int64(authenticator.SignCount) {
+		t.Errorf("stored sign count %d, want %d", credential.SignCount, authenticator.SignCount)
+	}
+}
+
+func TestPasskeyLoginDisabledUser(t *testing.T) {
+	server := newTestServer(t)
+	owner := server.browser(t)
+	owner.login()
+	authenticator := owner.registerPasskey()
+
+	if err := server.store.DisableUser(context.Background(), server.user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	b := server.browser(t)
+	b.startLogin()
+	expectStatus(t, b.passkeyLogin(authenticator, server.user.Uuid), http.StatusForbidden)
+
+	// The refused login must not advance the counter stored for the credential
+	credential, err := server.store.GetWebAuthnCredentialByCredentialID(context.Background(), authenticator.CredentialID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.SignCount != 0 {
+		t.Errorf("stored sign count %d after a refused login, want 0", credential.SignCount)
+	}
+
+	query := authorizeQuery(s256(testVerifier), "S256", "")
+	location := b.expectRedirect(b.do(http.MethodGet, "/authorize?"+query.Encode(), nil))
+	if location.Path != "/login" {
+		t.Errorf("authorize redirected to %s after a refused passkey login, want /login", location)
+	}
+}
+
+func TestPasskeyLoginLockedUser(t *testing.T) {
+	server := newTestServer(t)
+	owner := server.browser(t)
+	owner.login()
+	authenticator := owner.registerPasskey()
+
+	now := time.Now()
+	_, err := server.store.LockUser(context.Background(), dbcommon.LockUserParams{
+		LockedUntil:   sql.NullTime{Time: now.Add(time.Minute), Valid: true},
+		ID:            server.user.ID,
+		LockedUntil_2: sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := server.browser(t)
+	b.startLogin()
+	resp := b.passkeyLogin(authenticator, server.user.Uuid)
+	expectStatus(t, resp, http.StatusTooManyRequests)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("the locked login has no Retry-After header")
+	}
+
+	credential, err := server.store.GetWebAuthnCredentialByCredentialID(context.Background(), authenticator.CredentialID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.SignCount != 0 {
+		t.Errorf("stored sign count %d after a refused login, want 0", credential.SignCount)
+	}
+}
@@ -0,0 +1,88 @@
+// WebAuthn ceremonies for the login pages. The server exchanges binary fields as base64url strings.
+
+function base64urlToBuffer(value) {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    const padded = base64 + '='.repeat((4 - base64.length % 4) % 4);
+    return Uint8Array.from(atob(padded), c => c.charCodeAt(0)).buffer;
+}
+
+function bufferToBase64url(buffer) {
+    const bytes = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(bytes).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+async function postJSON(url, body, headers) {
+    const response = await fetch(url, {
+        method: 'POST',
+        credentials: 'same-origin',
+        headers: Object.assign({'Content-Type': 'application/json'}, headers || {}),
+        body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const result = await response.json();
+    if (!response.ok) {
+        throw new Error(result.error || 'Request failed');
+    }
+    return result;
+}
+
+// webauthnLogin signs in with a passkey, or with a security key as the second factor after a password
+async function webauthnLogin() {
+    const {publicKey} = await postJSON('/login/webauthn/begin');
+    publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+    publicKey.allowCredentials = publicKey.allowCredentials.map(c => Object.assign({}, c, {id: base64urlToBuffer(c.id)}));
+
+    const credential = await navigator.credentials.get({publicKey});
+    const response = credential.response;
+    const result = await postJSON('/login/webauthn/finish', {
+        rawId: bufferToBase64url(credential.rawId),
+        type: credential.type,
+        response: {
+            clientDataJSON: bufferToBase64url(response.clientDataJSON),
+            authenticatorData: bufferToBase64url(response.authenticatorData),
+            signature: bufferToBase64url(response.signature),
+            userHandle: response.userHandle ? bufferToBase64url(response.userHandle) : undefined,
+        },
+    });
+    window.location = result.redirect;
+}
+
+// webauthnRegister adds a security key or passkey to the account the access token belongs to
+async function webauthnRegister(accessToken, name) {
+    const auth = {'Authorization': 'Bearer ' + accessToken};
+    const {publicKey} = await postJSON('/webauthn/register/begin', undefined, auth);
+    publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+    publicKey.user.id = base64urlToBuffer(publicKey.user.id);
+    publicKey.excludeCredentials = publicKey.excludeCredentials.map(c => Object.assign({}, c, {id: base64urlToBuffer(c.id)}));
+
+    const credential = await navigator.credentials.create({publicKey});
+    const response = credential.response;
+    return postJSON('/webauthn/register/finish', {
+        name: name,
+        credential: {
+            rawId: bufferToBase64url(credential.rawId),
+            type: credential.type,
+            response: {
+                clientDataJSON: bufferToBase64url(response.clientDataJSON),
+                attestationObject: bufferToBase64url(response.attestationObject),
+                transports: response.getTransports ? response.getTransports() : [],
+            },
+        },
+    }, auth);
+}
+
+// bindWebAuthnButton runs the login ceremony when the button is clicked, showing failures in errorElement
+function bindWebAuthnButton(button, errorElement) {
+    if (!window.PublicKeyCredential) {
+        button.style.display = 'none';
+        return;
+    }
+    button.addEventListener('click', async () => {
+        errorElement.style.display = 'none';
+        try {
+            await webauthnLogin();
+        } catch (err) {
+            errorElement.textContent = err.message;
+            errorElement.style.display = 'block';
+        }
+    });
+}
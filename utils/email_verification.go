@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EmailVerificationLifetime is how long an email verification link is valid
+var EmailVerificationLifetime = time.Hour * 24
+
+const emailVerificationPurpose = "verify_email"
+
+var ErrInvalidVerificationToken = errors.New("invalid email verification token")
+
+type emailVerificationClaims struct {
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GenerateEmailVerificationToken signs a token proving the link was sent to email for the user
+func GenerateEmailVerificationToken(userUUID, email string) (string, error) {
+	now := time.Now()
+	return signJWT(jwt.MapClaims{
+		"iss":     Issuer(),
+		"sub":     userUUID,
+		"email":   email,
+		"purpose": emailVerificationPurpose,
+		"iat":     now.Unix(),
+		"exp":     now.Add(EmailVerificationLifetime).Unix(),
+	})
+}
+
+// ValidateEmailVerificationToken returns the user UUID and email a verification token was issued for
+func ValidateEmailVerificationToken(tokenString string) (string, string, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &emailVerificationClaims{}, verificationKey,
+		jwt.WithValidMethods(SupportedSigningAlgorithms))
+	if err != nil {
+		return "", "", err
+	}
+
+	claims, ok := token.Claims.(*emailVerificationClaims)
+	if !ok || !token.Valid || claims.Purpose != emailVerificationPurpose {
+		return "", "", ErrInvalidVerificationToken
+	}
+
+	return claims.Subject, claims.Email, nil
+}
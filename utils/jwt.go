@@ -2,58 +2,285 @@ package utils
 
 import (
 	"fmt"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-func getJWTSecret() ([]byte, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return nil, fmt.Errorf("JWT_SECRET environment variable is not set")
+// signJWT signs the claims with the active signing key, recording its kid in the header
+func signJWT(claims jwt.Claims) (string, error) {
+	return signTypedJWT(claims, "")
+}
+
+// signTypedJWT is signJWT with an explicit typ header, for tokens that mustn't be mistaken for others
+func signTypedJWT(claims jwt.Claims, typ string) (string, error) {
+	key, err := activeSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.Kid
+	if typ != "" {
+		token.Header["typ"] = typ
 	}
-	return []byte(secret), nil
+
+	return token.SignedString(key.Signer)
+}
+
+// verificationKey selects the public key for a token by its kid header
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, fmt.Errorf("token has no kid header")
+	}
+
+	key, ok := lookupSigningKey(kid)
+	if !ok {
+		return nil, ErrUnknownSigningKey
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("token algorithm %s does not match key %s", token.Method.Alg(), kid)
+	}
+
+	return key.Signer.Public(), nil
+}
+
+var issuer = "http://localhost:8080"
+
+// SetIssuer sets the OpenID Connect issuer identifier, the public base URL of this service
+func SetIssuer(issuerURL string) {
+	issuer = strings.TrimSuffix(issuerURL, "/")
+}
+
+// Issuer returns the OpenID Connect issuer identifier of this service
+func Issuer() string {
+	return issuer
+}
+
+// TokenLifetimes configures how long issued tokens and links stay valid
+type TokenLifetimes struct {
+	Access            time.Duration
+	ID                time.Duration
+	Refresh           time.Duration
+	EmailVerification time.Duration
+	PasswordReset     time.Duration
+}
+
+var (
+	// AccessTokenLifetime is how long an issued access token is valid
+	AccessTokenLifetime = time.Hour * 24
+
+	// IDTokenLifetime is how long an issued ID token is valid
+	IDTokenLifetime = time.Hour
+
+	// RefreshTokenLifetime is how long an issued refresh token can be exchanged
+	RefreshTokenLifetime = time.Hour * 24 * 30
+)
+
+// SetTokenLifetimes replaces the default lifetimes, it must be called before any token is issued
+func SetTokenLifetimes(l TokenLifetimes) {
+	AccessTokenLifetime = l.Access
+	IDTokenLifetime = l.ID
+	RefreshTokenLifetime = l.Refresh
+	EmailVerificationLifetime = l.EmailVerification
+	PasswordResetLifetime = l.PasswordReset
 }
 
 type Claims struct {
-	UserUUID string `json:"user_uuid"`
+	UserUUID string `json:"user_uuid,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// Amr lists the authentication methods (RFC 8176) used when the user logged in
+	Amr []string `json:"amr,omitempty"`
+	// Purpose is only set on single use tokens such as email verification links
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userUUID string) (string, error) {
-	secret, err := getJWTSecret()
-	if err != nil {
-		return "", err
+type AccessTokenParams struct {
+	// ID is the jti, a random one is used when empty. Callers that want to revoke the token later set it.
+	ID string
+	// UserUUID is empty for tokens issued to a client on its own behalf
+	UserUUID string
+	ClientID string
+	Scope    string
+	Amr      []string
+}
+
+// accessTokenType is the typ header of access tokens (RFC 9068, section 2.1), ValidateJWT accepts nothing else
+const accessTokenType = "at+jwt"
+
+func GenerateJWT(params AccessTokenParams) (string, error) {
+	subject := params.UserUUID
+	if subject == "" {
+		subject = params.ClientID
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_uuid": userUUID,
-		"exp":       time.Now().Add(time.Hour * 24).Unix(),
-	})
+	jti := params.ID
+	if jti == "" {
+		jti = uuid.New().String()
+	}
 
-	return token.SignedString(secret)
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"jti":       jti,
+		"sub":       subject,
+		"aud":       params.ClientID,
+		"client_id": params.ClientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(AccessTokenLifetime).Unix(),
+	}
+	if params.UserUUID != "" {
+		claims["user_uuid"] = params.UserUUID
+	}
+	if params.Scope != "" {
+		claims["scope"] = params.Scope
+	}
+	if len(params.Amr) > 0 {
+		claims["amr"] = params.Amr
+	}
+
+	return signTypedJWT(claims, accessTokenType)
+}
+
+type IDTokenParams struct {
+	Subject       string
+	Audience      string
+	Nonce         string
+	AuthTime      time.Time
+	Amr           []string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	// SessionID is the sid of the SSO session the user logged in with, empty without one
+	SessionID string
+}
+
+// GenerateIDToken creates a signed OpenID Connect ID token
+func GenerateIDToken(params IDTokenParams) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            Issuer(),
+		"sub":            params.Subject,
+		"aud":            params.Audience,
+		"iat":            now.Unix(),
+		"exp":            now.Add(IDTokenLifetime).Unix(),
+		"email":          params.Email,
+		"email_verified": params.EmailVerified,
+		"given_name":     params.GivenName,
+		"family_name":    params.FamilyName,
+	}
+	if params.Nonce != "" {
+		claims["nonce"] = params.Nonce
+	}
+	if !params.AuthTime.IsZero() {
+		claims["auth_time"] = params.AuthTime.Unix()
+	}
+	if len(params.Amr) > 0 {
+		claims["amr"] = params.Amr
+	}
+	if params.SessionID != "" {
+		claims["sid"] = params.SessionID
+	}
+
+	return signJWT(claims)
+}
+
+// LogoutTokenLifetime is how long a back-channel logout token is accepted by clients
+const LogoutTokenLifetime = 2 * time.Minute
+
+// backchannelLogoutEvent identifies a logout token (OpenID Connect Back-Channel Logout 1.0, section 2.4)
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// logoutTokenType is the typ header of logout tokens, no other token is accepted with it
+const logoutTokenType = "logout+jwt"
+
+type LogoutTokenParams struct {
+	Subject   string
+	Audience  string
+	SessionID string
+}
+
+// GenerateLogoutToken creates the signed logout token posted to a client's back-channel logout URI
+func GenerateLogoutToken(params LogoutTokenParams) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":    Issuer(),
+		"sub":    params.Subject,
+		"aud":    params.Audience,
+		"iat":    now.Unix(),
+		"exp":    now.Add(LogoutTokenLifetime).Unix(),
+		"jti":    uuid.New().String(),
+		"events": map[string]any{backchannelLogoutEvent: map[string]any{}},
+	}
+	if params.SessionID != "" {
+		claims["sid"] = params.SessionID
+	}
+
+	return signTypedJWT(claims, logoutTokenType)
 }
 
 func ValidateJWT(tokenString string) (*Claims, error) {
-	secret, err := getJWTSecret()
+	// Parse the token
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, verificationKey,
+		jwt.WithValidMethods(SupportedSigningAlgorithms), jwt.WithExpirationRequired())
+
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse the token
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
-	})
+	// Validate the token
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	// ID tokens, logout tokens and single use tokens are signed with the same keys, only access
+	// tokens carry their type, and without a jti a token couldn't be revoked
+	if token.Header["typ"] != accessTokenType || claims.Purpose != "" || claims.ID == "" {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
 
+	// Reject tokens that were revoked before they expired
+	revoked, err := isRevoked(claims.ID, claims.ExpiresAt.Time)
 	if err != nil {
 		return nil, err
 	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
 
-	// Validate the token
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	return claims, nil
+}
+
+// ParseIDTokenHint verifies the signature of an ID token this service issued, such as the
+// id_token_hint of a logout request, accepting it after it expired (OpenID Connect RP-Initiated Logout 1.0, section 2)
+func ParseIDTokenHint(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods(SupportedSigningAlgorithms), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	// Access tokens have no issuer, single use tokens have a purpose but no audience
+	// and logout tokens, which look like ID tokens otherwise, have their own type
+	if typ := token.Header["typ"]; typ == logoutTokenType || typ == accessTokenType || claims.Issuer != Issuer() || claims.Purpose != "" || claims.Subject == "" || len(claims.Audience) == 0 {
+		return nil, jwt.ErrTokenInvalidClaims
 	}
 
-	return nil, jwt.ErrSignatureInvalid
+	return claims, nil
 }
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoSigningKey       = errors.New("no active signing key")
+	ErrUnknownSigningKey  = errors.New("unknown signing key")
+	ErrUnsupportedKeyType = errors.New("unsupported signing key type")
+)
+
+// SupportedSigningAlgorithms lists the JWS algorithms keys can be generated for
+var SupportedSigningAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+type SigningKey struct {
+	Kid       string
+	Algorithm string
+	Signer    crypto.Signer
+}
+
+type keySet struct {
+	mu           sync.RWMutex
+	active       *SigningKey
+	keys         map[string]SigningKey
+	onUnknownKid func()
+}
+
+var keys = &keySet{keys: map[string]SigningKey{}}
+
+// SetSigningKeys replaces the keys used to sign and verify tokens.
+// active signs new tokens, verify holds every key whose tokens are still accepted.
+func SetSigningKeys(active *SigningKey, verify []SigningKey) {
+	m := make(map[string]SigningKey, len(verify))
+	for _, key := range verify {
+		m[key.Kid] = key
+	}
+	if active != nil {
+		m[active.Kid] = *active
+	}
+
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	keys.active = active
+	keys.keys = m
+}
+
+// SetUnknownKeyHandler registers a callback invoked when a token references a kid we don't know,
+// so keys created by other instances can be picked up without waiting for the next reload.
+func SetUnknownKeyHandler(handler func()) {
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	keys.onUnknownKid = handler
+}
+
+func activeSigningKey() (*SigningKey, error) {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	if keys.active == nil {
+		return nil, ErrNoSigningKey
+	}
+	return keys.active, nil
+}
+
+func lookupSigningKey(kid string) (SigningKey, bool) {
+	keys.mu.RLock()
+	key, ok := keys.keys[kid]
+	handler := keys.onUnknownKid
+	keys.mu.RUnlock()
+	if ok || handler == nil {
+		return key, ok
+	}
+
+	handler()
+
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	key, ok = keys.keys[kid]
+	return key, ok
+}
+
+// SigningAlgorithms returns the algorithms of all keys currently accepted
+func SigningAlgorithms() []string {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range keys.keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algs = append(algs, key.Algorithm)
+		}
+	}
+	return algs
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case "RS256":
+		return jwt.SigningMethodRS256, nil
+	case "ES256":
+		return jwt.SigningMethodES256, nil
+	case "EdDSA":
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// GenerateSigningKey creates a new private key for the given JWS algorithm
+func GenerateSigningKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case "RS256":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// GenerateKeyID returns a random identifier for the kid header
+func GenerateKeyID() (string, error) {
+	b, err := generateRandomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// EncodeSigningKey encodes a private key as PKCS#8 PEM for storage
+func EncodeSigningKey(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// DecodeSigningKey parses a private key encoded by EncodeSigningKey
+func DecodeSigningKey(encoded string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKeyType
+	}
+	return signer, nil
+}
+
+// JSONWebKey is the public part of a signing key as described in RFC 7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet returns the public keys of every key currently accepted
+func JSONWebKeySet() []JSONWebKey {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+
+	jwks := []JSONWebKey{}
+	for _, key := range keys.keys {
+		jwk, err := publicJWK(key)
+		if err != nil {
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+func publicJWK(key SigningKey) (JSONWebKey, error) {
+	jwk := JSONWebKey{Kid: key.Kid, Use: "sig", Alg: key.Algorithm}
+	b64 := base64.RawURLEncoding
+
+	switch pub := key.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64.EncodeToString(pub.N.Bytes())
+		jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdh, err := pub.ECDH()
+		if err != nil {
+			return jwk, err
+		}
+		// Uncompressed point: 0x04 || X || Y
+		point := ecdh.Bytes()
+		size := (len(point) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = b64.EncodeToString(point[1 : 1+size])
+		jwk.Y = b64.EncodeToString(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64.EncodeToString(pub)
+	default:
+		return jwk, ErrUnsupportedKeyType
+	}
+
+	return jwk, nil
+}
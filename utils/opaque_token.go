@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// PasswordResetLifetime is how long a password reset link can be used
+var PasswordResetLifetime = time.Hour
+
+// GenerateOpaqueToken returns a new random token, used for refresh and password reset tokens
+func GenerateOpaqueToken() (string, error) {
+	b, err := generateRandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashOpaqueToken returns the hex encoded SHA-256 hash that is stored in place of the token.
+// Opaque tokens are random and long enough that a fast hash is sufficient.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
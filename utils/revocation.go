@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationCacheTTL is how long a token found not to be revoked is trusted before the store is asked again.
+// A revocation made on another instance takes effect within this window.
+const RevocationCacheTTL = 5 * time.Second
+
+// revocationSweepInterval is how often expired entries are dropped from the cache
+const revocationSweepInterval = time.Minute
+
+// RevocationStore reports whether a token, identified by its jti, has been revoked
+type RevocationStore interface {
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type revocationEntry struct {
+	revoked bool
+	// until is when the entry must be checked against the store again
+	until time.Time
+}
+
+type revocationCache struct {
+	mu        sync.Mutex
+	store     RevocationStore
+	entries   map[string]revocationEntry
+	lastSweep time.Time
+}
+
+var revocations = &revocationCache{entries: map[string]revocationEntry{}}
+
+// SetRevocationStore sets the store ValidateJWT consults for revoked tokens
+func SetRevocationStore(store RevocationStore) {
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+	revocations.store = store
+	revocations.entries = map[string]revocationEntry{}
+}
+
+// MarkRevoked records a revocation made by this instance so it takes effect immediately
+func MarkRevoked(jti string, expiresAt time.Time) {
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+	revocations.entries[jti] = revocationEntry{revoked: true, until: expiresAt}
+}
+
+// isRevoked checks the cache before falling back to the revocation store
+func isRevoked(jti string, expiresAt time.Time) (bool, error) {
+	now := time.Now()
+
+	revocations.mu.Lock()
+	revocations.sweep(now)
+	entry, ok := revocations.entries[jti]
+	store := revocations.store
+	revocations.mu.Unlock()
+
+	if ok && now.Before(entry.until) {
+		return entry.revoked, nil
+	}
+	if store == nil {
+		return false, nil
+	}
+
+	revoked, err := store.IsTokenRevoked(context.Background(), jti)
+	if err != nil {
+		return false, err
+	}
+
+	entry = revocationEntry{revoked: revoked, until: now.Add(RevocationCacheTTL)}
+	if revoked {
+		// A revoked token stays revoked, no need to ask again before it expires
+		entry.until = expiresAt
+	}
+
+	revocations.mu.Lock()
+	revocations.entries[jti] = entry
+	revocations.mu.Unlock()
+
+	return revoked, nil
+}
+
+// sweep drops stale entries, callers must hold mu
+func (r *revocationCache) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < revocationSweepInterval {
+		return
+	}
+	for jti, entry := range r.entries {
+		if now.After(entry.until) {
+			delete(r.entries, jti)
+		}
+	}
+	r.lastSweep = now
+}
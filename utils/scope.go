@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+)
+
+// ParseScope splits a space separated scope string into its unique scope values
+func ParseScope(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// HasScope reports whether the space separated scope string contains want
+func HasScope(scope, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
+
+// ScopeSubset reports whether every scope in requested is also in allowed
+func ScopeSubset(requested, allowed string) bool {
+	allowedScopes := strings.Fields(allowed)
+	for _, s := range strings.Fields(requested) {
+		if !slices.Contains(allowedScopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeScopes returns the union of both scope strings
+func MergeScopes(a, b string) string {
+	return strings.Join(ParseScope(a+" "+b), " ")
+}
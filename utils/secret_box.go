@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"sync"
+)
+
+var ErrNoSecretKey = errors.New("no secret encryption key configured")
+
+var (
+	secretAEADMu sync.RWMutex
+	secretAEAD   cipher.AEAD
+)
+
+// SetSecretKey configures the AES-256 key used to encrypt secrets stored in the database, such as TOTP seeds
+func SetSecretKey(key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	secretAEADMu.Lock()
+	secretAEAD = aead
+	secretAEADMu.Unlock()
+	return nil
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	secretAEADMu.RLock()
+	defer secretAEADMu.RUnlock()
+	if secretAEAD == nil {
+		return nil, ErrNoSecretKey
+	}
+	return secretAEAD, nil
+}
+
+// EncryptSecret encrypts plaintext with AES-GCM, returning the base64 encoded nonce and ciphertext
+func EncryptSecret(plaintext string) (string, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := generateRandomBytes(uint32(aead.NonceSize()))
+	if err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret
+func DecryptSecret(encoded string) (string, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -1,7 +1,70 @@
 package utils
 
 import (
-	"github.com/gorilla/sessions"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
 )
 
-var Store = sessions.NewCookieStore([]byte("test-secret"))
+// CookieOptions are the attributes every cookie set by the service carries
+type CookieOptions struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+var cookieOptions = CookieOptions{Secure: true, SameSite: http.SameSiteLaxMode}
+
+// sessionKey signs session cookies, it is set by SetSessionKey
+var sessionKey []byte
+
+// SessionLifetime is how long a user stays logged in across clients after authenticating
+var SessionLifetime = 24 * time.Hour
+
+// SetCookieOptions sets the attributes used for all cookies
+func SetCookieOptions(o CookieOptions) {
+	cookieOptions = o
+}
+
+// Cookies returns the attributes used for all cookies
+func Cookies() CookieOptions {
+	return cookieOptions
+}
+
+// SetSessionKey sets the secret session cookies are signed with
+func SetSessionKey(key []byte) {
+	sessionKey = key
+}
+
+// SetSessionLifetime replaces the default session lifetime
+func SetSessionLifetime(d time.Duration) {
+	SessionLifetime = d
+}
+
+// SignCookie appends an HMAC of the cookie name and value, so a value
+// set for one cookie can neither be altered nor used as another
+func SignCookie(name, value string) string {
+	return value + "." + cookieSignature(name, value)
+}
+
+// VerifyCookie returns the value of a cookie signed by SignCookie
+func VerifyCookie(name, signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 || len(sessionKey) == 0 {
+		return "", false
+	}
+	value, signature := signed[:i], signed[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(cookieSignature(name, value))) {
+		return "", false
+	}
+	return value, true
+}
+
+func cookieSignature(name, value string) string {
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write([]byte(name + "=" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
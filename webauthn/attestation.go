@@ -0,0 +1,74 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+)
+
+// oidFIDOGenCeAAGUID is the certificate extension holding the authenticator model's AAGUID
+var oidFIDOGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// verifyPackedAttestation checks a "packed" attestation statement (WebAuthn §8.2).
+// The attestation certificate is checked for the required properties but not chained to
+// a trusted root, as we don't restrict which authenticator models users may register.
+func verifyPackedAttestation(statement map[any]any, authData, clientDataHash, aaguid []byte, credentialKey publicKey) error {
+	alg, ok := statement["alg"].(int64)
+	if !ok {
+		return fmt.Errorf("%w: missing alg", ErrInvalidAttestation)
+	}
+	sig, ok := statement["sig"].([]byte)
+	if !ok {
+		return fmt.Errorf("%w: missing sig", ErrInvalidAttestation)
+	}
+	signed := append(slices.Clone(authData), clientDataHash...)
+
+	chain, hasCertificate := statement["x5c"].([]any)
+	if !hasCertificate {
+		// Self attestation, signed with the credential key itself
+		if alg != credentialKey.alg {
+			return fmt.Errorf("%w: alg does not match credential key", ErrInvalidAttestation)
+		}
+		if err := verifySignature(alg, credentialKey.key, signed, sig); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+		}
+		return nil
+	}
+
+	if len(chain) == 0 {
+		return fmt.Errorf("%w: empty x5c", ErrInvalidAttestation)
+	}
+	der, ok := chain[0].([]byte)
+	if !ok {
+		return fmt.Errorf("%w: invalid x5c", ErrInvalidAttestation)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+	}
+
+	if err := verifySignature(alg, cert.PublicKey, signed, sig); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+	}
+
+	// Certificate requirements from §8.2.1
+	if cert.Version != 3 || cert.IsCA || !slices.Contains(cert.Subject.OrganizationalUnit, "Authenticator Attestation") {
+		return fmt.Errorf("%w: attestation certificate does not meet requirements", ErrInvalidAttestation)
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidFIDOGenCeAAGUID) {
+			continue
+		}
+		var certAAGUID []byte
+		if _, err := asn1.Unmarshal(ext.Value, &certAAGUID); err != nil || !bytes.Equal(certAAGUID, aaguid) {
+			return fmt.Errorf("%w: AAGUID does not match attestation certificate", ErrInvalidAttestation)
+		}
+		if ext.Critical {
+			return fmt.Errorf("%w: AAGUID extension must not be critical", ErrInvalidAttestation)
+		}
+	}
+
+	return nil
+}
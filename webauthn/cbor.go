@@ -0,0 +1,204 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth bounds nesting so hostile input can't exhaust the stack
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// decodeCBOR decodes the first CBOR data item in data, returning it and the number of bytes it used.
+// Only the subset authenticators produce is supported: definite lengths, integers, byte and text
+// strings, arrays, maps with integer or text keys, simple values and floats.
+// Integers decode to int64, byte strings to []byte, arrays to []any and maps to map[any]any.
+func decodeCBOR(data []byte) (any, int, error) {
+	d := cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, d.pos, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) remaining() int {
+	return len(d.data) - d.pos
+}
+
+func (d *cborDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > d.remaining() {
+		return nil, errCBORTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// argument reads the number following an initial byte with the given additional information
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		b, err := d.next(1)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(b[0]), nil
+	case info == 25:
+		b, err := d.next(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err := d.next(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err := d.next(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(b), nil
+	default:
+		return 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+}
+
+// length reads a length argument, making sure it can't point past the end of the data
+func (d *cborDecoder) length(info byte) (int, error) {
+	n, err := d.argument(info)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(d.remaining()) {
+		return 0, errCBORTruncated
+	}
+	return int(n), nil
+}
+
+func (d *cborDecoder) value(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, errors.New("cbor: nesting too deep")
+	}
+
+	initial, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	major, info := initial[0]>>5, initial[0]&0x1f
+
+	switch major {
+	case 0, 1:
+		n, err := d.argument(info)
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflows int64")
+		}
+		if major == 1 {
+			return -1 - int64(n), nil
+		}
+		return int64(n), nil
+
+	case 2, 3:
+		n, err := d.length(info)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+
+	case 4:
+		n, err := d.length(info)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]any, 0, n)
+		for range n {
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+
+	case 5:
+		n, err := d.length(info)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[any]any, n)
+		for range n {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+			if _, ok := m[key]; ok {
+				return nil, fmt.Errorf("cbor: duplicate map key %v", key)
+			}
+			value, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+
+	case 6:
+		// Tags carry no meaning for the structures we read, decode the tagged item itself
+		if _, err := d.argument(info); err != nil {
+			return nil, err
+		}
+		return d.value(depth + 1)
+
+	default:
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 26:
+			n, err := d.argument(info)
+			if err != nil {
+				return nil, err
+			}
+			return float64(math.Float32frombits(uint32(n))), nil
+		case 27:
+			n, err := d.argument(info)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(n), nil
+		default:
+			return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+		}
+	}
+}
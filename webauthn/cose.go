@@ -0,0 +1,147 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers we accept for credentials and attestation signatures
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms lists the COSE algorithms in order of preference, as offered to authenticators
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+var ErrUnsupportedKey = errors.New("webauthn: unsupported credential public key")
+
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parseCOSEKey decodes a COSE_Key, returning the key and the number of bytes it used
+func parseCOSEKey(data []byte) (publicKey, int, error) {
+	v, n, err := decodeCBOR(data)
+	if err != nil {
+		return publicKey{}, 0, err
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return publicKey{}, 0, ErrUnsupportedKey
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, 0, ErrUnsupportedKey
+		}
+		// Reject points that aren't on the curve before using them
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return publicKey{}, 0, ErrUnsupportedKey
+		}
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		return publicKey{alg: alg, key: key}, n, nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, 0, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: ed25519.PublicKey(x)}, n, nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		modulus, _ := m[int64(coseN)].([]byte)
+		exponent, _ := m[int64(coseE)].([]byte)
+		if len(modulus) < 256 || len(exponent) == 0 || len(exponent) > 4 {
+			return publicKey{}, 0, ErrUnsupportedKey
+		}
+		e := 0
+		for _, b := range exponent {
+			e = e<<8 | int(b)
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: e}
+		return publicKey{alg: alg, key: key}, n, nil
+	}
+
+	return publicKey{}, 0, fmt.Errorf("%w: kty %d alg %d", ErrUnsupportedKey, kty, alg)
+}
+
+// verifySignature checks sig over message with key using the COSE algorithm alg
+func verifySignature(alg int64, key crypto.PublicKey, message, sig []byte) error {
+	switch alg {
+	case AlgES256:
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		digest := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case AlgEdDSA:
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		if !ed25519.Verify(k, message, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case AlgRS256:
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		digest := sha256.Sum256(message)
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: alg %d", ErrUnsupportedKey, alg)
+}
@@ -0,0 +1,432 @@
+// Package webauthn implements the relying party side of the WebAuthn registration and
+// authentication ceremonies (https://www.w3.org/TR/webauthn-2/), supporting the "none"
+// and "packed" attestation formats.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidClientData  = errors.New("webauthn: invalid client data")
+	ErrChallengeMismatch  = errors.New("webauthn: challenge does not match")
+	ErrOriginMismatch     = errors.New("webauthn: origin does not match")
+	ErrRPIDMismatch       = errors.New("webauthn: relying party ID does not match")
+	ErrUserNotPresent     = errors.New("webauthn: user was not present")
+	ErrUserNotVerified    = errors.New("webauthn: user was not verified")
+	ErrInvalidSignature   = errors.New("webauthn: invalid signature")
+	ErrInvalidAttestation = errors.New("webauthn: invalid attestation")
+	// ErrSignCountRegressed means the authenticator may have been cloned
+	ErrSignCountRegressed = errors.New("webauthn: signature counter did not increase")
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+	flagExtensionData          = 0x80
+)
+
+// maxCredentialIDLength is the largest credential ID the spec allows
+const maxCredentialIDLength = 1023
+
+// Bytes is binary data that is base64url encoded in JSON, as the browser API expects
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty identifies this service to authenticators
+type RelyingParty struct {
+	// ID is the domain credentials are scoped to, e.g. auth.example.com
+	ID   string
+	Name string
+	// Origin is the exact origin the ceremonies run on, e.g. https://auth.example.com
+	Origin string
+}
+
+// NewChallenge returns a random challenge for a single ceremony
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         Bytes    `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey,omitempty"`
+	UserVerification string `json:"userVerification,omitempty"`
+}
+
+// CreationOptions are passed to navigator.credentials.create
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Bytes                  `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions builds the options for registering a new credential for user.
+// Credentials in exclude are already registered and won't be created again.
+func (rp RelyingParty) CreationOptions(user UserEntity, challenge []byte, timeout time.Duration, exclude []CredentialDescriptor) CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return CreationOptions{
+		RP:                 RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds the options for asserting a credential. An empty allow list lets the
+// user pick any discoverable credential (a passkey) for this relying party.
+func (rp RelyingParty) RequestOptions(challenge []byte, timeout time.Duration, allow []CredentialDescriptor, userVerification string) RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// RegistrationCredential is the PublicKeyCredential returned by navigator.credentials.create
+type RegistrationCredential struct {
+	ID       Bytes               `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+type AttestationResponse struct {
+	ClientDataJSON    Bytes    `json:"clientDataJSON"`
+	AttestationObject Bytes    `json:"attestationObject"`
+	Transports        []string `json:"transports,omitempty"`
+}
+
+// AssertionCredential is the PublicKeyCredential returned by navigator.credentials.get
+type AssertionCredential struct {
+	ID       Bytes             `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+type AssertionResponse struct {
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AuthenticatorData Bytes `json:"authenticatorData"`
+	Signature         Bytes `json:"signature"`
+	UserHandle        Bytes `json:"userHandle,omitempty"`
+}
+
+// Credential is a verified new credential, to be stored for later assertions
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE encoded credential public key
+	PublicKey         []byte
+	SignCount         uint32
+	AAGUID            []byte
+	UserVerified      bool
+	AttestationFormat string
+}
+
+// Assertion is the outcome of a verified authentication ceremony
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ClientDataChallenge returns the challenge a response was created for, so the caller
+// can look up the ceremony it belongs to before verifying it
+func ClientDataChallenge(clientDataJSON []byte) ([]byte, error) {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return nil, ErrInvalidClientData
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || len(challenge) == 0 {
+		return nil, ErrInvalidClientData
+	}
+	return challenge, nil
+}
+
+func (rp RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return ErrInvalidClientData
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: type %q", ErrInvalidClientData, cd.Type)
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if cd.Origin != rp.Origin || cd.CrossOrigin {
+		return fmt.Errorf("%w: %s", ErrOriginMismatch, cd.Origin)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	// Only present when a credential was just created
+	aaguid        []byte
+	credentialID  []byte
+	credentialKey []byte
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, errors.New("webauthn: authenticator data too short")
+	}
+
+	ad := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if ad.flags&flagAttestedCredentialData != 0 {
+		if len(rest) < 18 {
+			return authenticatorData{}, errors.New("webauthn: attested credential data too short")
+		}
+		ad.aaguid = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength > maxCredentialIDLength || idLength > len(rest) {
+			return authenticatorData{}, errors.New("webauthn: invalid credential ID length")
+		}
+		ad.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		// The key is followed directly by the extensions, so its length is only known by decoding it
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+		}
+		ad.credentialKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if ad.flags&flagExtensionData != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, fmt.Errorf("webauthn: invalid extension data: %w", err)
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return authenticatorData{}, errors.New("webauthn: trailing bytes in authenticator data")
+	}
+	return ad, nil
+}
+
+func (rp RelyingParty) verifyAuthenticatorData(ad authenticatorData, requireUserVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return ErrRPIDMismatch
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUserVerification && ad.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+// VerifyRegistration verifies the response to a registration ceremony started with challenge
+// and returns the new credential
+func (rp RelyingParty) VerifyRegistration(challenge []byte, cred RegistrationCredential, requireUserVerification bool) (Credential, error) {
+	if cred.Type != "public-key" {
+		return Credential{}, fmt.Errorf("webauthn: unsupported credential type %q", cred.Type)
+	}
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+
+	v, _, err := decodeCBOR(cred.Response.AttestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("webauthn: invalid attestation object: %w", err)
+	}
+	attestation, ok := v.(map[any]any)
+	if !ok {
+		return Credential{}, errors.New("webauthn: invalid attestation object")
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[any]any)
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := rp.verifyAuthenticatorData(ad, requireUserVerification); err != nil {
+		return Credential{}, err
+	}
+	if ad.flags&flagAttestedCredentialData == 0 {
+		return Credential{}, errors.New("webauthn: no credential in registration response")
+	}
+	if !bytes.Equal(ad.credentialID, cred.ID) {
+		return Credential{}, errors.New("webauthn: credential ID does not match")
+	}
+
+	key, _, err := parseCOSEKey(ad.credentialKey)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	clientDataHash := sha256.Sum256(cred.Response.ClientDataJSON)
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return Credential{}, ErrInvalidAttestation
+		}
+	case "packed":
+		if err := verifyPackedAttestation(statement, rawAuthData, clientDataHash[:], ad.aaguid, key); err != nil {
+			return Credential{}, err
+		}
+	default:
+		return Credential{}, fmt.Errorf("%w: unsupported format %q", ErrInvalidAttestation, format)
+	}
+
+	return Credential{
+		ID:                slices.Clone(ad.credentialID),
+		PublicKey:         slices.Clone(ad.credentialKey),
+		SignCount:         ad.signCount,
+		AAGUID:            slices.Clone(ad.aaguid),
+		UserVerified:      ad.flags&flagUserVerified != 0,
+		AttestationFormat: format,
+	}, nil
+}
+
+// VerifyAssertion verifies the response to an authentication ceremony started with challenge
+// against a stored credential public key and signature counter
+func (rp RelyingParty) VerifyAssertion(challenge []byte, cred AssertionCredential, credentialPublicKey []byte, storedSignCount uint32, requireUserVerification bool) (Assertion, error) {
+	if cred.Type != "public-key" {
+		return Assertion{}, fmt.Errorf("webauthn: unsupported credential type %q", cred.Type)
+	}
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return Assertion{}, err
+	}
+
+	ad, err := parseAuthenticatorData(cred.Response.AuthenticatorData)
+	if err != nil {
+		return Assertion{}, err
+	}
+	if err := rp.verifyAuthenticatorData(ad, requireUserVerification); err != nil {
+		return Assertion{}, err
+	}
+
+	key, _, err := parseCOSEKey(credentialPublicKey)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	clientDataHash := sha256.Sum256(cred.Response.ClientDataJSON)
+	signed := append(slices.Clone([]byte(cred.Response.AuthenticatorData)), clientDataHash[:]...)
+	if err := verifySignature(key.alg, key.key, signed, cred.Response.Signature); err != nil {
+		return Assertion{}, err
+	}
+
+	// Authenticators without a counter always report zero
+	if (ad.signCount != 0 || storedSignCount != 0) && ad.signCount <= storedSignCount {
+		return Assertion{}, ErrSignCountRegressed
+	}
+
+	return Assertion{
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
@@ -0,0 +1,307 @@
+package webauthn_test
+
+import (
+	"auth_go/webauthn"
+	"auth_go/webauthn/webauthntest"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var rp = webauthn.RelyingParty{ID: "auth.example.com", Name: "auth.example.com", Origin: "https://auth.example.com"}
+
+func newChallenge(t *testing.T) []byte {
+	t.Helper()
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+func newAuthenticator(t *testing.T, alg int64) *webauthntest.Authenticator {
+	t.Helper()
+
+	a, err := webauthntest.New(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// register creates a credential on the authenticator and returns it verified
+func register(t *testing.T, a *webauthntest.Authenticator) webauthn.Credential {
+	t.Helper()
+
+	challenge := newChallenge(t)
+	response, err := a.Register(rp, challenge, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := rp.VerifyRegistration(challenge, response, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credential
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	for _, alg := range []int64{webauthn.AlgES256, webauthn.AlgEdDSA} {
+		for _, format := range []string{"none", "packed"} {
+			a := newAuthenticator(t, alg)
+			challenge := newChallenge(t)
+			response, err := a.Register(rp, challenge, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			credential, err := rp.VerifyRegistration(challenge, response, true)
+			if err != nil {
+				t.Errorf("alg %d %s: %v", alg, format, err)
+				continue
+			}
+			if !bytes.Equal(credential.ID, a.CredentialID) || !bytes.Equal(credential.PublicKey, a.PublicKey()) {
+				t.Errorf("alg %d %s: credential %x does not match the authenticator's", alg, format, credential.ID)
+			}
+			if credential.AttestationFormat != format || !credential.UserVerified {
+				t.Errorf("alg %d %s: got format %q, user verified %v", alg, format, credential.AttestationFormat, credential.UserVerified)
+			}
+		}
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		// respond answers the ceremony for challenge, possibly wrongly
+		respond                 func(a *webauthntest.Authenticator, challenge []byte) (webauthn.RegistrationCredential, error)
+		requireUserVerification bool
+		want                    error
+	}{
+		{
+			name: "wrong origin",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.RegistrationCredential, error) {
+				phishing := rp
+				phishing.Origin = "https://auth.example.com.evil.example"
+				return a.Register(phishing, challenge, "none")
+			},
+			want: webauthn.ErrOriginMismatch,
+		},
+		{
+			name: "wrong rpIdHash",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.RegistrationCredential, error) {
+				other := rp
+				other.ID = "example.org"
+				return a.Register(other, challenge, "none")
+			},
+			want: webauthn.ErrRPIDMismatch,
+		},
+		{
+			name: "other challenge",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.RegistrationCredential, error) {
+				return a.Register(rp, append(bytes.Clone(challenge), 0), "none")
+			},
+			want: webauthn.ErrChallengeMismatch,
+		},
+		{
+			name: "missing user verification",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.RegistrationCredential, error) {
+				a.UserVerified = false
+				return a.Register(rp, challenge, "none")
+			},
+			requireUserVerification: true,
+			want:                    webauthn.ErrUserNotVerified,
+		},
+		{
+			name: "packed attestation over other client data",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.RegistrationCredential, error) {
+				response, err := a.Register(rp, challenge, "packed")
+				// Valid client data for the ceremony, but not what the authenticator signed
+				response.Response.ClientDataJSON = []byte(`{"type":"webauthn.create","challenge":"` +
+					base64.RawURLEncoding.EncodeToString(challenge) + `","origin":"` + rp.Origin + `"}`)
+				return response, err
+			},
+			want: webauthn.ErrInvalidAttestation,
+		},
+	}
+
+	for _, tt := range tests {
+		challenge := newChallenge(t)
+		response, err := tt.respond(newAuthenticator(t, webauthn.AlgEdDSA), challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rp.VerifyRegistration(challenge, response, tt.requireUserVerification)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	for _, alg := range []int64{webauthn.AlgES256, webauthn.AlgEdDSA} {
+		a := newAuthenticator(t, alg)
+		credential := register(t, a)
+
+		challenge := newChallenge(t)
+		response, err := a.Assert(rp, challenge, []byte("user"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertion, err := rp.VerifyAssertion(challenge, response, credential.PublicKey, credential.SignCount, true)
+		if err != nil {
+			t.Errorf("alg %d: %v", alg, err)
+			continue
+		}
+		if assertion.SignCount != a.SignCount || !assertion.UserVerified {
+			t.Errorf("alg %d: got sign count %d, user verified %v", alg, assertion.SignCount, assertion.UserVerified)
+		}
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		// respond answers the ceremony for challenge, possibly wrongly, and returns the sign count stored before it
+		respond                 func(a *webauthntest.Authenticator, challenge []byte) (webauthn.AssertionCredential, uint32, error)
+		requireUserVerification bool
+		want                    error
+	}{
+		{
+			name: "wrong origin",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.AssertionCredential, uint32, error) {
+				phishing := rp
+				phishing.Origin = "https://login.evil.example"
+				response, err := a.Assert(phishing, challenge, nil)
+				return response, 0, err
+			},
+			want: webauthn.ErrOriginMismatch,
+		},
+		{
+			name: "wrong rpIdHash",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.AssertionCredential, uint32, error) {
+				other := rp
+				other.ID = "evil.example"
+				response, err := a.Assert(other, challenge, nil)
+				return response, 0, err
+			},
+			want: webauthn.ErrRPIDMismatch,
+		},
+		{
+			name: "missing user verification",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.AssertionCredential, uint32, error) {
+				a.UserVerified = false
+				response, err := a.Assert(rp, challenge, nil)
+				return response, 0, err
+			},
+			requireUserVerification: true,
+			want:                    webauthn.ErrUserNotVerified,
+		},
+		{
+			name: "sign count regression",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.AssertionCredential, uint32, error) {
+				// A clone of the authenticator lagging behind the counter the original already reached
+				response, err := a.Assert(rp, challenge, nil)
+				return response, a.SignCount + 5, err
+			},
+			want: webauthn.ErrSignCountRegressed,
+		},
+		{
+			name: "sign count replayed",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.AssertionCredential, uint32, error) {
+				response, err := a.Assert(rp, challenge, nil)
+				return response, a.SignCount, err
+			},
+			want: webauthn.ErrSignCountRegressed,
+		},
+		{
+			name: "tampered authenticator data",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.AssertionCredential, uint32, error) {
+				response, err := a.Assert(rp, challenge, nil)
+				// Raise the counter after signing
+				response.Response.AuthenticatorData[36]++
+				return response, 0, err
+			},
+			want: webauthn.ErrInvalidSignature,
+		},
+		{
+			name: "signed by another credential",
+			respond: func(a *webauthntest.Authenticator, challenge []byte) (webauthn.AssertionCredential, uint32, error) {
+				other := newAuthenticator(t, webauthn.AlgES256)
+				other.CredentialID = a.CredentialID
+				response, err := other.Assert(rp, challenge, nil)
+				return response, 0, err
+			},
+			want: webauthn.ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		a := newAuthenticator(t, webauthn.AlgES256)
+		credential := register(t, a)
+		challenge := newChallenge(t)
+		response, storedSignCount, err := tt.respond(a, challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rp.VerifyAssertion(challenge, response, credential.PublicKey, storedSignCount, tt.requireUserVerification)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestMalformedCBOR(t *testing.T) {
+	a := newAuthenticator(t, webauthn.AlgES256)
+	challenge := newChallenge(t)
+	valid, err := a.Register(rp, challenge, "packed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestationObjects := map[string][]byte{
+		"empty":                    {},
+		"not a map":                {0x01},
+		"map shorter than header":  {0xa3, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e'},
+		"byte string past the end": {0xa1, 0x68, 'a', 'u', 't', 'h', 'D', 'a', 't', 'a', 0x5a, 0xff, 0xff, 0xff, 0xff},
+		"indefinite length map":    {0xbf, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e', 0xff},
+		"array as map key":         {0xa1, 0x80, 0x00},
+		"duplicate map key":        {0xa2, 0x63, 'f', 'm', 't', 0x00, 0x63, 'f', 'm', 't', 0x00},
+		"nested too deep":          append(bytes.Repeat([]byte{0x81}, 64), 0x00),
+		"unsupported simple value": {0xf8, 0x20},
+	}
+	// Every truncation of a valid attestation object, which ends inside the authenticator data and its COSE key
+	for n := range len(valid.Response.AttestationObject) {
+		attestationObjects[fmt.Sprintf("truncated to %d bytes", n)] = valid.Response.AttestationObject[:n]
+	}
+
+	for name, object := range attestationObjects {
+		response := valid
+		response.Response.AttestationObject = object
+		if _, err := rp.VerifyRegistration(challenge, response, false); err == nil {
+			t.Errorf("%s attestation object %x was accepted", name, object)
+		}
+	}
+
+	credential := register(t, a)
+	challenge = newChallenge(t)
+	assertion, err := a.Assert(rp, challenge, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := range len(assertion.Response.AuthenticatorData) {
+		response := assertion
+		response.Response.AuthenticatorData = assertion.Response.AuthenticatorData[:n]
+		if _, err := rp.VerifyAssertion(challenge, response, credential.PublicKey, 0, false); err == nil {
+			t.Errorf("authenticator data truncated to %d bytes was accepted", n)
+		}
+	}
+	for n := range len(credential.PublicKey) {
+		if _, err := rp.VerifyAssertion(challenge, assertion, credential.PublicKey[:n], 0, false); err == nil {
+			t.Errorf("credential public key truncated to %d bytes was accepted", n)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package webauthntest provides a software authenticator for testing the relying party side of
+// WebAuthn, much like net/http/httptest does for HTTP handlers.
+package webauthntest
+
+import (
+	"auth_go/webauthn"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+// Authenticator holds one credential and answers ceremonies for any relying party it is given,
+// so tests can produce responses for the wrong origin or RP ID by passing a different one
+type Authenticator struct {
+	CredentialID []byte
+	AAGUID       []byte
+	// SignCount is the signature counter, it is incremented before every assertion
+	SignCount uint32
+	// UserVerified sets the UV flag, the UP flag is always set
+	UserVerified bool
+
+	alg   int64
+	ecKey *ecdsa.PrivateKey
+	edKey ed25519.PrivateKey
+}
+
+// New creates an authenticator with a fresh credential for webauthn.AlgES256 or webauthn.AlgEdDSA
+func New(alg int64) (*Authenticator, error) {
+	a := &Authenticator{
+		CredentialID: make([]byte, 16),
+		AAGUID:       make([]byte, 16),
+		UserVerified: true,
+		alg:          alg,
+	}
+	if _, err := rand.Read(a.CredentialID); err != nil {
+		return nil, err
+	}
+
+	var err error
+	switch alg {
+	case webauthn.AlgES256:
+		a.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case webauthn.AlgEdDSA:
+		_, a.edKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("webauthntest: unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// PublicKey returns the COSE encoded public key of the credential
+func (a *Authenticator) PublicKey() []byte {
+	if a.alg == webauthn.AlgEdDSA {
+		return encodeCBOR(cborMap{
+			{int64(1), int64(1)},  // kty: OKP
+			{int64(3), a.alg},     // alg
+			{int64(-1), int64(6)}, // crv: Ed25519
+			{int64(-2), []byte(a.edKey.Public().(ed25519.PublicKey))},
+		})
+	}
+
+	point, _ := a.ecKey.PublicKey.ECDH()
+	raw := point.Bytes()
+	return encodeCBOR(cborMap{
+		{int64(1), int64(2)},  // kty: EC2
+		{int64(3), a.alg},     // alg
+		{int64(-1), int64(1)}, // crv: P-256
+		{int64(-2), raw[1:33]},
+		{int64(-3), raw[33:65]},
+	})
+}
+
+// Register answers a registration ceremony with the "none" or "packed" (self) attestation format
+func (a *Authenticator) Register(rp webauthn.RelyingParty, challenge []byte, format string) (webauthn.RegistrationCredential, error) {
+	clientDataJSON, err := ClientData("webauthn.create", challenge, rp.Origin)
+	if err != nil {
+		return webauthn.RegistrationCredential{}, err
+	}
+
+	authData := a.authenticatorData(rp.ID, true)
+	statement := cborMap{}
+	switch format {
+	case "none":
+	case "packed":
+		sig, err := a.sign(authData, clientDataJSON)
+		if err != nil {
+			return webauthn.RegistrationCredential{}, err
+		}
+		statement = cborMap{{"alg", a.alg}, {"sig", sig}}
+	default:
+		return webauthn.RegistrationCredential{}, fmt.Errorf("webauthntest: unsupported attestation format %q", format)
+	}
+
+	return webauthn.RegistrationCredential{
+		ID:   bytes.Clone(a.CredentialID),
+		Type: "public-key",
+		Response: webauthn.AttestationResponse{
+			ClientDataJSON: clientDataJSON,
+			AttestationObject: encodeCBOR(cborMap{
+				{"fmt", format},
+				{"attStmt", statement},
+				{"authData", authData},
+			}),
+			Transports: []string{"internal"},
+		},
+	}, nil
+}
+
+// Assert answers an authentication ceremony, incrementing the signature counter first.
+// userHandle is what passkeys return as the user's ID, nil for security keys.
+func (a *Authenticator) Assert(rp webauthn.RelyingParty, challenge, userHandle []byte) (webauthn.AssertionCredential, error) {
+	clientDataJSON, err := ClientData("webauthn.get", challenge, rp.Origin)
+	if err != nil {
+		return webauthn.AssertionCredential{}, err
+	}
+
+	a.SignCount++
+	authData := a.authenticatorData(rp.ID, false)
+	sig, err := a.sign(authData, clientDataJSON)
+	if err != nil {
+		return webauthn.AssertionCredential{}, err
+	}
+
+	return webauthn.AssertionCredential{
+		ID:   bytes.Clone(a.CredentialID),
+		Type: "public-key",
+		Response: webauthn.AssertionResponse{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: authData,
+			Signature:         sig,
+			UserHandle:        userHandle,
+		},
+	}, nil
+}
+
+// ClientData builds the clientDataJSON a browser passes to the authenticator
+func ClientData(ceremony string, challenge []byte, origin string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+}
+
+// authenticatorData builds the authenticator data for rpID, with the credential when it is being registered
+func (a *Authenticator) authenticatorData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := byte(flagUserPresent)
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+	if attested {
+		flags |= flagAttestedCredentialData
+	}
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+	if attested {
+		data = append(data, a.AAGUID...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.CredentialID)))
+		data = append(data, a.CredentialID...)
+		data = append(data, a.PublicKey()...)
+	}
+	return data
+}
+
+// sign signs authData || SHA-256(clientDataJSON) with the credential key
+func (a *Authenticator) sign(authData, clientDataJSON []byte) ([]byte, error) {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	message := append(bytes.Clone(authData), clientDataHash[:]...)
+
+	if a.alg == webauthn.AlgEdDSA {
+		return ed25519.Sign(a.edKey, message), nil
+	}
+	digest := sha256.Sum256(message)
+	return ecdsa.SignASN1(rand.Reader, a.ecKey, digest[:])
+}
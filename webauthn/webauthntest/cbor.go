@@ -0,0 +1,68 @@
+package webauthntest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// cborMap is a CBOR map whose entries are encoded in the given order
+type cborMap [][2]any
+
+// encodeCBOR encodes the subset of CBOR authenticators produce: integers, byte and text strings,
+// arrays and maps. It panics on anything else, the input is always built by this package.
+func encodeCBOR(v any) []byte {
+	var buf bytes.Buffer
+	writeCBOR(&buf, v)
+	return buf.Bytes()
+}
+
+func writeCBOR(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			writeCBORHead(buf, 1, uint64(-1-v))
+		} else {
+			writeCBORHead(buf, 0, uint64(v))
+		}
+	case []byte:
+		writeCBORHead(buf, 2, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCBORHead(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case []any:
+		writeCBORHead(buf, 4, uint64(len(v)))
+		for _, item := range v {
+			writeCBOR(buf, item)
+		}
+	case cborMap:
+		writeCBORHead(buf, 5, uint64(len(v)))
+		for _, entry := range v {
+			writeCBOR(buf, entry[0])
+			writeCBOR(buf, entry[1])
+		}
+	default:
+		panic(fmt.Sprintf("webauthntest: cannot encode %T as CBOR", v))
+	}
+}
+
+// writeCBORHead writes the initial byte of a data item and its argument in the shortest form
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= 0xff:
+		buf.Write([]byte{major | 24, byte(n)})
+	case n <= 0xffff:
+		buf.WriteByte(major | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= 0xffffffff:
+		buf.WriteByte(major | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		buf.WriteByte(major | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}